@@ -1,38 +1,54 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strings"
 
+	"github.com/chuma-beep/stock-saas/internal/alerts"
+	"github.com/chuma-beep/stock-saas/internal/api"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/cache"
 	"github.com/chuma-beep/stock-saas/internal/database"
-	"github.com/chuma-beep/stock-saas/internal/handler"
-	"github.com/chuma-beep/stock-saas/internal/handlers"
+	"github.com/chuma-beep/stock-saas/internal/live"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/prompts"
+	"github.com/chuma-beep/stock-saas/internal/requestid"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
 
-	router := gin.Default()
+	// gin.Default's recovery answers panics with an empty 500; ours sends a problem
+	router := gin.New()
+	// WebSocket handshakes carry ?access_token=, which must stay out of logs
+	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{Formatter: auth.LogFormatter}))
 	// CORS configuration
 	router.Use(cors.New(cors.Config{
-		AllowOrigins: []string{
-			"http://localhost:3000",
-			"https://stock-saas-frontend.vercel.app",
-			"https://*.onrender.com",
-		},
+		AllowOrigins:     auth.AllowedOrigins(),
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-ID", "If-None-Match", "If-Modified-Since"},
+		ExposeHeaders:    []string{"Content-Length", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-Plan-Limit", "X-Plan-Remaining", "X-Request-ID", "Deprecation", "Link", "ETag", "Last-Modified"},
 		AllowCredentials: true,
 		MaxAge:           12 * 3600, // 12 hours
 	}))
+	router.Use(requestid.Middleware())
+	router.Use(problem.Recovery())
 
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+	// c.ClientIP() keys the per-IP limits and the audit log, so forwarding
+	// headers are only believed from the proxies we run behind
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
 	}
+	router.TrustedPlatform = os.Getenv("TRUSTED_PLATFORM")
 
 	// Get port from environment variable  for google Cloud Run
 	port := os.Getenv("PORT")
@@ -46,6 +62,9 @@ func main() {
 	}
 	defer database.Close()
 
+	// Latest prices, ranges and stats; saving bars invalidates them
+	cache.Default = cache.Open()
+
 	// Auto-create table with Unique Constraint
 
 	createTableQuery := `
@@ -66,6 +85,14 @@ func main() {
 		log.Fatal("Failed to create database table:", err)
 	}
 
+	// Revised bars bump updated_at, which /stock and /compare ETags use
+	stocksUpdatedAtQuery := `
+	ALTER TABLE stocks ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;`
+
+	if _, err := database.DB.Exec(stocksUpdatedAtQuery); err != nil {
+		log.Fatal("Failed to add stocks updated_at column:", err)
+	}
+
 	feedbackTableQuery := `
 	CREATE TABLE IF NOT EXISTS feedback (
 		id SERIAL PRIMARY KEY,
@@ -78,34 +105,395 @@ func main() {
 	if _, err := database.DB.Exec(feedbackTableQuery); err != nil {
 		log.Fatal("Failed to create feedback table:", err)
 	}
+
+	// Moderation workflow for feedback
+	feedbackStatusQuery := `
+	ALTER TABLE feedback ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'new';
+	ALTER TABLE feedback ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
+	ALTER TABLE feedback ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+	CREATE INDEX IF NOT EXISTS idx_feedback_status ON feedback(status, id DESC);`
+
+	if _, err := database.DB.Exec(feedbackStatusQuery); err != nil {
+		log.Fatal("Failed to add feedback status columns:", err)
+	}
+
+	promptTemplatesTableQuery := `
+	CREATE TABLE IF NOT EXISTS prompt_templates (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		version INTEGER NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		model VARCHAR(100) NOT NULL,
+		temperature NUMERIC NOT NULL DEFAULT 0.7,
+		max_tokens INTEGER NOT NULL DEFAULT 500,
+		params JSONB NOT NULL DEFAULT '{}',
+		body TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (name, version)
+	);`
+
+	if _, err := database.DB.Exec(promptTemplatesTableQuery); err != nil {
+		log.Fatal("Failed to create prompt_templates table:", err)
+	}
+
+	usersTableQuery := `
+	CREATE TABLE IF NOT EXISTS users (
+		id SERIAL PRIMARY KEY,
+		email VARCHAR(255) NOT NULL UNIQUE,
+		password_hash VARCHAR(255) NOT NULL,
+		role VARCHAR(20) NOT NULL DEFAULT 'user',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(usersTableQuery); err != nil {
+		log.Fatal("Failed to create users table:", err)
+	}
+
+	refreshTokensTableQuery := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(refreshTokensTableQuery); err != nil {
+		log.Fatal("Failed to create refresh_tokens table:", err)
+	}
+
+	apiKeysTableQuery := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		prefix VARCHAR(20) NOT NULL,
+		key_hash VARCHAR(64) NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP,
+		revoked_at TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(apiKeysTableQuery); err != nil {
+		log.Fatal("Failed to create api_keys table:", err)
+	}
+
+	apiKeyUsageTableQuery := `
+	CREATE TABLE IF NOT EXISTS api_key_usage (
+		api_key_id INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+		route VARCHAR(50) NOT NULL,
+		day DATE NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (api_key_id, route, day)
+	);`
+
+	if _, err := database.DB.Exec(apiKeyUsageTableQuery); err != nil {
+		log.Fatal("Failed to create api_key_usage table:", err)
+	}
+
+	watchlistsTableQuery := `
+	CREATE TABLE IF NOT EXISTS watchlists (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(watchlistsTableQuery); err != nil {
+		log.Fatal("Failed to create watchlists table:", err)
+	}
+
+	watchlistItemsTableQuery := `
+	CREATE TABLE IF NOT EXISTS watchlist_items (
+		watchlist_id INTEGER NOT NULL REFERENCES watchlists(id) ON DELETE CASCADE,
+		symbol VARCHAR(10) NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		notes TEXT NOT NULL DEFAULT '',
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (watchlist_id, symbol)
+	);`
+
+	if _, err := database.DB.Exec(watchlistItemsTableQuery); err != nil {
+		log.Fatal("Failed to create watchlist_items table:", err)
+	}
+
+	savedComparisonsTableQuery := `
+	CREATE TABLE IF NOT EXISTS saved_comparisons (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		slug VARCHAR(16) NOT NULL UNIQUE,
+		title VARCHAR(255) NOT NULL,
+		tickers TEXT[] NOT NULL,
+		start_date DATE NOT NULL,
+		end_date DATE NOT NULL,
+		preset VARCHAR(100) NOT NULL DEFAULT '',
+		template VARCHAR(100) NOT NULL DEFAULT '',
+		normalization VARCHAR(20) NOT NULL DEFAULT 'none',
+		visibility VARCHAR(20) NOT NULL DEFAULT 'private',
+		analysis JSONB,
+		analyzed_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(savedComparisonsTableQuery); err != nil {
+		log.Fatal("Failed to create saved_comparisons table:", err)
+	}
+
+	alertRulesTableQuery := `
+	CREATE TABLE IF NOT EXISTS alert_rules (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		ticker VARCHAR(10) NOT NULL,
+		kind VARCHAR(30) NOT NULL,
+		threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+		period INTEGER NOT NULL DEFAULT 0,
+		cooldown_minutes INTEGER NOT NULL DEFAULT 1440,
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		last_triggered_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_alert_rules_ticker ON alert_rules(ticker) WHERE active;`
+
+	if _, err := database.DB.Exec(alertRulesTableQuery); err != nil {
+		log.Fatal("Failed to create alert_rules table:", err)
+	}
+
+	alertTriggersTableQuery := `
+	CREATE TABLE IF NOT EXISTS alert_triggers (
+		id SERIAL PRIMARY KEY,
+		rule_id INTEGER NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		ticker VARCHAR(10) NOT NULL,
+		kind VARCHAR(30) NOT NULL,
+		bar_date DATE NOT NULL,
+		value DOUBLE PRECISION NOT NULL,
+		message TEXT NOT NULL,
+		triggered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(rule_id, bar_date)
+	);`
+
+	if _, err := database.DB.Exec(alertTriggersTableQuery); err != nil {
+		log.Fatal("Failed to create alert_triggers table:", err)
+	}
+
+	notificationChannelsTableQuery := `
+	CREATE TABLE IF NOT EXISTS notification_channels (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		kind VARCHAR(20) NOT NULL,
+		target TEXT NOT NULL,
+		secret VARCHAR(100) NOT NULL DEFAULT '',
+		events TEXT[] NOT NULL DEFAULT '{}',
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(notificationChannelsTableQuery); err != nil {
+		log.Fatal("Failed to create notification_channels table:", err)
+	}
+
+	notificationDeliveriesTableQuery := `
+	CREATE TABLE IF NOT EXISTS notification_deliveries (
+		id SERIAL PRIMARY KEY,
+		channel_id INTEGER NOT NULL REFERENCES notification_channels(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		event VARCHAR(50) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_notification_deliveries_user ON notification_deliveries(user_id, created_at DESC);`
+
+	if _, err := database.DB.Exec(notificationDeliveriesTableQuery); err != nil {
+		log.Fatal("Failed to create notification_deliveries table:", err)
+	}
+
+	subscriptionsTableQuery := `
+	CREATE TABLE IF NOT EXISTS subscriptions (
+		user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		plan VARCHAR(20) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		provider VARCHAR(50) NOT NULL,
+		provider_subscription_id VARCHAR(255) NOT NULL,
+		current_period_end TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(subscriptionsTableQuery); err != nil {
+		log.Fatal("Failed to create subscriptions table:", err)
+	}
+
+	billingEventsTableQuery := `
+	CREATE TABLE IF NOT EXISTS billing_events (
+		id VARCHAR(255) PRIMARY KEY,
+		type VARCHAR(100) NOT NULL,
+		payload JSONB NOT NULL,
+		received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(billingEventsTableQuery); err != nil {
+		log.Fatal("Failed to create billing_events table:", err)
+	}
+
+	planUsageTableQuery := `
+	CREATE TABLE IF NOT EXISTS plan_usage (
+		subject VARCHAR(100) NOT NULL,
+		metric VARCHAR(50) NOT NULL,
+		day DATE NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (subject, metric, day)
+	);`
+
+	if _, err := database.DB.Exec(planUsageTableQuery); err != nil {
+		log.Fatal("Failed to create plan_usage table:", err)
+	}
+
+	organizationsTableQuery := `
+	CREATE TABLE IF NOT EXISTS organizations (
+		id SERIAL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := database.DB.Exec(organizationsTableQuery); err != nil {
+		log.Fatal("Failed to create organizations table:", err)
+	}
+
+	orgMembersTableQuery := `
+	CREATE TABLE IF NOT EXISTS org_members (
+		org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role VARCHAR(20) NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (org_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_org_members_user ON org_members(user_id);`
+
+	if _, err := database.DB.Exec(orgMembersTableQuery); err != nil {
+		log.Fatal("Failed to create org_members table:", err)
+	}
+
+	// Watchlists and saved comparisons can belong to an organization
+	orgScopeQuery := `
+	ALTER TABLE watchlists ADD COLUMN IF NOT EXISTS org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;
+	ALTER TABLE saved_comparisons ADD COLUMN IF NOT EXISTS org_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE;`
+
+	if _, err := database.DB.Exec(orgScopeQuery); err != nil {
+		log.Fatal("Failed to add org_id columns:", err)
+	}
+	// The audit log is append-only: there are no foreign keys, since a
+	// cascading delete would have to rewrite history, and a trigger rejects
+	// updates and deletes
+	auditLogTableQuery := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		user_id INTEGER,
+		api_key_id INTEGER,
+		principal VARCHAR(255) NOT NULL DEFAULT '',
+		action VARCHAR(100) NOT NULL,
+		resource_type VARCHAR(50) NOT NULL DEFAULT '',
+		resource_id VARCHAR(255) NOT NULL DEFAULT '',
+		request_id VARCHAR(64) NOT NULL DEFAULT '',
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		method VARCHAR(10) NOT NULL DEFAULT '',
+		path TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		diff JSONB
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log(user_id, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource_type, resource_id, id DESC);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_request ON audit_log(request_id);
+	CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+	DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+	CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+		FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();`
+
+	if _, err := database.DB.Exec(auditLogTableQuery); err != nil {
+		log.Fatal("Failed to create audit_log table:", err)
+	}
+
+	rateLimitsTableQuery := `
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		key VARCHAR(255) NOT NULL,
+		window_start TIMESTAMPTZ NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (key, window_start)
+	);`
+
+	if _, err := database.DB.Exec(rateLimitsTableQuery); err != nil {
+		log.Fatal("Failed to create rate_limits table:", err)
+	}
 	log.Println("✅ Database table check passed")
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "ok",
-			"message": "Stock SaaS API is running",
-		})
-	})
+	if os.Getenv("JWT_SECRET") == "" {
+		log.Println("⚠️ JWT_SECRET not set, login and protected routes will fail")
+	}
+
+	provider, err := billing.NewProvider()
+	if err != nil {
+		log.Fatal("Failed to configure billing: ", err)
+	}
+	billing.Current = provider
+	log.Printf("✅ Billing provider: %s", billing.Current.Name())
 
-	router.POST("/api/analyze", handler.AnalyzeComparison)
+	// Prompt templates: built-ins, then an optional directory, then the database
+	if dir := os.Getenv("PROMPT_TEMPLATES_DIR"); dir != "" {
+		if err := prompts.Default.LoadDir(dir); err != nil {
+			log.Fatal("Failed to load prompt templates:", err)
+		}
+	}
+	if err := prompts.Default.LoadDB(database.DB); err != nil {
+		log.Fatal("Failed to load prompt templates from database:", err)
+	}
+	log.Printf("✅ Loaded %d prompt templates", len(prompts.List()))
 
-	// Stock routes
-	router.GET("/fetch/:ticker", handlers.FetchAndStoreStock)
-	router.GET("/stock", handlers.GetStock)
-	router.GET("/compare", handlers.CompareStocks)
-	router.GET("/current-prices", handlers.GetCurrentPrices)
+	// Live prices follow every stored bar, plus ticks if a provider is set
+	database.OnStocksSaved(live.Default.BarsSaved)
+	// Alerts are checked whenever bars are stored, whichever route stored them
+	database.OnStocksSaved(alerts.BarsSaved)
+	if p := live.NewProvider(); p != nil {
+		go p.Run(context.Background(), live.Default)
+		log.Printf("✅ Live quote provider: %s", p.Name())
+	}
 
-	// Feedback routes
-	router.POST("/feedback", handler.SubmitFeedback)
-	router.GET("/feedback", handler.GetFeedback)
+	api.Register(router)
+	router.NoRoute(problem.NotFound)
+	if err := api.Verify(router); err != nil {
+		log.Fatal(err)
+	}
 
 	log.Printf("🚀 Server starting on port %s", port)
 	log.Println("📊 Available endpoints:")
 	log.Println("  GET /health")
-	log.Println("  GET /fetch/:ticker")
-	log.Println("  GET /stock?ticker=AAPL&start=2024-01-01&end=2024-12-01")
-	log.Println("  GET /compare?ticker1=AAPL&ticker2=MSFT&start=2024-01-01&end=2024-12-01")
+	log.Println("  GET /api/v1/openapi.json (full list)")
+	log.Println("  POST /api/v1/auth/signup, POST /api/v1/auth/login, POST /api/v1/auth/refresh")
+	log.Println("  GET /api/v1/fetch/:ticker (auth)")
+	log.Println("  GET /api/v1/stock?ticker=AAPL&start=2024-01-01&end=2024-12-01")
+	log.Println("  GET /api/v1/compare?ticker1=AAPL&ticker2=MSFT&start=2024-01-01&end=2024-12-01")
 
 	router.Run(":" + port)
 }
+
+// trustedProxies reads TRUSTED_PROXIES, a comma-separated list of addresses
+// or CIDRs. Empty means no proxy is trusted and X-Forwarded-For is ignored.
+func trustedProxies() []string {
+	var proxies []string
+	for p := range strings.SplitSeq(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,164 @@
+// Command evalprompts runs a fixed corpus of comparison fixtures through the
+// analyze pipeline and scores the output against rubric assertions, so prompt
+// changes can be compared by diffing the reports.
+//
+//	go run ./cmd/evalprompts -client mock
+//	go run ./cmd/evalprompts -client groq -template default -out report-v1.md
+//	go run ./cmd/evalprompts -client openai -url http://localhost:11434/v1/chat/completions -model llama3.1
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/handler"
+	"github.com/chuma-beep/stock-saas/internal/prompts"
+	"github.com/chuma-beep/stock-saas/internal/services"
+	"github.com/joho/godotenv"
+)
+
+// Fixture is one comparison to analyze plus what a good answer must satisfy
+type Fixture struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	Request      handler.AnalyzeRequest `json:"request"`
+	Expect       Expectations           `json:"expect"`
+	MockResponse string                 `json:"mock_response"` // canned model output for -client mock
+}
+
+type Expectations struct {
+	Winner   string `json:"winner"`
+	MaxWords int    `json:"max_words"`
+}
+
+func main() {
+	fixturesDir := flag.String("fixtures", "cmd/evalprompts/fixtures", "directory of *.json fixtures")
+	templatesDir := flag.String("templates", "", "extra prompt templates to load (e.g. a candidate version)")
+	template := flag.String("template", "", "override every fixture's template")
+	version := flag.Int("version", 0, "template version (0 = latest)")
+	clientKind := flag.String("client", "mock", "LLM client: mock, groq or openai")
+	url := flag.String("url", "", "chat completions URL for -client openai")
+	apiKeyEnv := flag.String("api-key-env", "OPENAI_API_KEY", "env var holding the API key for -client openai")
+	model := flag.String("model", "", "override the template's model")
+	out := flag.String("out", "", "write the markdown report here (default stdout)")
+	jsonOut := flag.String("json", "", "also write the report as JSON here")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	if *templatesDir != "" {
+		if err := prompts.Default.LoadDir(*templatesDir); err != nil {
+			log.Fatal("Failed to load prompt templates:", err)
+		}
+	}
+
+	fixtures, err := loadFixtures(*fixturesDir)
+	if err != nil {
+		log.Fatal("Failed to load fixtures:", err)
+	}
+
+	report := Report{Client: *clientKind, Model: *model}
+	for _, fx := range fixtures {
+		if *template != "" {
+			fx.Request.Template = *template
+		}
+		if *version != 0 {
+			fx.Request.TemplateVersion = *version
+		}
+
+		client, err := newClient(*clientKind, *url, os.Getenv(*apiKeyEnv), fx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *model != "" {
+			client = modelOverride{ChatClient: client, model: *model}
+		}
+
+		log.Printf("Evaluating %s...", fx.Name)
+		report.Results = append(report.Results, evaluate(client, fx))
+	}
+
+	if err := writeReport(report, *out, *jsonOut); err != nil {
+		log.Fatal("Failed to write report:", err)
+	}
+	if report.Failed() > 0 {
+		os.Exit(1)
+	}
+}
+
+func loadFixtures(dir string) ([]Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixtures in %s", dir)
+	}
+	sort.Strings(paths)
+
+	var fixtures []Fixture
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fx Fixture
+		if err := json.Unmarshal(content, &fx); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if fx.Name == "" {
+			fx.Name = filepath.Base(path)
+		}
+		fixtures = append(fixtures, fx)
+	}
+	return fixtures, nil
+}
+
+func newClient(kind, url, apiKey string, fx Fixture) (services.ChatClient, error) {
+	switch kind {
+	case "mock":
+		return mockClient{content: fx.MockResponse}, nil
+	case "groq":
+		return services.NewGroqClient(), nil
+	case "openai":
+		if url == "" {
+			return nil, fmt.Errorf("-url is required for -client openai")
+		}
+		return &services.OpenAIClient{URL: url, APIKey: apiKey, HTTP: &http.Client{Timeout: 60 * time.Second}}, nil
+	}
+	return nil, fmt.Errorf("unknown client %q (want mock, groq or openai)", kind)
+}
+
+// mockClient replays a fixture's canned response, for offline runs
+type mockClient struct {
+	content string
+}
+
+func (m mockClient) CreateChatCompletion(req services.GroqRequest) (*services.GroqResponse, error) {
+	if m.content == "" {
+		return nil, fmt.Errorf("fixture has no mock_response")
+	}
+	return &services.GroqResponse{Choices: []services.GroqChoice{
+		{Message: services.GroqMessage{Role: "assistant", Content: m.content}},
+	}}, nil
+}
+
+// modelOverride swaps the template's model, e.g. to evaluate a local model
+type modelOverride struct {
+	services.ChatClient
+	model string
+}
+
+func (m modelOverride) CreateChatCompletion(req services.GroqRequest) (*services.GroqResponse, error) {
+	req.Model = m.model
+	return m.ChatClient.CreateChatCompletion(req)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/guardrails"
+	"github.com/chuma-beep/stock-saas/internal/handler"
+	"github.com/chuma-beep/stock-saas/internal/services"
+)
+
+const defaultMaxWords = 300
+
+// Assertion is one rubric check on one fixture's output
+type Assertion struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Result struct {
+	Fixture    string      `json:"fixture"`
+	Template   string      `json:"template"`
+	Version    int         `json:"template_version"`
+	Error      string      `json:"error,omitempty"`
+	Words      int         `json:"words"`
+	Assertions []Assertion `json:"assertions"`
+	Analysis   string      `json:"analysis"`
+}
+
+func (r Result) Passed() bool {
+	if r.Error != "" {
+		return false
+	}
+	for _, a := range r.Assertions {
+		if !a.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+type Report struct {
+	Client  string   `json:"client"`
+	Model   string   `json:"model,omitempty"`
+	Results []Result `json:"results"`
+}
+
+func (r Report) Failed() int {
+	failed := 0
+	for _, res := range r.Results {
+		if !res.Passed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// evaluate runs one fixture through the analyze pipeline and scores it
+func evaluate(client services.ChatClient, fx Fixture) Result {
+	res := Result{Fixture: fx.Name}
+
+	resp, err := handler.RunAnalysis(client, fx.Request)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Template, res.Version = resp.Template, resp.Version
+	res.Analysis = resp.Analysis
+
+	body := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(resp.Analysis), guardrails.Disclaimer))
+	res.Words = len(strings.Fields(body))
+
+	maxWords := fx.Expect.MaxWords
+	if maxWords == 0 {
+		maxWords = defaultMaxWords
+	}
+
+	var unverified, advice []string
+	for _, f := range resp.Flags {
+		if f.Rule == guardrails.RuleUnknownNumber || f.Rule == guardrails.RuleUnknownDate {
+			unverified = append(unverified, f.Excerpt)
+		} else {
+			advice = append(advice, f.Excerpt)
+		}
+	}
+
+	res.Assertions = []Assertion{
+		check("structured_output", resp.Structured != nil, "model output did not match the JSON schema"),
+		mentionsWinner(resp, fx.Expect.Winner),
+		check("numbers_match_stats", len(unverified) == 0, "unverified: "+strings.Join(unverified, ", ")),
+		check("no_advice", len(advice) == 0, "rewritten: "+strings.Join(advice, " | ")),
+		check("word_limit", res.Words <= maxWords, fmt.Sprintf("%d words > %d", res.Words, maxWords)),
+		check("disclaimer_present", strings.Contains(resp.Analysis, guardrails.Disclaimer), "disclaimer missing"),
+	}
+	return res
+}
+
+func mentionsWinner(resp *handler.AnalyzeResponse, winner string) Assertion {
+	if winner == "" {
+		return Assertion{Name: "mentions_winner", Passed: true, Detail: "no expected winner"}
+	}
+	if resp.Structured != nil {
+		return check("mentions_winner", strings.EqualFold(resp.Structured.Winner, winner),
+			fmt.Sprintf("winner %q, expected %q", resp.Structured.Winner, winner))
+	}
+	return check("mentions_winner", strings.Contains(resp.Analysis, winner), winner+" not mentioned")
+}
+
+func check(name string, passed bool, detail string) Assertion {
+	a := Assertion{Name: name, Passed: passed}
+	if !passed {
+		a.Detail = detail
+	}
+	return a
+}
+
+// writeReport renders a stable markdown report (no timestamps) so two runs
+// can be diffed, plus an optional JSON copy
+func writeReport(r Report, mdPath, jsonPath string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Prompt evaluation\n\n")
+	fmt.Fprintf(&b, "- Client: %s\n", r.Client)
+	if r.Model != "" {
+		fmt.Fprintf(&b, "- Model: %s\n", r.Model)
+	}
+	fmt.Fprintf(&b, "- Passed: %d/%d\n\n", len(r.Results)-r.Failed(), len(r.Results))
+
+	fmt.Fprintf(&b, "| Fixture | Template | Words | Result |\n|---|---|---|---|\n")
+	for _, res := range r.Results {
+		fmt.Fprintf(&b, "| %s | %s v%d | %d | %s |\n", res.Fixture, res.Template, res.Version, res.Words, status(res.Passed()))
+	}
+
+	for _, res := range r.Results {
+		fmt.Fprintf(&b, "\n## %s\n\n", res.Fixture)
+		if res.Error != "" {
+			fmt.Fprintf(&b, "**Error:** %s\n", res.Error)
+			continue
+		}
+		for _, a := range res.Assertions {
+			fmt.Fprintf(&b, "- %s %s", status(a.Passed), a.Name)
+			if a.Detail != "" {
+				fmt.Fprintf(&b, " — %s", a.Detail)
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "\n<details><summary>Output</summary>\n\n%s\n\n</details>\n", res.Analysis)
+	}
+
+	if mdPath == "" {
+		fmt.Print(b.String())
+	} else if err := os.WriteFile(mdPath, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+
+	if jsonPath != "" {
+		out, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(jsonPath, append(out, '\n'), 0o644)
+	}
+	return nil
+}
+
+func status(passed bool) string {
+	if passed {
+		return "✅ PASS"
+	}
+	return "❌ FAIL"
+}
@@ -0,0 +1,121 @@
+// Command importcsv loads daily bars from vendor OHLCV CSV files straight
+// into the database, for backfills too big to upload through POST /import.
+// It takes the same options as the endpoint and exits non-zero if any row
+// was rejected.
+//
+//	go run ./cmd/importcsv data/*.csv
+//	go run ./cmd/importcsv -columns "ticker=Symbol,date=Trade Date" -date-format 01/02/2006 vendor.csv
+//	go run ./cmd/importcsv -ticker BRK.B -delimiter tab -dry-run brkb.tsv
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/alerts"
+	"github.com/chuma-beep/stock-saas/internal/cache"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/importer"
+	"github.com/chuma-beep/stock-saas/internal/notify"
+	"github.com/joho/godotenv"
+)
+
+// dateFormats collects repeated -date-format flags
+type dateFormats []string
+
+func (d *dateFormats) String() string     { return strings.Join(*d, ", ") }
+func (d *dateFormats) Set(v string) error { *d = append(*d, v); return nil }
+
+func main() {
+	var formats dateFormats
+	columns := flag.String("columns", "", "header mapping, e.g. date=Trade Date,close=Adj Close")
+	flag.Var(&formats, "date-format", "Go date layout, repeatable (default 2006-01-02, 2006/01/02, 20060102)")
+	ticker := flag.String("ticker", "", "ticker for files without a ticker column")
+	delimiter := flag.String("delimiter", ",", "field delimiter, one character or tab")
+	dryRun := flag.Bool("dry-run", false, "validate without storing")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("usage: importcsv [flags] file.csv...")
+	}
+
+	mapping, err := importer.ParseColumns(*columns)
+	if err != nil {
+		log.Fatal(err)
+	}
+	comma, err := importer.ParseDelimiter(*delimiter)
+	if err != nil {
+		log.Fatal("-delimiter ", err)
+	}
+	opts := importer.Options{Columns: mapping, DateFormats: formats, Ticker: *ticker, Comma: comma, DryRun: *dryRun}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+	if !*dryRun {
+		if err := database.Connect(); err != nil {
+			log.Fatal("Failed to connect to database:", err)
+		}
+		defer database.Close()
+		// Drops what the API cached for the imported tickers, when they
+		// share a Redis
+		cache.Default = cache.Open()
+		database.OnStocksSaved(alerts.BarsSaved)
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		res, err := importFile(path, opts)
+		if res != nil {
+			report(path, res)
+			failed = failed || res.Failed > 0
+		}
+		if err != nil {
+			log.Printf("❌ %s: %v", path, err)
+			failed = true
+		}
+	}
+	// Alerts fired by the import are evaluated and delivered in the
+	// background; let them finish before exiting
+	alerts.Wait()
+	notify.Default.Wait()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func importFile(path string, opts importer.Options) (*importer.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return importer.Import(f, opts)
+}
+
+func report(path string, res *importer.Result) {
+	verb := "imported"
+	if res.DryRun {
+		verb = "valid"
+	}
+	tickers := make([]string, 0, len(res.Tickers))
+	for t, n := range res.Tickers {
+		tickers = append(tickers, fmt.Sprintf("%s=%d", t, n))
+	}
+	sort.Strings(tickers)
+	fmt.Printf("%s: %d rows, %d %s, %d rejected %s\n", path, res.Rows, res.Imported, verb, res.Failed, strings.Join(tickers, " "))
+	for _, e := range res.Errors {
+		if e.Field != "" {
+			fmt.Printf("  line %d: %s: %s\n", e.Line, e.Field, e.Message)
+		} else {
+			fmt.Printf("  line %d: %s\n", e.Line, e.Message)
+		}
+	}
+	if res.ErrorsTruncated {
+		fmt.Printf("  ... first %d errors shown\n", importer.MaxReportedErrors)
+	}
+}
@@ -0,0 +1,54 @@
+// Command openapi writes the OpenAPI document built from the route table,
+// or with -check fails if the routes and the document disagree or the
+// committed copy is stale. Run the check in CI.
+//
+//	go run ./cmd/openapi
+//	go run ./cmd/openapi -check
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/chuma-beep/stock-saas/internal/api"
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	out := flag.String("out", "docs/openapi.json", "where the document lives")
+	check := flag.Bool("check", false, "verify instead of writing")
+	flag.Parse()
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.Register(router)
+	if err := api.Verify(router); err != nil {
+		log.Fatal(err)
+	}
+
+	doc, err := json.MarshalIndent(api.Spec(), "", "  ")
+	if err != nil {
+		log.Fatal("Failed to encode OpenAPI document:", err)
+	}
+	doc = append(doc, '\n')
+
+	if *check {
+		current, err := os.ReadFile(*out)
+		if err != nil {
+			log.Fatal("Failed to read OpenAPI document:", err)
+		}
+		if !bytes.Equal(current, doc) {
+			log.Fatalf("%s is out of date; run go run ./cmd/openapi", *out)
+		}
+		log.Printf("✅ %d routes match %s", len(router.Routes()), *out)
+		return
+	}
+
+	if err := os.WriteFile(*out, doc, 0o644); err != nil {
+		log.Fatal("Failed to write OpenAPI document:", err)
+	}
+	log.Printf("✅ Wrote %s", *out)
+}
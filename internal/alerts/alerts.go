@@ -0,0 +1,255 @@
+// Package alerts evaluates user alert rules against freshly stored prices.
+package alerts
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/analytics"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/notify"
+)
+
+// Rule kinds
+const (
+	CloseAbove      = "close_above"
+	CloseBelow      = "close_below"
+	DailyMove       = "daily_move"
+	MACross         = "ma_cross"
+	VolatilitySpike = "volatility_spike"
+)
+
+// Kinds lists every supported rule kind
+var Kinds = []string{CloseAbove, CloseBelow, DailyMove, MACross, VolatilitySpike}
+
+const (
+	DefaultMAPeriod         = 50
+	DefaultVolatilityPeriod = 10
+	DefaultCooldownMinutes  = 24 * 60
+	MaxPeriod               = 200
+
+	// baselineMultiple is how many windows of history the volatility spike
+	// rule compares the latest window against
+	baselineMultiple = 3
+)
+
+// Normalize fills kind-specific defaults and validates a rule
+func Normalize(r *database.AlertRule) error {
+	switch r.Kind {
+	case CloseAbove, CloseBelow:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("threshold must be a positive price")
+		}
+		r.Period = 0
+	case DailyMove:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("threshold must be a positive percentage")
+		}
+		r.Period = 0
+	case MACross:
+		if r.Period == 0 {
+			r.Period = DefaultMAPeriod
+		}
+		r.Threshold = 0
+	case VolatilitySpike:
+		if r.Period == 0 {
+			r.Period = DefaultVolatilityPeriod
+		}
+		if r.Threshold <= 1 {
+			return fmt.Errorf("threshold must be a multiple of baseline volatility greater than 1")
+		}
+	default:
+		return fmt.Errorf("kind must be one of close_above, close_below, daily_move, ma_cross, volatility_spike")
+	}
+
+	if r.Period < 0 || r.Period > MaxPeriod {
+		return fmt.Errorf("period must be between 2 and %d", MaxPeriod)
+	}
+	if (r.Kind == MACross || r.Kind == VolatilitySpike) && r.Period < 2 {
+		return fmt.Errorf("period must be between 2 and %d", MaxPeriod)
+	}
+	if r.CooldownMinutes < 0 {
+		return fmt.Errorf("cooldown_minutes must not be negative")
+	}
+	return nil
+}
+
+// barsNeeded is how much history a rule looks at
+func barsNeeded(r database.AlertRule) int {
+	switch r.Kind {
+	case MACross:
+		return r.Period + 1
+	case VolatilitySpike:
+		return r.Period*(baselineMultiple+1) + 1
+	default:
+		return 2
+	}
+}
+
+// Check evaluates one rule against bars (oldest first). It reports whether
+// the rule fires on the latest bar, the observed value and a message.
+func Check(r database.AlertRule, bars []database.Bar) (bool, float64, string) {
+	if len(bars) == 0 {
+		return false, 0, ""
+	}
+	last := bars[len(bars)-1].Close
+
+	switch r.Kind {
+	case CloseAbove:
+		if last > r.Threshold {
+			return true, last, fmt.Sprintf("%s closed at %.2f, above %.2f", r.Ticker, last, r.Threshold)
+		}
+
+	case CloseBelow:
+		if last < r.Threshold {
+			return true, last, fmt.Sprintf("%s closed at %.2f, below %.2f", r.Ticker, last, r.Threshold)
+		}
+
+	case DailyMove:
+		if len(bars) < 2 {
+			return false, 0, ""
+		}
+		move := analytics.PercentChange([]float64{bars[len(bars)-2].Close, last})
+		if math.Abs(move) >= r.Threshold {
+			return true, move, fmt.Sprintf("%s moved %+.2f%% in one day (limit ±%.2f%%)", r.Ticker, move, r.Threshold)
+		}
+
+	case MACross:
+		if len(bars) < r.Period+1 {
+			return false, 0, ""
+		}
+		sma := analytics.SMA(closes(bars), r.Period)
+		prev, prevMA := bars[len(bars)-2].Close, sma[len(sma)-2]
+		curMA := sma[len(sma)-1]
+		if math.IsNaN(prevMA) {
+			return false, 0, ""
+		}
+		switch {
+		case prev <= prevMA && last > curMA:
+			return true, curMA, fmt.Sprintf("%s crossed above its %d-day average (%.2f)", r.Ticker, r.Period, curMA)
+		case prev >= prevMA && last < curMA:
+			return true, curMA, fmt.Sprintf("%s crossed below its %d-day average (%.2f)", r.Ticker, r.Period, curMA)
+		}
+
+	case VolatilitySpike:
+		if len(bars) < barsNeeded(r) {
+			return false, 0, ""
+		}
+		prices := closes(bars)
+		split := len(prices) - r.Period - 1
+		recent := analytics.Volatility(prices[split:])
+		baseline := analytics.Volatility(prices[split-r.Period*baselineMultiple : split+1])
+		if baseline == 0 {
+			return false, 0, ""
+		}
+		if ratio := recent / baseline; ratio >= r.Threshold {
+			return true, recent, fmt.Sprintf("%s %d-day volatility is %.1f%%, %.1fx its baseline", r.Ticker, r.Period, recent, ratio)
+		}
+	}
+	return false, 0, ""
+}
+
+// coolingDown reports whether a rule fired too recently to fire again
+func coolingDown(r database.AlertRule, now time.Time) bool {
+	if r.LastTriggeredAt == nil {
+		return false
+	}
+	return now.Sub(*r.LastTriggeredAt) < time.Duration(r.CooldownMinutes)*time.Minute
+}
+
+// Evaluate checks every active rule on ticker against its stored prices and
+// records the ones that fire. A rule fires at most once per bar and not
+// again until its cooldown has passed.
+func Evaluate(ticker string) ([]database.AlertTrigger, error) {
+	rules, err := database.ActiveAlertRulesForTicker(ticker)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	need := 0
+	for _, r := range rules {
+		need = max(need, barsNeeded(r))
+	}
+	bars, err := database.GetRecentBars(ticker, need)
+	if err != nil {
+		return nil, err
+	}
+	if len(bars) == 0 {
+		return nil, nil
+	}
+	barDate := bars[len(bars)-1].Date.Format("2006-01-02")
+
+	now := time.Now()
+	var fired []database.AlertTrigger
+	for _, r := range rules {
+		if coolingDown(r, now) {
+			continue
+		}
+		window := bars
+		if n := barsNeeded(r); len(window) > n {
+			window = window[len(window)-n:]
+		}
+		ok, value, msg := Check(r, window)
+		if !ok {
+			continue
+		}
+
+		t := database.AlertTrigger{
+			RuleID:  r.ID,
+			UserID:  r.UserID,
+			Ticker:  r.Ticker,
+			Kind:    r.Kind,
+			BarDate: barDate,
+			Value:   value,
+			Message: msg,
+		}
+		recorded, err := database.RecordAlertTrigger(&t)
+		if err != nil {
+			log.Printf("Error recording alert %d: %v", r.ID, err)
+			continue
+		}
+		if recorded {
+			fired = append(fired, t)
+		}
+	}
+	return fired, nil
+}
+
+// pending counts BarsSaved evaluations still running, see Wait
+var pending sync.WaitGroup
+
+// BarsSaved is the database.OnStocksSaved hook. It evaluates the rules on
+// each ticker in the background and notifies the owners of those that fire,
+// so every path that stores bars triggers alerts.
+func BarsSaved(tickers []string) {
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		for _, ticker := range tickers {
+			triggered, err := Evaluate(ticker)
+			if err != nil {
+				log.Printf("Error evaluating alerts for %s: %v", ticker, err)
+			}
+			for _, t := range triggered {
+				notify.Default.Notify(t.UserID, notify.AlertTriggered(t))
+			}
+		}
+	}()
+}
+
+// Wait blocks until the evaluations started by BarsSaved have finished, for
+// commands that exit once their saves are done
+func Wait() {
+	pending.Wait()
+}
+
+func closes(bars []database.Bar) []float64 {
+	out := make([]float64, len(bars))
+	for i, b := range bars {
+		out[i] = b.Close
+	}
+	return out
+}
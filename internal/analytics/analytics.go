@@ -0,0 +1,186 @@
+package analytics
+
+import (
+	"math"
+)
+
+// Returns converts a price series into simple period-over-period returns
+func Returns(prices []float64) []float64 {
+	if len(prices) < 2 {
+		return nil
+	}
+	returns := make([]float64, len(prices)-1)
+	for i := 1; i < len(prices); i++ {
+		returns[i-1] = (prices[i] - prices[i-1]) / prices[i-1]
+	}
+	return returns
+}
+
+// PercentChange from the first to the last price (%)
+func PercentChange(prices []float64) float64 {
+	if len(prices) == 0 || prices[0] == 0 {
+		return 0
+	}
+	first := prices[0]
+	last := prices[len(prices)-1]
+	return ((last - first) / first) * 100
+}
+
+// Correlation is the Pearson correlation of two return series
+func Correlation(returns1, returns2 []float64) float64 {
+	n := len(returns1)
+	if n != len(returns2) || n < 2 {
+		return 0
+	}
+	var sum1, sum2, sum1Sq, sum2Sq, pSum float64
+	for i := 0; i < n; i++ {
+		r1, r2 := returns1[i], returns2[i]
+		sum1 += r1
+		sum2 += r2
+		sum1Sq += r1 * r1
+		sum2Sq += r2 * r2
+		pSum += r1 * r2
+	}
+	num := pSum - (sum1 * sum2 / float64(n))
+	den := math.Sqrt((sum1Sq - math.Pow(sum1, 2)/float64(n)) * (sum2Sq - math.Pow(sum2, 2)/float64(n)))
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// Volatility is the annualized volatility of a price series (%)
+func Volatility(prices []float64) float64 {
+	returns := Returns(prices)
+	if len(returns) < 2 {
+		return 0
+	}
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += math.Pow(r-mean, 2)
+	}
+	variance /= float64(len(returns) - 1)
+	return math.Sqrt(variance) * math.Sqrt(252) * 100
+}
+
+// Drawdown describes the largest peak-to-trough decline in a series
+type Drawdown struct {
+	MaxDrawdown float64 `json:"max_drawdown"` // % below peak, reported as a positive number
+	PeakIndex   int     `json:"peak_index"`
+	TroughIndex int     `json:"trough_index"`
+}
+
+// MaxDrawdown finds the largest peak-to-trough decline (%)
+func MaxDrawdown(prices []float64) Drawdown {
+	var dd Drawdown
+	if len(prices) == 0 {
+		return dd
+	}
+	peak, peakIdx := prices[0], 0
+	for i, p := range prices {
+		if p > peak {
+			peak, peakIdx = p, i
+		}
+		if peak == 0 {
+			continue
+		}
+		if d := (peak - p) / peak * 100; d > dd.MaxDrawdown {
+			dd = Drawdown{MaxDrawdown: d, PeakIndex: peakIdx, TroughIndex: i}
+		}
+	}
+	return dd
+}
+
+// SMA is the simple moving average; the first period-1 values are NaN
+func SMA(prices []float64, period int) []float64 {
+	out := make([]float64, len(prices))
+	sum := 0.0
+	for i, p := range prices {
+		sum += p
+		if i >= period {
+			sum -= prices[i-period]
+		}
+		if period <= 0 || i < period-1 {
+			out[i] = math.NaN()
+			continue
+		}
+		out[i] = sum / float64(period)
+	}
+	return out
+}
+
+// EMA is the exponential moving average seeded with the first SMA
+func EMA(prices []float64, period int) []float64 {
+	out := make([]float64, len(prices))
+	if period <= 0 {
+		for i := range out {
+			out[i] = math.NaN()
+		}
+		return out
+	}
+	k := 2.0 / float64(period+1)
+	sum := 0.0
+	for i, p := range prices {
+		switch {
+		case i < period-1:
+			sum += p
+			out[i] = math.NaN()
+		case i == period-1:
+			sum += p
+			out[i] = sum / float64(period)
+		default:
+			out[i] = p*k + out[i-1]*(1-k)
+		}
+	}
+	return out
+}
+
+// RSI is Wilder's relative strength index; the first period values are NaN
+func RSI(prices []float64, period int) []float64 {
+	out := make([]float64, len(prices))
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	if period <= 0 || len(prices) <= period {
+		return out
+	}
+
+	var gain, loss float64
+	for i := 1; i <= period; i++ {
+		change := prices[i] - prices[i-1]
+		if change > 0 {
+			gain += change
+		} else {
+			loss -= change
+		}
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+	out[period] = rsiValue(gain, loss)
+
+	for i := period + 1; i < len(prices); i++ {
+		change := prices[i] - prices[i-1]
+		g, l := 0.0, 0.0
+		if change > 0 {
+			g = change
+		} else {
+			l = -change
+		}
+		gain = (gain*float64(period-1) + g) / float64(period)
+		loss = (loss*float64(period-1) + l) / float64(period)
+		out[i] = rsiValue(gain, loss)
+	}
+	return out
+}
+
+func rsiValue(gain, loss float64) float64 {
+	if loss == 0 {
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
@@ -0,0 +1,117 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+)
+
+// Indicators that can be computed one price at a time
+const (
+	IndicatorSMA = "sma"
+	IndicatorEMA = "ema"
+	IndicatorRSI = "rsi"
+)
+
+// StreamIndicators lists the indicators NewStream accepts
+var StreamIndicators = []string{IndicatorSMA, IndicatorEMA, IndicatorRSI}
+
+// Stream computes an indicator one price at a time, so a series can be read
+// from a database cursor without holding it in memory. Next returns NaN
+// until the indicator has seen enough prices, matching SMA, EMA and RSI.
+type Stream interface {
+	Next(price float64) float64
+}
+
+// NewStream returns a Stream for one of StreamIndicators
+func NewStream(indicator string, period int) (Stream, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("period must be positive")
+	}
+	switch indicator {
+	case IndicatorSMA:
+		return &smaStream{window: make([]float64, period)}, nil
+	case IndicatorEMA:
+		return &emaStream{period: period, k: 2.0 / float64(period+1)}, nil
+	case IndicatorRSI:
+		return &rsiStream{period: period}, nil
+	}
+	return nil, fmt.Errorf("unsupported indicator %q", indicator)
+}
+
+type smaStream struct {
+	window []float64 // ring buffer of the last period prices
+	n      int
+	sum    float64
+}
+
+func (s *smaStream) Next(price float64) float64 {
+	i := s.n % len(s.window)
+	s.sum += price - s.window[i]
+	s.window[i] = price
+	s.n++
+	if s.n < len(s.window) {
+		return math.NaN()
+	}
+	return s.sum / float64(len(s.window))
+}
+
+type emaStream struct {
+	period int
+	k      float64
+	n      int
+	sum    float64
+	last   float64
+}
+
+func (s *emaStream) Next(price float64) float64 {
+	s.n++
+	switch {
+	case s.n < s.period:
+		s.sum += price
+		return math.NaN()
+	case s.n == s.period:
+		s.last = (s.sum + price) / float64(s.period)
+	default:
+		s.last = price*s.k + s.last*(1-s.k)
+	}
+	return s.last
+}
+
+type rsiStream struct {
+	period     int
+	n          int
+	prev       float64
+	gain, loss float64
+}
+
+func (s *rsiStream) Next(price float64) float64 {
+	s.n++
+	if s.n == 1 {
+		s.prev = price
+		return math.NaN()
+	}
+	change := price - s.prev
+	s.prev = price
+	g, l := 0.0, 0.0
+	if change > 0 {
+		g = change
+	} else {
+		l = -change
+	}
+
+	p := float64(s.period)
+	if s.n <= s.period+1 {
+		// Seed with the plain average of the first period changes
+		s.gain += g
+		s.loss += l
+		if s.n <= s.period {
+			return math.NaN()
+		}
+		s.gain /= p
+		s.loss /= p
+		return rsiValue(s.gain, s.loss)
+	}
+	s.gain = (s.gain*(p-1) + g) / p
+	s.loss = (s.loss*(p-1) + l) / p
+	return rsiValue(s.gain, s.loss)
+}
@@ -0,0 +1,463 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/chuma-beep/stock-saas/internal/alerts"
+	"github.com/chuma-beep/stock-saas/internal/authz"
+	"github.com/chuma-beep/stock-saas/internal/export"
+	"github.com/chuma-beep/stock-saas/internal/notify"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the API version reported in the OpenAPI document
+const Version = "1.0.0"
+
+// Document is the subset of OpenAPI 3.0 this API needs
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Servers    []Server                         `json:"servers"`
+	Tags       []Tag                            `json:"tags"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+type Operation struct {
+	OperationID string                 `json:"operationId"`
+	Tags        []string               `json:"tags"`
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]Response    `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Schema builders for request bodies
+
+type schemaField struct {
+	name     string
+	schema   *Schema
+	required bool
+}
+
+func field(name string, s *Schema) schemaField { return schemaField{name: name, schema: s} }
+func must(name string, s *Schema) schemaField {
+	return schemaField{name: name, schema: s, required: true}
+}
+
+func obj(fields ...schemaField) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, f := range fields {
+		s.Properties[f.name] = f.schema
+		if f.required {
+			s.Required = append(s.Required, f.name)
+		}
+	}
+	return s
+}
+
+func str(description string) *Schema     { return &Schema{Type: "string", Description: description} }
+func integer(description string) *Schema { return &Schema{Type: "integer", Description: description} }
+func number(description string) *Schema  { return &Schema{Type: "number", Description: description} }
+func boolean(description string) *Schema { return &Schema{Type: "boolean", Description: description} }
+func object(description string) *Schema  { return &Schema{Type: "object", Description: description} }
+func array(items *Schema) *Schema        { return &Schema{Type: "array", Items: items} }
+
+func enum(description string, values ...string) *Schema {
+	return &Schema{Type: "string", Description: description, Enum: values}
+}
+
+var (
+	watchlistItem = obj(must("symbol", str("")), field("notes", str("")))
+
+	comparisonBody = obj(
+		must("tickers", array(str(""))),
+		must("start_date", str("YYYY-MM-DD")),
+		must("end_date", str("YYYY-MM-DD")),
+		field("title", str("")),
+		field("preset", str("")),
+		field("template", str("")),
+		field("normalization", enum("", "none", "percent", "index")),
+		field("visibility", enum("", "private", "public")),
+		field("org_id", integer("Share with this organization")),
+	)
+
+	alertBody = obj(
+		must("ticker", str("")),
+		must("kind", enum("", alerts.Kinds...)),
+		field("threshold", number("Price, percent or multiple, depending on kind")),
+		field("period", integer("Moving average or volatility window")),
+		field("cooldown_minutes", integer("")),
+		field("active", boolean("")),
+	)
+
+	channelBody = obj(
+		must("kind", enum("", notify.KindEmail, notify.KindWebhook)),
+		must("target", str("Email address or http(s) URL")),
+		field("events", array(enum("", notify.Events...))),
+		field("enabled", boolean("")),
+	)
+
+	roleSchema = enum("", authz.RoleOwner, authz.RoleAdmin, authz.RoleAnalyst, authz.RoleViewer)
+)
+
+var (
+	specOnce sync.Once
+	spec     *Document
+)
+
+// ServeSpec serves the OpenAPI document
+func ServeSpec(c *gin.Context) {
+	specOnce.Do(func() { spec = Spec() })
+	c.JSON(http.StatusOK, spec)
+}
+
+// problemSchema describes problem.Body, the RFC 7807 error every endpoint uses
+func problemSchema() *Schema {
+	codes := make([]string, len(problem.Codes))
+	for i, c := range problem.Codes {
+		codes[i] = c.Code
+	}
+	return obj(
+		must("type", str("Link to the code's documentation")),
+		must("title", str("HTTP status text")),
+		must("status", integer("")),
+		must("detail", str("Same as message")),
+		field("instance", str("Request path")),
+		must("code", enum("Stable, machine-readable error code", codes...)),
+		must("message", str("Human-readable explanation")),
+		field("details", object("Code-specific context, e.g. the plan or offending field")),
+		must("retryable", boolean("Whether repeating the request may succeed; honour Retry-After")),
+		field("request_id", str("Echo of X-Request-ID, quote it when reporting problems")),
+	)
+}
+
+// Spec builds the OpenAPI document from the route table
+func Spec() *Document {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   "Stock SaaS API",
+			Version: Version,
+			Description: "Stock data, comparisons and AI analysis. Unversioned paths from before " +
+				"/api/v1 still work but answer with Deprecation and Link headers.",
+		},
+		Servers: []Server{{URL: Prefix}},
+		Paths:   map[string]map[string]*Operation{},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"Problem": problemSchema(),
+			},
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"apiKey":     {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			},
+		},
+	}
+
+	seenTags := map[string]bool{}
+	seenIDs := map[string]bool{}
+	for _, r := range Routes() {
+		if !seenTags[r.Doc.Tag] {
+			seenTags[r.Doc.Tag] = true
+			doc.Tags = append(doc.Tags, Tag{Name: r.Doc.Tag})
+		}
+
+		op := operation(r)
+		if seenIDs[op.OperationID] {
+			params := pathParams(r.Path)
+			op.OperationID += "By" + upperFirst(params[len(params)-1])
+		}
+		seenIDs[op.OperationID] = true
+
+		path := OpenAPIPath(r.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*Operation{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	return doc
+}
+
+func operation(r Route) *Operation {
+	d := r.Doc
+	op := &Operation{
+		OperationID: handlerName(r.Handlers[len(r.Handlers)-1]),
+		Tags:        []string{d.Tag},
+		Summary:     d.Summary,
+		Description: d.Description,
+		Responses:   map[string]Response{},
+	}
+
+	for _, name := range pathParams(r.Path) {
+		op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: paramType(name)}})
+	}
+	for _, p := range d.Query {
+		op.Parameters = append(op.Parameters, Parameter{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: &Schema{Type: p.Type}})
+	}
+	if d.Export {
+		op.Parameters = append(op.Parameters, Parameter{Name: "format", In: "query",
+			Description: "Stream a download instead: " + strings.Join(export.Formats, ", "),
+			Schema:      &Schema{Type: "string", Enum: export.Formats}})
+	}
+	if d.Conditional {
+		op.Parameters = append(op.Parameters,
+			Parameter{Name: "If-None-Match", In: "header", Description: "ETag of a cached copy", Schema: &Schema{Type: "string"}},
+			Parameter{Name: "If-Modified-Since", In: "header", Description: "Last-Modified of a cached copy", Schema: &Schema{Type: "string"}})
+	}
+	if d.Upload {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"text/csv":            {Schema: &Schema{Type: "string"}},
+			"multipart/form-data": {Schema: obj(must("file", &Schema{Type: "string", Format: "binary"}))},
+		}}
+	}
+	if d.Body != nil {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: d.Body}}}
+	}
+
+	status := d.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if d.WebSocket {
+		op.Responses[strconv.Itoa(http.StatusSwitchingProtocols)] = Response{Description: "Upgraded to a WebSocket"}
+	} else {
+		op.Responses[strconv.Itoa(status)] = Response{
+			Description: http.StatusText(status),
+			Content:     map[string]MediaType{"application/json": {Schema: &Schema{Type: "object"}}},
+		}
+	}
+	if d.Conditional {
+		op.Responses[strconv.Itoa(http.StatusNotModified)] = Response{Description: "The cached copy is current"}
+	}
+	if d.Export {
+		for _, f := range export.Formats {
+			if ct := strings.Split(export.ContentType(f), ";")[0]; ct != "application/json" {
+				op.Responses[strconv.Itoa(status)].Content[ct] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+			}
+		}
+	}
+	addError := func(code int) {
+		op.Responses[strconv.Itoa(code)] = Response{
+			Description: http.StatusText(code),
+			Content:     map[string]MediaType{problem.ContentType: {Schema: &Schema{Ref: "#/components/schemas/Problem"}}},
+		}
+	}
+	if d.Body != nil || d.Upload || len(d.Query) > 0 || len(op.Parameters) > 0 {
+		addError(http.StatusBadRequest)
+	}
+	if d.Access == RequireAuth || d.Access == AdminOnly || d.Access == SessionOnly {
+		addError(http.StatusUnauthorized)
+	}
+	if d.Access == AdminOnly || d.Access == SessionOnly {
+		addError(http.StatusForbidden)
+	}
+	if len(pathParams(r.Path)) > 0 {
+		addError(http.StatusNotFound)
+	}
+	if d.Upload {
+		addError(http.StatusRequestEntityTooLarge)
+	}
+	if d.Upstream || d.WebSocket {
+		addError(http.StatusServiceUnavailable)
+	}
+	if d.Upstream {
+		addError(http.StatusTooManyRequests)
+	}
+	addError(http.StatusInternalServerError)
+
+	authed := []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}}
+	switch d.Access {
+	case Public:
+		op.Security = &[]map[string][]string{}
+	case OptionalAuth:
+		optional := append(authed, map[string][]string{})
+		op.Security = &optional
+	case SessionOnly:
+		op.Security = &[]map[string][]string{{"bearerAuth": {}}}
+	default:
+		op.Security = &authed
+	}
+	return op
+}
+
+// OpenAPIPath turns a gin path (/orgs/:id) into an OpenAPI one (/orgs/{id})
+func OpenAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func pathParams(path string) []string {
+	var params []string
+	for _, p := range strings.Split(path, "/") {
+		if strings.HasPrefix(p, ":") {
+			params = append(params, p[1:])
+		}
+	}
+	return params
+}
+
+// paramType guesses from the name: IDs are integers, the rest strings
+func paramType(name string) string {
+	if name == "id" || strings.HasSuffix(name, "ID") {
+		return "integer"
+	}
+	return "string"
+}
+
+// handlerName is the function's name without its package, e.g. GetStock
+func handlerName(h gin.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// Verify checks that the router serves exactly the mounted routes in the
+// table, under Prefix and at their legacy paths, and that the spec documents
+// all of them. Routes registered outside the table are reported too.
+func Verify(router *gin.Engine) error {
+	want := map[string]bool{"GET /health": true}
+	disabled := map[string]bool{}
+	for _, r := range Routes() {
+		if !r.mounted() {
+			disabled[r.Method+" "+Prefix+r.Path] = true
+			continue
+		}
+		want[r.Method+" "+Prefix+r.Path] = true
+		if r.Legacy != "" {
+			want[r.Method+" "+r.Legacy] = true
+		}
+	}
+
+	served := map[string]bool{}
+	for _, ri := range router.Routes() {
+		served[ri.Method+" "+ri.Path] = true
+	}
+
+	documented := map[string]bool{}
+	for path, ops := range Spec().Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+Prefix+path] = true
+		}
+	}
+
+	var problems []string
+	for route := range served {
+		if !want[route] {
+			problems = append(problems, route+" is served but not in the route table")
+		}
+		method, path, _ := strings.Cut(route, " ")
+		if strings.HasPrefix(path, Prefix+"/") && !documented[method+" "+OpenAPIPath(path)] {
+			problems = append(problems, route+" is served but not in the OpenAPI document")
+		}
+	}
+	for route := range want {
+		if !served[route] {
+			problems = append(problems, route+" is in the route table but not served")
+		}
+	}
+	for route := range documented {
+		method, path, _ := strings.Cut(route, " ")
+		if !served[method+" "+ginPath(path)] && !disabled[method+" "+ginPath(path)] {
+			problems = append(problems, route+" is documented but not served")
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("routes and OpenAPI document disagree:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// ginPath is the inverse of OpenAPIPath
+func ginPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			parts[i] = ":" + p[1:len(p)-1]
+		}
+	}
+	return strings.Join(parts, "/")
+}
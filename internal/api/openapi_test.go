@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/gin-gonic/gin"
+)
+
+// committedSpec is the document served at /openapi.json and checked in
+const committedSpec = "../../docs/openapi.json"
+
+// withProvider sets billing.Current for the rest of the test
+func withProvider(t *testing.T, p billing.Provider) {
+	prev := billing.Current
+	billing.Current = p
+	t.Cleanup(func() { billing.Current = prev })
+}
+
+func newRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	Register(router)
+	return router
+}
+
+// TestRoutesMatchCommittedSpec compares what the router serves under Prefix
+// with the paths in docs/openapi.json, in both directions. The fake billing
+// provider mounts every route.
+func TestRoutesMatchCommittedSpec(t *testing.T) {
+	withProvider(t, billing.NewFakeProvider(""))
+	data, err := os.ReadFile(committedSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("decoding %s: %v", committedSpec, err)
+	}
+
+	documented := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	served := map[string]bool{}
+	for _, ri := range newRouter().Routes() {
+		if path, ok := strings.CutPrefix(ri.Path, Prefix); ok {
+			served[ri.Method+" "+OpenAPIPath(path)] = true
+		}
+	}
+
+	var missing []string
+	for route := range served {
+		if !documented[route] {
+			missing = append(missing, route+" is served but not in "+committedSpec)
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			missing = append(missing, route+" is in "+committedSpec+" but not served")
+		}
+	}
+	sort.Strings(missing)
+	for _, m := range missing {
+		t.Error(m)
+	}
+	if len(missing) > 0 {
+		t.Log("run go run ./cmd/openapi to regenerate the document")
+	}
+}
+
+func TestCommittedSpecIsCurrent(t *testing.T) {
+	current, err := os.ReadFile(committedSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.MarshalIndent(Spec(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current, append(want, '\n')) {
+		t.Errorf("%s is out of date; run go run ./cmd/openapi", committedSpec)
+	}
+}
+
+func TestFakeBillingRoutesNeedFakeProvider(t *testing.T) {
+	for _, fake := range []bool{false, true} {
+		var p billing.Provider
+		if fake {
+			p = billing.NewFakeProvider("")
+		}
+		withProvider(t, p)
+		router := newRouter()
+		served := false
+		for _, ri := range router.Routes() {
+			if strings.Contains(ri.Path, "/billing/fake/") {
+				served = true
+			}
+		}
+		if served != fake {
+			t.Errorf("fake provider %v: /billing/fake routes served = %v", fake, served)
+		}
+		if err := Verify(router); err != nil {
+			t.Errorf("fake provider %v: %v", fake, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	if err := Verify(newRouter()); err != nil {
+		t.Error(err)
+	}
+
+	router := newRouter()
+	router.GET(Prefix+"/unlisted", Health)
+	if err := Verify(router); err == nil || !strings.Contains(err.Error(), "GET "+Prefix+"/unlisted is served but not in the route table") {
+		t.Errorf("Verify() = %v, want the unlisted route reported", err)
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct{ gin, openapi string }{
+		{"/stock", "/stock"},
+		{"/fetch/:ticker", "/fetch/{ticker}"},
+		{"/orgs/:id/members/:user_id", "/orgs/{id}/members/{user_id}"},
+	}
+	for _, tt := range tests {
+		if got := OpenAPIPath(tt.gin); got != tt.openapi {
+			t.Errorf("OpenAPIPath(%q) = %q, want %q", tt.gin, got, tt.openapi)
+		}
+		if got := ginPath(tt.openapi); got != tt.gin {
+			t.Errorf("ginPath(%q) = %q, want %q", tt.openapi, got, tt.gin)
+		}
+	}
+}
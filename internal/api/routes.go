@@ -0,0 +1,546 @@
+// Package api is the HTTP surface: every route is declared once in Routes,
+// which both registers it under /api/v1 and describes it in the OpenAPI
+// document, so the two can't drift.
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/authz"
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/gql"
+	"github.com/chuma-beep/stock-saas/internal/handler"
+	"github.com/chuma-beep/stock-saas/internal/handlers"
+	"github.com/chuma-beep/stock-saas/internal/spam"
+	"github.com/gin-gonic/gin"
+)
+
+// Prefix is where the current API version is mounted
+const Prefix = "/api/v1"
+
+// Access is who may call a route. It picks the auth middleware and the
+// security requirement in the spec.
+type Access int
+
+const (
+	Public Access = iota
+	OptionalAuth
+	RequireAuth
+	AdminOnly
+	SessionOnly // logged in with a bearer token; API keys are refused
+)
+
+// Route is one endpoint. Path is relative to Prefix. Legacy is the
+// unversioned path it used to live at, still served with deprecation
+// headers; new routes leave it empty. Audit, when set, runs before the
+// access checks so refused calls are recorded too. Enabled, when set,
+// decides at Register time whether the route is mounted at all; the
+// document lists it either way.
+type Route struct {
+	Method   string
+	Path     string
+	Legacy   string
+	Doc      Doc
+	Audit    gin.HandlerFunc
+	Handlers []gin.HandlerFunc
+	Enabled  func() bool
+}
+
+// mounted reports whether Register serves r
+func (r Route) mounted() bool {
+	return r.Enabled == nil || r.Enabled()
+}
+
+// Doc describes a route for the OpenAPI document
+type Doc struct {
+	Tag         string
+	Summary     string
+	Description string
+	Access      Access
+	Query       []Param
+	Body        *Schema
+	Status      int  // success status, 200 if zero
+	Upstream    bool // calls a data or AI provider, so may answer 429 or 503
+	Export      bool // takes ?format= and can answer with a file download
+	Upload      bool // body is a CSV file, raw or as the "file" field of a form
+	WebSocket   bool // upgrades to a WebSocket; only the handshake is described
+	Conditional bool // sends ETag and Last-Modified and may answer 304
+}
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+func query(name, typ, description string) Param {
+	return Param{Name: name, Type: typ, Description: description}
+}
+
+func requiredQuery(name, typ, description string) Param {
+	return Param{Name: name, Type: typ, Description: description, Required: true}
+}
+
+func chain(h ...gin.HandlerFunc) []gin.HandlerFunc { return h }
+
+// Routes returns the route table. It is built on each call because some
+// middleware reads its configuration from the environment.
+func Routes() []Route {
+	tickerParams := []Param{
+		requiredQuery("ticker", "string", "Ticker symbol, e.g. AAPL or BRK.B (BRK-B and BRK/B are accepted)"),
+		requiredQuery("start", "string", "Start date, YYYY-MM-DD"),
+		requiredQuery("end", "string", "End date, YYYY-MM-DD, at most ten years after start"),
+	}
+	feedbackLimit := spam.LimitByIP("feedback", spam.FeedbackPerHour(), time.Hour)
+
+	return []Route{
+		// Meta
+		{Method: http.MethodGet, Path: "/openapi.json",
+			Doc:      Doc{Tag: "Meta", Summary: "This OpenAPI document"},
+			Handlers: chain(ServeSpec)},
+
+		// Stocks
+		{Method: http.MethodGet, Path: "/fetch/:ticker", Legacy: "/fetch/:ticker",
+			Doc: Doc{Tag: "Stocks", Summary: "Fetch daily bars from Alpha Vantage and store them",
+				Description: "Evaluates price alerts for the ticker. API keys are limited to 25 calls a day.",
+				Access:      RequireAuth, Upstream: true},
+			Audit:    audit.Log("stock.fetch", "stock"),
+			Handlers: chain(auth.Quota("fetch"), handlers.FetchAndStoreStock)},
+		{Method: http.MethodPost, Path: "/import",
+			Doc: Doc{Tag: "Stocks", Summary: "Import daily bars from an OHLCV CSV file", Access: AdminOnly,
+				Description: "Valid rows are upserted like fetched data; bad rows are reported by line. Uploads are capped at 64 MB.",
+				Query: []Param{
+					query("columns", "string", "Header mapping, e.g. date=Trade Date,close=Adj Close"),
+					query("date_format", "string", "Go date layout, repeatable; default 2006-01-02, 2006/01/02, 20060102"),
+					query("ticker", "string", "Ticker for files without a ticker column"),
+					query("delimiter", "string", "Field delimiter, one character or tab; default comma"),
+					query("dry_run", "boolean", "Validate without storing"),
+				},
+				Upload: true},
+			Audit:    audit.Log("stock.import", "stock"),
+			Handlers: chain(handlers.ImportStock)},
+		{Method: http.MethodGet, Path: "/stock", Legacy: "/stock",
+			Doc: Doc{Tag: "Stocks", Summary: "Stored daily bars for one ticker", Access: OptionalAuth,
+				Query: tickerParams, Export: true, Conditional: true},
+			Handlers: chain(billing.LimitHistory(), handlers.GetStock)},
+		{Method: http.MethodGet, Path: "/compare", Legacy: "/compare",
+			Doc: Doc{Tag: "Stocks", Summary: "Compare two tickers over a date range", Access: OptionalAuth,
+				Query: []Param{
+					requiredQuery("ticker1", "string", "First ticker"),
+					requiredQuery("ticker2", "string", "Second ticker"),
+					requiredQuery("start", "string", "Start date, YYYY-MM-DD"),
+					requiredQuery("end", "string", "End date, YYYY-MM-DD"),
+				}, Export: true, Conditional: true},
+			Handlers: chain(billing.LimitHistory(), handlers.CompareStocks)},
+		{Method: http.MethodGet, Path: "/indicators/:indicator",
+			Doc: Doc{Tag: "Stocks", Summary: "SMA, EMA or RSI over stored closes", Access: OptionalAuth,
+				Description: "indicator is sma, ema or rsi. Dates before the indicator has enough history are left out.",
+				Query:       append(tickerParams, query("period", "integer", "Look-back period, 1-200, default 14")),
+				Export:      true},
+			Handlers: chain(billing.LimitHistory(), handlers.GetIndicator)},
+		{Method: http.MethodGet, Path: "/current-prices", Legacy: "/current-prices",
+			Doc: Doc{Tag: "Stocks", Summary: "Latest stored price and daily change", Access: OptionalAuth,
+				Query: []Param{
+					query("tickers", "string", "Comma-separated tickers"),
+					query("watchlist", "integer", "Use a watchlist's symbols instead (auth)"),
+				}},
+			Handlers: chain(handlers.GetCurrentPrices)},
+		{Method: http.MethodGet, Path: "/live",
+			Doc: Doc{Tag: "Stocks", Summary: "WebSocket stream of price updates", Access: OptionalAuth,
+				Description: "Pushes a price message when a followed ticker gets a new stored bar or a provider tick. " +
+					"Send {\"action\":\"subscribe\",\"tickers\":[\"AAPL\"]} (or \"watchlist\": id), unsubscribe or ping. " +
+					"Browsers may pass the access token as ?access_token= and must connect from an allowed origin.",
+				Query: []Param{
+					query("tickers", "string", "Comma-separated tickers to follow on connect, at most 50"),
+					query("access_token", "string", "Bearer token, for clients that can't set headers"),
+				},
+				WebSocket: true},
+			Handlers: chain(handlers.LivePrices)},
+
+		{Method: http.MethodPost, Path: "/graphql",
+			Doc: Doc{Tag: "Stocks", Summary: "GraphQL query over tickers, bars, stats, indicators and saved analyses", Access: OptionalAuth,
+				Description: "Batches lookups, so a list of N tickers costs one query per field, not N. Errors carry extensions.code from the error codes. " +
+					"The schema is in internal/gql/schema.graphql and available by introspection.",
+				Body: obj(
+					must("query", str("GraphQL query")),
+					field("operationName", str("Operation to run when query has several")),
+					field("variables", object("Variable values")),
+				)},
+			Handlers: chain(gql.Handler)},
+
+		// Analysis
+		{Method: http.MethodPost, Path: "/analyze", Legacy: "/api/analyze",
+			Doc: Doc{Tag: "Analysis", Summary: "AI analysis of a comparison", Access: OptionalAuth,
+				Body: obj(
+					must("comparison", object("A /compare response")),
+					field("preset", str("Analysis preset")),
+					field("template", str("Prompt template name, default if empty")),
+					field("template_version", integer("Template version, 0 for the latest")),
+					field("params", object("Overrides for the template's params")),
+				), Upstream: true},
+			Handlers: chain(auth.Quota("analyze"), billing.LimitAnalyses(), handler.AnalyzeComparison)},
+		{Method: http.MethodPost, Path: "/ask", Legacy: "/api/ask",
+			Doc: Doc{Tag: "Analysis", Summary: "Answer a question from stored data with tool calling", Access: OptionalAuth,
+				Body: obj(
+					must("question", str("")),
+					field("max_steps", integer("Tool-calling rounds, capped at the server default")),
+				), Upstream: true},
+			Handlers: chain(auth.Quota("analyze"), billing.LimitAnalyses(), handler.AskQuestion)},
+		{Method: http.MethodGet, Path: "/prompts", Legacy: "/api/prompts",
+			Doc:      Doc{Tag: "Analysis", Summary: "Available prompt templates"},
+			Handlers: chain(handler.ListPromptTemplates)},
+
+		// Auth
+		{Method: http.MethodPost, Path: "/auth/signup", Legacy: "/auth/signup",
+			Doc: Doc{Tag: "Auth", Summary: "Create an account", Status: http.StatusCreated,
+				Body: obj(must("email", str("")), must("password", str("8 characters to 72 bytes")))},
+			Handlers: chain(handler.Signup)},
+		{Method: http.MethodPost, Path: "/auth/login", Legacy: "/auth/login",
+			Doc: Doc{Tag: "Auth", Summary: "Log in",
+				Body: obj(must("email", str("")), must("password", str("")))},
+			Handlers: chain(handler.Login)},
+		{Method: http.MethodPost, Path: "/auth/refresh", Legacy: "/auth/refresh",
+			Doc: Doc{Tag: "Auth", Summary: "Exchange a refresh token for a new token pair",
+				Body: obj(must("refresh_token", str("")))},
+			Handlers: chain(handler.RefreshToken)},
+		{Method: http.MethodGet, Path: "/auth/me", Legacy: "/auth/me",
+			Doc:      Doc{Tag: "Auth", Summary: "The current user", Access: RequireAuth},
+			Handlers: chain(handler.Me)},
+
+		// API keys
+		{Method: http.MethodPost, Path: "/api-keys", Legacy: "/api-keys",
+			Doc: Doc{Tag: "API Keys", Summary: "Create an API key; the full key is only returned here",
+				Access: SessionOnly, Status: http.StatusCreated,
+				Body: obj(must("name", str("")))},
+			Audit:    audit.Log("api_key.create", "api_key"),
+			Handlers: chain(handler.CreateAPIKey)},
+		{Method: http.MethodGet, Path: "/api-keys", Legacy: "/api-keys",
+			Doc:      Doc{Tag: "API Keys", Summary: "Your API keys and their daily quotas", Access: RequireAuth},
+			Handlers: chain(handler.ListAPIKeys)},
+		{Method: http.MethodDelete, Path: "/api-keys/:id", Legacy: "/api-keys/:id",
+			Doc:      Doc{Tag: "API Keys", Summary: "Revoke an API key", Access: SessionOnly},
+			Audit:    audit.Log("api_key.revoke", "api_key"),
+			Handlers: chain(handler.RevokeAPIKey)},
+		{Method: http.MethodGet, Path: "/api-keys/:id/usage", Legacy: "/api-keys/:id/usage",
+			Doc: Doc{Tag: "API Keys", Summary: "Daily request counts per route", Access: RequireAuth,
+				Query: []Param{query("days", "integer", "Days of history, default 30")}},
+			Handlers: chain(handler.GetAPIKeyUsage)},
+
+		// Watchlists
+		{Method: http.MethodGet, Path: "/watchlists", Legacy: "/watchlists",
+			Doc:      Doc{Tag: "Watchlists", Summary: "Your watchlists and your organizations'", Access: RequireAuth},
+			Handlers: chain(handler.ListWatchlists)},
+		{Method: http.MethodPost, Path: "/watchlists", Legacy: "/watchlists",
+			Doc: Doc{Tag: "Watchlists", Summary: "Create a watchlist", Access: RequireAuth, Status: http.StatusCreated,
+				Body: obj(
+					must("name", str("")),
+					field("org_id", integer("Share with this organization")),
+					field("items", array(watchlistItem)),
+				)},
+			Audit:    audit.Log("watchlist.create", "watchlist"),
+			Handlers: chain(handler.CreateWatchlist)},
+		{Method: http.MethodGet, Path: "/watchlists/:id", Legacy: "/watchlists/:id",
+			Doc:      Doc{Tag: "Watchlists", Summary: "One watchlist with its items", Access: RequireAuth},
+			Handlers: chain(handler.GetWatchlist)},
+		{Method: http.MethodPut, Path: "/watchlists/:id", Legacy: "/watchlists/:id",
+			Doc: Doc{Tag: "Watchlists", Summary: "Rename a watchlist", Access: RequireAuth,
+				Body: obj(must("name", str("")))},
+			Audit:    audit.Log("watchlist.rename", "watchlist"),
+			Handlers: chain(handler.RenameWatchlist)},
+		{Method: http.MethodDelete, Path: "/watchlists/:id", Legacy: "/watchlists/:id",
+			Doc:      Doc{Tag: "Watchlists", Summary: "Delete a watchlist", Access: RequireAuth},
+			Audit:    audit.Log("watchlist.delete", "watchlist"),
+			Handlers: chain(handler.DeleteWatchlist)},
+		{Method: http.MethodPut, Path: "/watchlists/:id/items", Legacy: "/watchlists/:id/items",
+			Doc: Doc{Tag: "Watchlists", Summary: "Replace all items", Access: RequireAuth,
+				Body: obj(must("items", array(watchlistItem)))},
+			Audit:    audit.Log("watchlist.replace_items", "watchlist"),
+			Handlers: chain(handler.ReplaceWatchlistItems)},
+		{Method: http.MethodPost, Path: "/watchlists/:id/items", Legacy: "/watchlists/:id/items",
+			Doc: Doc{Tag: "Watchlists", Summary: "Add or update an item", Access: RequireAuth,
+				Body: watchlistItem},
+			Audit:    audit.Log("watchlist.add_item", "watchlist"),
+			Handlers: chain(handler.AddWatchlistItem)},
+		{Method: http.MethodPut, Path: "/watchlists/:id/items/:symbol", Legacy: "/watchlists/:id/items/:symbol",
+			Doc: Doc{Tag: "Watchlists", Summary: "Add or update an item by symbol", Access: RequireAuth,
+				Body: obj(field("notes", str("")))},
+			Audit:    audit.Log("watchlist.add_item", "watchlist"),
+			Handlers: chain(handler.AddWatchlistItem)},
+		{Method: http.MethodDelete, Path: "/watchlists/:id/items/:symbol", Legacy: "/watchlists/:id/items/:symbol",
+			Doc:      Doc{Tag: "Watchlists", Summary: "Remove an item", Access: RequireAuth},
+			Audit:    audit.Log("watchlist.remove_item", "watchlist"),
+			Handlers: chain(handler.DeleteWatchlistItem)},
+
+		// Saved comparisons
+		{Method: http.MethodGet, Path: "/comparisons", Legacy: "/comparisons",
+			Doc:      Doc{Tag: "Comparisons", Summary: "Your saved comparisons and your organizations'", Access: RequireAuth},
+			Handlers: chain(handler.ListComparisons)},
+		{Method: http.MethodPost, Path: "/comparisons", Legacy: "/comparisons",
+			Doc: Doc{Tag: "Comparisons", Summary: "Save a comparison and get a share link", Access: RequireAuth,
+				Status: http.StatusCreated, Body: comparisonBody},
+			Audit:    audit.Log("comparison.create", "comparison"),
+			Handlers: chain(handler.SaveComparison)},
+		{Method: http.MethodGet, Path: "/comparisons/:id", Legacy: "/comparisons/:id",
+			Doc:      Doc{Tag: "Comparisons", Summary: "One saved comparison", Access: RequireAuth},
+			Handlers: chain(handler.GetComparison)},
+		{Method: http.MethodPut, Path: "/comparisons/:id", Legacy: "/comparisons/:id",
+			Doc: Doc{Tag: "Comparisons", Summary: "Update a saved comparison", Access: RequireAuth,
+				Body: comparisonBody},
+			Audit:    audit.Log("comparison.update", "comparison"),
+			Handlers: chain(handler.UpdateComparison)},
+		{Method: http.MethodDelete, Path: "/comparisons/:id", Legacy: "/comparisons/:id",
+			Doc:      Doc{Tag: "Comparisons", Summary: "Delete a saved comparison", Access: RequireAuth},
+			Audit:    audit.Log("comparison.delete", "comparison"),
+			Handlers: chain(handler.DeleteComparison)},
+		{Method: http.MethodPost, Path: "/comparisons/:id/analyze", Legacy: "/comparisons/:id/analyze",
+			Doc: Doc{Tag: "Comparisons", Summary: "Run and store an AI analysis", Access: RequireAuth,
+				Upstream: true},
+			Handlers: chain(auth.Quota("analyze"), billing.LimitAnalyses(), handler.AnalyzeSavedComparison)},
+		{Method: http.MethodGet, Path: "/c/:slug", Legacy: "/c/:slug",
+			Doc:      Doc{Tag: "Comparisons", Summary: "A shared comparison by its link", Access: OptionalAuth},
+			Handlers: chain(handler.GetSharedComparison)},
+
+		// Alerts
+		{Method: http.MethodGet, Path: "/alerts", Legacy: "/alerts",
+			Doc:      Doc{Tag: "Alerts", Summary: "Your alert rules", Access: RequireAuth},
+			Handlers: chain(handler.ListAlerts)},
+		{Method: http.MethodPost, Path: "/alerts", Legacy: "/alerts",
+			Doc: Doc{Tag: "Alerts", Summary: "Create an alert rule", Access: RequireAuth, Status: http.StatusCreated,
+				Body: alertBody},
+			Audit:    audit.Log("alert.create", "alert"),
+			Handlers: chain(billing.LimitAlerts(), handler.CreateAlert)},
+		{Method: http.MethodGet, Path: "/alerts/triggers", Legacy: "/alerts/triggers",
+			Doc: Doc{Tag: "Alerts", Summary: "Trigger history for all your alerts", Access: RequireAuth,
+				Query: []Param{query("limit", "integer", "1-500, default 50")}},
+			Handlers: chain(handler.ListAlertTriggers)},
+		{Method: http.MethodGet, Path: "/alerts/:id", Legacy: "/alerts/:id",
+			Doc:      Doc{Tag: "Alerts", Summary: "One alert rule", Access: RequireAuth},
+			Handlers: chain(handler.GetAlert)},
+		{Method: http.MethodPut, Path: "/alerts/:id", Legacy: "/alerts/:id",
+			Doc:      Doc{Tag: "Alerts", Summary: "Replace an alert rule", Access: RequireAuth, Body: alertBody},
+			Audit:    audit.Log("alert.update", "alert"),
+			Handlers: chain(handler.UpdateAlert)},
+		{Method: http.MethodDelete, Path: "/alerts/:id", Legacy: "/alerts/:id",
+			Doc:      Doc{Tag: "Alerts", Summary: "Delete an alert rule", Access: RequireAuth},
+			Audit:    audit.Log("alert.delete", "alert"),
+			Handlers: chain(handler.DeleteAlert)},
+		{Method: http.MethodGet, Path: "/alerts/:id/triggers", Legacy: "/alerts/:id/triggers",
+			Doc: Doc{Tag: "Alerts", Summary: "Trigger history for one alert", Access: RequireAuth,
+				Query: []Param{query("limit", "integer", "1-500, default 50")}},
+			Handlers: chain(handler.ListAlertTriggers)},
+
+		// Notifications
+		{Method: http.MethodGet, Path: "/notifications/channels", Legacy: "/notifications/channels",
+			Doc:      Doc{Tag: "Notifications", Summary: "Your notification channels", Access: RequireAuth},
+			Handlers: chain(handler.ListNotificationChannels)},
+		{Method: http.MethodPost, Path: "/notifications/channels", Legacy: "/notifications/channels",
+			Doc: Doc{Tag: "Notifications", Summary: "Add an email or webhook channel", Access: RequireAuth,
+				Status: http.StatusCreated, Body: channelBody},
+			Audit:    audit.Log("notification_channel.create", "notification_channel"),
+			Handlers: chain(handler.CreateNotificationChannel)},
+		{Method: http.MethodGet, Path: "/notifications/channels/:id", Legacy: "/notifications/channels/:id",
+			Doc:      Doc{Tag: "Notifications", Summary: "One notification channel", Access: RequireAuth},
+			Handlers: chain(handler.GetNotificationChannel)},
+		{Method: http.MethodPut, Path: "/notifications/channels/:id", Legacy: "/notifications/channels/:id",
+			Doc:      Doc{Tag: "Notifications", Summary: "Update a channel", Access: RequireAuth, Body: channelBody},
+			Audit:    audit.Log("notification_channel.update", "notification_channel"),
+			Handlers: chain(handler.UpdateNotificationChannel)},
+		{Method: http.MethodDelete, Path: "/notifications/channels/:id", Legacy: "/notifications/channels/:id",
+			Doc:      Doc{Tag: "Notifications", Summary: "Delete a channel", Access: RequireAuth},
+			Audit:    audit.Log("notification_channel.delete", "notification_channel"),
+			Handlers: chain(handler.DeleteNotificationChannel)},
+		{Method: http.MethodPost, Path: "/notifications/channels/:id/test", Legacy: "/notifications/channels/:id/test",
+			Doc:      Doc{Tag: "Notifications", Summary: "Send a test message now", Access: RequireAuth},
+			Handlers: chain(handler.TestNotificationChannel)},
+		{Method: http.MethodGet, Path: "/notifications/deliveries", Legacy: "/notifications/deliveries",
+			Doc: Doc{Tag: "Notifications", Summary: "Delivery log, newest first", Access: RequireAuth,
+				Query: []Param{
+					query("channel_id", "integer", "Only this channel"),
+					query("limit", "integer", "1-500, default 50"),
+				}},
+			Handlers: chain(handler.ListNotificationDeliveries)},
+
+		// Organizations
+		{Method: http.MethodGet, Path: "/orgs", Legacy: "/orgs",
+			Doc:      Doc{Tag: "Organizations", Summary: "Organizations you belong to", Access: RequireAuth},
+			Handlers: chain(handler.ListOrganizations)},
+		{Method: http.MethodPost, Path: "/orgs", Legacy: "/orgs",
+			Doc: Doc{Tag: "Organizations", Summary: "Create an organization you own", Access: RequireAuth,
+				Status: http.StatusCreated, Body: obj(must("name", str("")))},
+			Audit:    audit.Log("org.create", "org"),
+			Handlers: chain(handler.CreateOrganization)},
+		{Method: http.MethodGet, Path: "/orgs/:id", Legacy: "/orgs/:id",
+			Doc:      Doc{Tag: "Organizations", Summary: "An organization and its members", Access: RequireAuth},
+			Handlers: chain(authz.RequireOrg(authz.Read), handler.GetOrganization)},
+		{Method: http.MethodPut, Path: "/orgs/:id", Legacy: "/orgs/:id",
+			Doc: Doc{Tag: "Organizations", Summary: "Rename an organization (owner, admin)", Access: RequireAuth,
+				Body: obj(must("name", str("")))},
+			Audit:    audit.Log("org.rename", "org"),
+			Handlers: chain(authz.RequireOrg(authz.ManageOrg), handler.RenameOrganization)},
+		{Method: http.MethodDelete, Path: "/orgs/:id", Legacy: "/orgs/:id",
+			Doc:      Doc{Tag: "Organizations", Summary: "Delete an organization and its shared resources (owner)", Access: RequireAuth},
+			Audit:    audit.Log("org.delete", "org"),
+			Handlers: chain(authz.RequireOrg(authz.DeleteOrg), handler.DeleteOrganization)},
+		{Method: http.MethodPost, Path: "/orgs/:id/members", Legacy: "/orgs/:id/members",
+			Doc: Doc{Tag: "Organizations", Summary: "Add a member by email", Access: RequireAuth,
+				Status: http.StatusCreated, Body: obj(must("email", str("")), must("role", roleSchema))},
+			Audit:    audit.Log("org_member.add", "org"),
+			Handlers: chain(authz.RequireOrg(authz.ManageMembers), handler.AddOrgMember)},
+		{Method: http.MethodPut, Path: "/orgs/:id/members/:userID", Legacy: "/orgs/:id/members/:userID",
+			Doc: Doc{Tag: "Organizations", Summary: "Change a member's role", Access: RequireAuth,
+				Body: obj(must("role", roleSchema))},
+			Audit:    audit.Log("org_member.update", "org"),
+			Handlers: chain(authz.RequireOrg(authz.ManageMembers), handler.UpdateOrgMember)},
+		{Method: http.MethodDelete, Path: "/orgs/:id/members/:userID", Legacy: "/orgs/:id/members/:userID",
+			Doc:      Doc{Tag: "Organizations", Summary: "Remove a member, or leave", Access: RequireAuth},
+			Audit:    audit.Log("org_member.remove", "org"),
+			Handlers: chain(handler.RemoveOrgMember)},
+
+		// Billing
+		{Method: http.MethodGet, Path: "/billing/plans", Legacy: "/billing/plans",
+			Doc:      Doc{Tag: "Billing", Summary: "Plan definitions"},
+			Handlers: chain(handler.ListPlans)},
+		{Method: http.MethodGet, Path: "/billing/subscription", Legacy: "/billing/subscription",
+			Doc:      Doc{Tag: "Billing", Summary: "Your plan, subscription and today's usage", Access: RequireAuth},
+			Handlers: chain(handler.GetSubscription)},
+		{Method: http.MethodPost, Path: "/billing/checkout", Legacy: "/billing/checkout",
+			Doc: Doc{Tag: "Billing", Summary: "Start an upgrade and get a checkout URL", Access: RequireAuth,
+				Body: obj(must("plan", enum("", "pro", "team")))},
+			Audit:    audit.Log("billing.checkout", "subscription"),
+			Handlers: chain(handler.CreateCheckout)},
+		{Method: http.MethodPost, Path: "/billing/cancel", Legacy: "/billing/cancel",
+			Doc:      Doc{Tag: "Billing", Summary: "Cancel your subscription", Access: RequireAuth},
+			Audit:    audit.Log("billing.cancel", "subscription"),
+			Handlers: chain(handler.CancelSubscription)},
+		{Method: http.MethodPost, Path: "/billing/webhook", Legacy: "/billing/webhook",
+			Doc: Doc{Tag: "Billing", Summary: "Subscription events from the billing provider",
+				Description: "Signed with X-Billing-Signature."},
+			Handlers: chain(handler.BillingWebhook)},
+		{Method: http.MethodPost, Path: "/billing/fake/checkout/:id/complete", Legacy: "/billing/fake/checkout/:id/complete",
+			Doc: Doc{Tag: "Billing", Summary: "Pay for a checkout with the fake provider", Access: RequireAuth,
+				Description: "Only served with BILLING_PROVIDER=fake. The checkout must be your own."},
+			Handlers: chain(handler.CompleteFakeCheckout),
+			Enabled:  billing.FakeEnabled},
+		{Method: http.MethodPost, Path: "/billing/fake/simulate", Legacy: "/billing/fake/simulate",
+			Doc: Doc{Tag: "Billing", Summary: "Send a subscription event with the fake provider", Access: RequireAuth,
+				Description: "Only served with BILLING_PROVIDER=fake.",
+				Body:        obj(must("event", enum("", "subscription.renewed", "subscription.payment_failed", "subscription.canceled")))},
+			Handlers: chain(handler.SimulateBillingEvent),
+			Enabled:  billing.FakeEnabled},
+
+		// Feedback
+		{Method: http.MethodPost, Path: "/feedback", Legacy: "/feedback",
+			Doc: Doc{Tag: "Feedback", Summary: "Submit feedback",
+				Description: "Limited per IP. Needs a solved challenge from GET /feedback/challenge.",
+				Body: obj(
+					must("feedback", str("At most 5000 characters")),
+					field("name", str("At most 100 characters")),
+					field("email", str("")),
+					field("website", str("Honeypot; leave empty")),
+					field("challenge", str("Challenge token")),
+					field("nonce", str("Proof-of-work solution")),
+				)},
+			Handlers: chain(feedbackLimit, handler.SubmitFeedback)},
+		{Method: http.MethodGet, Path: "/feedback/challenge", Legacy: "/feedback/challenge",
+			Doc:      Doc{Tag: "Feedback", Summary: "A proof-of-work challenge for submitting feedback"},
+			Handlers: chain(handler.FeedbackChallenge)},
+		{Method: http.MethodGet, Path: "/feedback", Legacy: "/feedback",
+			Doc: Doc{Tag: "Feedback", Summary: "Moderation queue, newest first", Access: AdminOnly,
+				Query: []Param{
+					query("status", "string", "new, triaged, resolved or spam"),
+					query("q", "string", "Search name, email and text"),
+					query("before", "integer", "Cursor from next_cursor"),
+					query("limit", "integer", "1-200, default 50"),
+				}},
+			Handlers: chain(handler.ListFeedback)},
+		{Method: http.MethodGet, Path: "/feedback/:id", Legacy: "/feedback/:id",
+			Doc:      Doc{Tag: "Feedback", Summary: "One feedback entry", Access: AdminOnly},
+			Handlers: chain(handler.GetFeedback)},
+		{Method: http.MethodPut, Path: "/feedback/:id", Legacy: "/feedback/:id",
+			Doc: Doc{Tag: "Feedback", Summary: "Set status and internal notes", Access: AdminOnly,
+				Body: obj(
+					field("status", enum("", "new", "triaged", "resolved", "spam")),
+					field("notes", str("")),
+				)},
+			Audit:    audit.Log("feedback.update", "feedback"),
+			Handlers: chain(handler.UpdateFeedback)},
+
+		// Admin
+		{Method: http.MethodGet, Path: "/admin/audit-log", Legacy: "/admin/audit-log",
+			Doc: Doc{Tag: "Admin", Summary: "Audit log, newest first", Access: AdminOnly,
+				Query: []Param{
+					query("user_id", "integer", ""),
+					query("action", "string", "e.g. watchlist.rename"),
+					query("resource_type", "string", ""),
+					query("resource_id", "string", ""),
+					query("request_id", "string", ""),
+					query("since", "string", "RFC 3339 or YYYY-MM-DD"),
+					query("until", "string", "RFC 3339 or YYYY-MM-DD"),
+					query("before", "integer", "Cursor from next_cursor"),
+					query("limit", "integer", "1-500, default 50"),
+				}},
+			Handlers: chain(handler.ListAuditLog)},
+	}
+}
+
+// Register mounts every route under Prefix, its legacy alias if it has one,
+// and the unversioned health check
+func Register(router *gin.Engine) {
+	router.GET("/health", Health)
+
+	v1 := router.Group(Prefix)
+	for _, r := range Routes() {
+		if !r.mounted() {
+			continue
+		}
+		var handlers []gin.HandlerFunc
+		if r.Audit != nil {
+			handlers = append(handlers, r.Audit)
+		}
+		handlers = append(append(handlers, accessMiddleware(r.Doc.Access)...), r.Handlers...)
+		v1.Handle(r.Method, r.Path, handlers...)
+		if r.Legacy != "" {
+			router.Handle(r.Method, r.Legacy, append([]gin.HandlerFunc{deprecated(r.Path)}, handlers...)...)
+		}
+	}
+}
+
+func Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "ok",
+		"message": "Stock SaaS API is running",
+	})
+}
+
+func accessMiddleware(a Access) []gin.HandlerFunc {
+	switch a {
+	case OptionalAuth:
+		return chain(auth.OptionalAuth())
+	case RequireAuth:
+		return chain(auth.RequireAuth())
+	case AdminOnly:
+		return chain(auth.RequireAuth(), auth.RequireRole(auth.RoleAdmin))
+	case SessionOnly:
+		return chain(auth.RequireAuth(), auth.RequireSession())
+	}
+	return nil
+}
+
+// deprecated marks a legacy alias and points at its /api/v1 successor
+func deprecated(path string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := Prefix + path
+		for _, p := range c.Params {
+			successor = strings.Replace(successor, ":"+p.Key, p.Value, 1)
+		}
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// TestAuditRunsBeforeAccessChecks records a call refused for lack of a
+// token, which the auth middleware answers before any handler runs
+func TestAuditRunsBeforeAccessChecks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = prev; db.Close() })
+	mock.ExpectQuery("INSERT INTO audit_log").
+		WithArgs(nil, nil, "anonymous", "watchlist.delete", "watchlist", "12", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			http.MethodDelete, Prefix+"/watchlists/12", http.StatusUnauthorized, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "occurred_at"}).AddRow(1, time.Now()))
+
+	w := httptest.NewRecorder()
+	newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodDelete, Prefix+"/watchlists/12", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,181 @@
+// Package audit records who did what to which resource. Routes opt in with
+// the Log middleware; handlers can attach a before/after diff with Diff.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+const pendingKey = "audit_pending"
+
+// Fields never written to diffs
+var redactedFields = map[string]bool{
+	"secret":        true,
+	"password":      true,
+	"password_hash": true,
+	"key":           true,
+	"token":         true,
+}
+
+// Fields that change on every write and would only add noise
+var ignoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// Change is one field's old and new value
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type pending struct {
+	resourceID string
+	diff       map[string]Change
+}
+
+// Log appends an audit entry once the handler has succeeded, or when the
+// call was refused with a 401 or 403. The resource ID defaults to the :id,
+// :ticker or :slug path parameter.
+func Log(action, resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if !recorded(c.Writer.Status()) {
+			return
+		}
+		write(c, action, resourceType)
+	}
+}
+
+// recorded reports whether a response with status gets an audit entry:
+// successes, and refusals that show someone trying what they may not
+func recorded(status int) bool {
+	return status < 400 || status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// Fingerprint stands in for a value too sensitive to log, such as a webhook
+// URL with a token in it: equal values get equal fingerprints
+func Fingerprint(v string) string {
+	if v == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(v))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// Diff attaches the difference between before and after to the request's
+// audit entry. Pass nil before for creations and nil after for deletions.
+func Diff(c *gin.Context, before, after interface{}) {
+	p := current(c)
+	p.diff = diff(toMap(before), toMap(after))
+}
+
+// SetResourceID names the resource when it isn't in the path, such as the
+// ID of something just created
+func SetResourceID(c *gin.Context, id string) {
+	current(c).resourceID = id
+}
+
+func current(c *gin.Context) *pending {
+	if v, ok := c.Get(pendingKey); ok {
+		return v.(*pending)
+	}
+	p := &pending{}
+	c.Set(pendingKey, p)
+	return p
+}
+
+func write(c *gin.Context, action, resourceType string) {
+	p := current(c)
+
+	e := database.AuditEntry{
+		Principal:    "anonymous",
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   p.resourceID,
+		RequestID:    requestid.Get(c),
+		IP:           c.ClientIP(),
+		Method:       c.Request.Method,
+		Path:         c.Request.URL.Path,
+		Status:       c.Writer.Status(),
+	}
+	if e.ResourceID == "" {
+		for _, param := range []string{"id", "ticker", "slug"} {
+			if v := c.Param(param); v != "" {
+				e.ResourceID = v
+				break
+			}
+		}
+	}
+	if claims := auth.CurrentClaims(c); claims != nil {
+		userID := claims.UserID()
+		e.UserID = &userID
+		e.Principal = claims.Email
+		if claims.APIKeyID != 0 {
+			e.APIKeyID = &claims.APIKeyID
+		}
+	}
+	if len(p.diff) > 0 {
+		e.Diff, _ = json.Marshal(p.diff)
+	}
+
+	if err := database.InsertAuditEntry(&e); err != nil {
+		log.Printf("Error writing audit entry %s %s/%s: %v", action, resourceType, e.ResourceID, err)
+	}
+}
+
+// toMap flattens a value to its top-level JSON fields
+func toMap(v interface{}) map[string]interface{} {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if json.Unmarshal(b, &m) != nil {
+		return nil
+	}
+	return m
+}
+
+func diff(before, after map[string]interface{}) map[string]Change {
+	changes := make(map[string]Change)
+	for k, from := range before {
+		if to, ok := after[k]; !ok || !reflect.DeepEqual(from, to) {
+			changes[k] = Change{From: from, To: after[k]}
+		}
+	}
+	for k, to := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = Change{To: to}
+		}
+	}
+
+	for k, ch := range changes {
+		switch {
+		case ignoredFields[k]:
+			delete(changes, k)
+		case redactedFields[k]:
+			changes[k] = Change{From: redact(ch.From), To: redact(ch.To)}
+		}
+	}
+	return changes
+}
+
+func redact(v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	return "[redacted]"
+}
@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLogRecordsSuccessesAndRefusals(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusCreated, true},
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, true},
+		{http.StatusForbidden, true},
+		{http.StatusNotFound, false},
+		{http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			prev := database.DB
+			database.DB = db
+			t.Cleanup(func() { database.DB = prev; db.Close() })
+			if tt.want {
+				mock.ExpectQuery("INSERT INTO audit_log").
+					WithArgs(nil, nil, "anonymous", "watchlist.delete", "watchlist", "12", sqlmock.AnyArg(), sqlmock.AnyArg(), http.MethodDelete, "/watchlists/12", tt.status, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "occurred_at"}).AddRow(1, time.Now()))
+			}
+
+			router := gin.New()
+			router.DELETE("/watchlists/:id", Log("watchlist.delete", "watchlist"), func(c *gin.Context) {
+				c.AbortWithStatus(tt.status)
+			})
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/watchlists/12", nil))
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	before := map[string]interface{}{"name": "a", "secret": "s1", "updated_at": "t1"}
+	after := map[string]interface{}{"name": "b", "secret": "s2", "updated_at": "t2"}
+	got := diff(before, after)
+	if len(got) != 2 || got["name"] != (Change{From: "a", To: "b"}) || got["secret"] != (Change{From: "[redacted]", To: "[redacted]"}) {
+		t.Errorf("diff() = %v", got)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("https://hooks.example.com/T000/B000/XXXX")
+	if a == "" || a != Fingerprint("https://hooks.example.com/T000/B000/XXXX") {
+		t.Errorf("Fingerprint isn't stable: %q", a)
+	}
+	if a == Fingerprint("https://hooks.example.com/T000/B000/YYYY") {
+		t.Error("different values share a fingerprint")
+	}
+	if Fingerprint("") != "" {
+		t.Error("empty value got a fingerprint")
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries API keys for programmatic clients
+const APIKeyHeader = "X-API-Key"
+
+const apiKeyPrefix = "sk_"
+
+// MaxActiveAPIKeys caps the unrevoked keys one user may hold
+var MaxActiveAPIKeys = envInt("API_KEY_MAX_ACTIVE", 10)
+
+// DailyQuotas are per-key daily request limits for expensive routes
+var DailyQuotas = map[string]int{
+	"fetch":   envInt("API_KEY_DAILY_FETCH_QUOTA", 25),
+	"analyze": envInt("API_KEY_DAILY_ANALYZE_QUOTA", 100),
+}
+
+// NewAPIKey returns a key like "sk_ab12cd34_<secret>", the visible prefix
+// ("sk_ab12cd34") and the hash to store. The full key is shown only once.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 30)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(b)
+	prefix = apiKeyPrefix + strings.ToLower(encoded[:8])
+	key = prefix + "_" + encoded[8:]
+	return key, prefix, HashToken(key), nil
+}
+
+// claimsFromAPIKey authenticates an X-API-Key header as its owner
+func claimsFromAPIKey(key string) (*Claims, error) {
+	k, user, err := database.AuthenticateAPIKey(HashToken(key))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		log.Printf("Error authenticating API key: %v", err)
+		return nil, ErrInvalidAPIKey
+	}
+
+	claims := &Claims{Email: user.Email, Role: user.Role, APIKeyID: k.ID}
+	claims.Subject = strconv.Itoa(user.ID)
+	return claims, nil
+}
+
+// Quota enforces the daily quota for a route on requests made with an API
+// key. Browser sessions (JWT) and anonymous requests aren't counted here.
+func Quota(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := CurrentClaims(c)
+		limit, ok := DailyQuotas[route]
+		if claims == nil || claims.APIKeyID == 0 || !ok {
+			c.Next()
+			return
+		}
+
+		count, err := database.IncrementAPIKeyUsage(claims.APIKeyID, route)
+		if err != nil {
+			// Don't lock out paying users because the counter failed
+			log.Printf("Error recording API key usage: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(max(limit-count, 0)))
+		if count > limit {
+			problem.Abort(c, problem.New(http.StatusTooManyRequests, "Daily "+route+" quota exceeded for this API key").
+				WithCode(problem.CodeQuotaExceeded).
+				WithDetail("limit", limit).
+				WithDetail("route", route))
+			return
+		}
+		c.Next()
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const claimsKey = "auth_claims"
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer" token
+// or X-API-Key header. WebSocket handshakes may send ?access_token= instead.
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := claimsFromHeader(c)
+		if err != nil {
+			problem.AbortWith(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// OptionalAuth attaches claims when a valid token is sent but lets anonymous
+// requests through
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims, err := claimsFromHeader(c); err == nil {
+			c.Set(claimsKey, claims)
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests authenticated with an API key, so a key
+// can't mint or revoke keys. It must run after RequireAuth.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := CurrentClaims(c); claims == nil || claims.APIKeyID != 0 {
+			problem.AbortWith(c, http.StatusForbidden, "Log in to manage API keys; API keys can't")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RoleAdmin is the users.role value for site administrators
+const RoleAdmin = "admin"
+
+// RequireRole rejects authenticated users without the given site role. It
+// must run after RequireAuth.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := CurrentClaims(c); claims == nil || claims.Role != role {
+			problem.AbortWith(c, http.StatusForbidden, "This endpoint requires the "+role+" role")
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentClaims returns the authenticated user's claims, or nil
+func CurrentClaims(c *gin.Context) *Claims {
+	if v, ok := c.Get(claimsKey); ok {
+		if claims, ok := v.(*Claims); ok {
+			return claims
+		}
+	}
+	return nil
+}
+
+func claimsFromHeader(c *gin.Context) (*Claims, error) {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return claimsFromAPIKey(key)
+	}
+
+	header := c.GetHeader("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok && c.IsWebsocket() {
+		// Browsers can't set headers on a WebSocket handshake
+		token, ok = c.Query(accessTokenParam), true
+	}
+	if !ok || token == "" {
+		return nil, ErrMissingToken
+	}
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultOrigins are used when CORS_ALLOWED_ORIGINS is unset
+var defaultOrigins = []string{
+	"http://localhost:3000",
+	"https://stock-saas-frontend.vercel.app",
+}
+
+// AllowedOrigins are the browser origins that may call the API, from
+// CORS_ALLOWED_ORIGINS (comma-separated, exact matches only). CORS and the
+// live WebSocket handshake both check against it.
+func AllowedOrigins() []string {
+	env := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if strings.TrimSpace(env) == "" {
+		return defaultOrigins
+	}
+	var origins []string
+	for o := range strings.SplitSeq(env, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// OriginAllowed reports whether origin is exactly one of AllowedOrigins
+func OriginAllowed(origin string) bool {
+	return slices.Contains(AllowedOrigins(), origin)
+}
+
+// accessTokenParam carries the access token on WebSocket handshakes, which
+// browsers can't add headers to
+const accessTokenParam = "access_token"
+
+// RedactAccessToken blanks the access_token query parameter in a request
+// path, so tokens don't end up in access logs
+func RedactAccessToken(path string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok || !strings.Contains(query, accessTokenParam+"=") {
+		return path
+	}
+	params := strings.Split(query, "&")
+	for i, p := range params {
+		if strings.HasPrefix(p, accessTokenParam+"=") {
+			params[i] = accessTokenParam + "=REDACTED"
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// LogFormatter is gin's access log line with RedactAccessToken applied
+func LogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		RedactAccessToken(param.Path),
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import "testing"
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		env    string
+		origin string
+		want   bool
+	}{
+		{"", "http://localhost:3000", true},
+		{"", "https://stock-saas-frontend.vercel.app", true},
+		{"", "https://my-app.onrender.com", false},
+		{"", "http://localhost:3001", false},
+		{"", "https://localhost:3000", false},
+		{"", "https://stock-saas-frontend.vercel.app.evil.com", false},
+		{"", "null", false},
+		{" https://app.example.com , https://admin.example.com", "https://admin.example.com", true},
+		{"https://app.example.com", "http://localhost:3000", false},
+		{"https://*.onrender.com", "https://my-app.onrender.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env+" "+tt.origin, func(t *testing.T) {
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.env)
+			if got := OriginAllowed(tt.origin); got != tt.want {
+				t.Errorf("OriginAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactAccessToken(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"/api/v1/live", "/api/v1/live"},
+		{"/api/v1/live?tickers=AAPL", "/api/v1/live?tickers=AAPL"},
+		{"/api/v1/live?access_token=eyJ.x.y", "/api/v1/live?access_token=REDACTED"},
+		{"/api/v1/live?tickers=AAPL&access_token=eyJ.x.y", "/api/v1/live?tickers=AAPL&access_token=REDACTED"},
+		{"/api/v1/live?access_token=a&access_token=b", "/api/v1/live?access_token=REDACTED&access_token=REDACTED"},
+		{"/api/v1/live?my_access_token=a", "/api/v1/live?my_access_token=a"},
+	}
+	for _, tt := range tests {
+		if got := RedactAccessToken(tt.path); got != tt.want {
+			t.Errorf("RedactAccessToken(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, hash, password string
+		want                 bool
+	}{
+		{"match", hash, "correct horse", true},
+		{"wrong password", hash, "battery staple", false},
+		{"unknown user", "", "correct horse", false},
+		{"unknown user, empty password", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckPassword(tt.hash, tt.password); got != tt.want {
+				t.Errorf("CheckPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashPasswordTooLong(t *testing.T) {
+	if _, err := HashPassword(strings.Repeat("a", MaxPasswordBytes)); err != nil {
+		t.Errorf("HashPassword(%d bytes) = %v", MaxPasswordBytes, err)
+	}
+	if _, err := HashPassword(strings.Repeat("a", MaxPasswordBytes+1)); err == nil {
+		t.Errorf("HashPassword(%d bytes) succeeded; signup must reject longer passwords first", MaxPasswordBytes+1)
+	}
+}
@@ -0,0 +1,155 @@
+// Package authz answers "can this principal do X on resource Y" for
+// personal and organization-owned resources.
+package authz
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// Organization roles, most privileged first
+const (
+	RoleOwner   = "owner"
+	RoleAdmin   = "admin"
+	RoleAnalyst = "analyst"
+	RoleViewer  = "viewer"
+)
+
+// Roles lists every role, most privileged first
+var Roles = []string{RoleOwner, RoleAdmin, RoleAnalyst, RoleViewer}
+
+// Action is something a principal can do to a resource
+type Action string
+
+const (
+	// Read views a resource
+	Read Action = "read"
+	// Write creates or edits a shared resource
+	Write Action = "write"
+	// Delete removes a shared resource
+	Delete Action = "delete"
+	// ManageMembers adds, removes and changes the role of members
+	ManageMembers Action = "manage_members"
+	// ManageOrg renames the organization
+	ManageOrg Action = "manage_org"
+	// DeleteOrg deletes the organization and everything it owns
+	DeleteOrg Action = "delete_org"
+)
+
+var policy = map[string][]Action{
+	RoleOwner:   {Read, Write, Delete, ManageMembers, ManageOrg, DeleteOrg},
+	RoleAdmin:   {Read, Write, Delete, ManageMembers, ManageOrg},
+	RoleAnalyst: {Read, Write},
+	RoleViewer:  {Read},
+}
+
+// Resource identifies what an action targets. OrgID 0 means a personal
+// resource that only OwnerID can touch.
+type Resource struct {
+	OwnerID int
+	OrgID   int
+}
+
+// Org is a resource standing for the organization itself
+func Org(orgID int) Resource {
+	return Resource{OrgID: orgID}
+}
+
+// RoleAllows reports whether the role's policy includes the action
+func RoleAllows(role string, action Action) bool {
+	return slices.Contains(policy[role], action)
+}
+
+// ValidRole reports whether role is a known organization role
+func ValidRole(role string) bool {
+	_, ok := policy[role]
+	return ok
+}
+
+// Outranks reports whether role a is strictly more privileged than b. An
+// unknown role outranks nothing and is outranked by nothing.
+func Outranks(a, b string) bool {
+	i, j := slices.Index(Roles, a), slices.Index(Roles, b)
+	return i >= 0 && j >= 0 && i < j
+}
+
+const rolesKey = "authz_roles"
+
+// Role returns the request principal's role in an organization, or "" if
+// they aren't a member. Lookups are cached for the rest of the request.
+func Role(c *gin.Context, orgID int) string {
+	claims := auth.CurrentClaims(c)
+	if claims == nil {
+		return ""
+	}
+
+	roles, _ := c.Get(rolesKey)
+	cache, ok := roles.(map[int]string)
+	if !ok {
+		cache = make(map[int]string)
+		c.Set(rolesKey, cache)
+	}
+	if role, ok := cache[orgID]; ok {
+		return role
+	}
+
+	role, err := database.GetOrgMemberRole(orgID, claims.UserID())
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Error loading org role: %v", err)
+	}
+	cache[orgID] = role
+	return role
+}
+
+// Can reports whether the request principal may perform action on res
+func Can(c *gin.Context, action Action, res Resource) bool {
+	claims := auth.CurrentClaims(c)
+	if claims == nil {
+		return false
+	}
+	if res.OrgID == 0 {
+		return res.OwnerID == claims.UserID()
+	}
+	return RoleAllows(Role(c, res.OrgID), action)
+}
+
+// Check writes the standard response when the principal may not perform
+// action on res: 404 if they can't even see it, 403 otherwise. It returns
+// true when the action is allowed.
+func Check(c *gin.Context, action Action, res Resource, notFound string) bool {
+	if Can(c, action, res) {
+		return true
+	}
+	if action != Read && Can(c, Read, res) {
+		problem.Respond(c, http.StatusForbidden, "Your role doesn't allow this action")
+		return false
+	}
+	problem.Respond(c, http.StatusNotFound, notFound)
+	return false
+}
+
+// RequireOrg guards /orgs/:id routes: the principal must be a member of the
+// organization and their role must allow action. It must run after
+// auth.RequireAuth.
+func RequireOrg(action Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			problem.AbortWith(c, http.StatusBadRequest, "Invalid organization id")
+			return
+		}
+		if !Check(c, action, Org(orgID), "Organization not found") {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
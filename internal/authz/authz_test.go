@@ -0,0 +1,104 @@
+package authz
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+const userID = 7
+
+// signedIn returns a context whose principal is userID, or anonymous
+func signedIn(t *testing.T, anonymous bool) *gin.Context {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if !anonymous {
+		t.Setenv("JWT_SECRET", "test-secret")
+		token, _, err := auth.NewAccessToken(userID, "user@example.com", "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+	auth.OptionalAuth()(c)
+	return c
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		name      string
+		anonymous bool
+		role      string // org role of the principal, "" for none
+		action    Action
+		res       Resource
+		want      bool
+	}{
+		{name: "own personal resource", action: Delete, res: Resource{OwnerID: userID}, want: true},
+		{name: "someone else's personal resource", action: Read, res: Resource{OwnerID: 8}},
+		{name: "anonymous", anonymous: true, action: Read, res: Resource{OwnerID: userID}},
+		{name: "viewer reads", role: RoleViewer, action: Read, res: Resource{OwnerID: 8, OrgID: 1}, want: true},
+		{name: "viewer writes", role: RoleViewer, action: Write, res: Resource{OwnerID: userID, OrgID: 1}},
+		{name: "analyst writes", role: RoleAnalyst, action: Write, res: Resource{OrgID: 1}, want: true},
+		{name: "analyst deletes", role: RoleAnalyst, action: Delete, res: Resource{OrgID: 1}},
+		{name: "admin manages members", role: RoleAdmin, action: ManageMembers, res: Org(1), want: true},
+		{name: "admin deletes org", role: RoleAdmin, action: DeleteOrg, res: Org(1)},
+		{name: "owner deletes org", role: RoleOwner, action: DeleteOrg, res: Org(1), want: true},
+		{name: "non-member", action: Read, res: Org(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			prev := database.DB
+			database.DB = db
+			t.Cleanup(func() { database.DB = prev; db.Close() })
+			if tt.res.OrgID != 0 && !tt.anonymous {
+				rows := sqlmock.NewRows([]string{"role"})
+				if tt.role != "" {
+					rows.AddRow(tt.role)
+				}
+				mock.ExpectQuery("FROM org_members").WithArgs(tt.res.OrgID, userID).WillReturnRows(rows)
+			}
+
+			c := signedIn(t, tt.anonymous)
+			if got := Can(c, tt.action, tt.res); got != tt.want {
+				t.Errorf("Can(%s) = %v, want %v", tt.action, got, tt.want)
+			}
+			// The role is looked up once per request
+			Can(c, tt.action, tt.res)
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{RoleOwner, RoleAdmin, true},
+		{RoleAdmin, RoleViewer, true},
+		{RoleAnalyst, RoleAnalyst, false},
+		{RoleViewer, RoleOwner, false},
+		{"", RoleViewer, false},
+		{"superuser", RoleOwner, false},
+		{RoleOwner, "superuser", false},
+		{RoleViewer, "", false},
+	}
+	for _, tt := range tests {
+		if got := Outranks(tt.a, tt.b); got != tt.want {
+			t.Errorf("Outranks(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// SignatureHeader carries "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">"
+const SignatureHeader = "X-Billing-Signature"
+
+const (
+	fakeBillingPeriod  = 30 * 24 * time.Hour
+	signatureTolerance = 5 * time.Minute
+)
+
+var ErrUnknownCheckout = errors.New("unknown or completed checkout")
+
+// FakeProvider is a local stand-in for a real billing provider. Checkouts
+// complete on request, and every lifecycle change is sent as a signed
+// webhook through the same path a real provider's would take.
+type FakeProvider struct {
+	Secret string
+	// Webhook receives each event the fake emits; HandleWebhook by default
+	Webhook func(payload []byte, header http.Header) error
+
+	mu        sync.Mutex
+	checkouts map[string]fakeCheckout
+}
+
+type fakeCheckout struct {
+	UserID int
+	Plan   string
+}
+
+// NewFakeProvider signs webhooks with secret, or a random one if empty
+func NewFakeProvider(secret string) *FakeProvider {
+	if secret == "" {
+		secret = "whsec_fake_" + randomID()
+	}
+	return &FakeProvider{Secret: secret, checkouts: make(map[string]fakeCheckout)}
+}
+
+func (f *FakeProvider) Name() string { return "fake" }
+
+func (f *FakeProvider) CreateCheckout(userID int, email, plan string) (*Checkout, error) {
+	if _, ok := Lookup(plan); !ok || plan == PlanFree {
+		return nil, ErrUnknownPlan
+	}
+	id := "fcs_" + randomID()
+
+	f.mu.Lock()
+	f.checkouts[id] = fakeCheckout{UserID: userID, Plan: plan}
+	f.mu.Unlock()
+
+	return &Checkout{ID: id, URL: "/billing/fake/checkout/" + id + "/complete"}, nil
+}
+
+// CompleteCheckout simulates userID paying: it starts a subscription, or
+// switches their current one to the new plan. Checkouts created by another
+// user are unknown.
+func (f *FakeProvider) CompleteCheckout(id string, userID int, current *database.Subscription) error {
+	f.mu.Lock()
+	co, ok := f.checkouts[id]
+	if ok && co.UserID == userID {
+		delete(f.checkouts, id)
+	}
+	f.mu.Unlock()
+	if !ok || co.UserID != userID {
+		return ErrUnknownCheckout
+	}
+
+	sub := EventSubscription{
+		ID:               "fsub_" + randomID(),
+		CustomerRef:      strconv.Itoa(co.UserID),
+		Plan:             co.Plan,
+		Status:           StatusActive,
+		CurrentPeriodEnd: time.Now().UTC().Add(fakeBillingPeriod),
+	}
+	eventType := EventSubscriptionCreated
+	if current != nil && current.Status != StatusCanceled {
+		sub.ID = current.ProviderID
+		eventType = EventSubscriptionUpdated
+	}
+	return f.emit(eventType, sub)
+}
+
+func (f *FakeProvider) CancelSubscription(sub *database.Subscription) error {
+	return f.Simulate(EventSubscriptionCanceled, sub)
+}
+
+// Simulate emits a lifecycle event for an existing subscription: a renewal,
+// a failed payment or a cancellation
+func (f *FakeProvider) Simulate(eventType string, current *database.Subscription) error {
+	sub := EventSubscription{
+		ID:          current.ProviderID,
+		CustomerRef: strconv.Itoa(current.UserID),
+		Plan:        current.Plan,
+		Status:      current.Status,
+	}
+	if current.CurrentPeriodEnd != nil {
+		sub.CurrentPeriodEnd = *current.CurrentPeriodEnd
+	}
+
+	switch eventType {
+	case EventSubscriptionRenewed:
+		sub.Status = StatusActive
+		sub.CurrentPeriodEnd = time.Now().UTC().Add(fakeBillingPeriod)
+	case EventPaymentFailed:
+		sub.Status = StatusPastDue
+	case EventSubscriptionCanceled:
+		sub.Status = StatusCanceled
+	default:
+		return fmt.Errorf("cannot simulate %q", eventType)
+	}
+	return f.emit(eventType, sub)
+}
+
+func (f *FakeProvider) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	var ts, sig string
+	for _, part := range strings.Split(header.Get(SignatureHeader), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)).Abs() > signatureTolerance {
+		return nil, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(f.sign(ts, payload))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// emit signs an event and hands it to the webhook receiver
+func (f *FakeProvider) emit(eventType string, sub EventSubscription) error {
+	payload, err := json.Marshal(Event{
+		ID:           "fevt_" + randomID(),
+		Type:         eventType,
+		CreatedAt:    time.Now().UTC(),
+		Subscription: sub,
+	})
+	if err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	header := http.Header{}
+	header.Set(SignatureHeader, "t="+ts+",v1="+f.sign(ts, payload))
+
+	deliver := f.Webhook
+	if deliver == nil {
+		deliver = HandleWebhook
+	}
+	return deliver(payload, header)
+}
+
+func (f *FakeProvider) sign(ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(f.Secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,126 @@
+package billing
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const planKey = "billing_plan"
+
+// Usage metrics counted per day
+const MetricAnalyses = "analyses"
+
+// CurrentPlan returns the plan for the request's user, or the free plan for
+// anonymous requests. It is loaded once per request.
+func CurrentPlan(c *gin.Context) Plan {
+	if v, ok := c.Get(planKey); ok {
+		if p, ok := v.(Plan); ok {
+			return p
+		}
+	}
+	p := Free()
+	if claims := auth.CurrentClaims(c); claims != nil {
+		p = PlanForUser(claims.UserID())
+	}
+	c.Set(planKey, p)
+	return p
+}
+
+// UsageSubject is who daily plan usage is counted against: the user, or the
+// client IP for anonymous requests
+func UsageSubject(c *gin.Context) string {
+	if claims := auth.CurrentClaims(c); claims != nil {
+		return "user:" + strconv.Itoa(claims.UserID())
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// LimitAnalyses enforces the plan's AI analyses per day
+func LimitAnalyses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan := CurrentPlan(c)
+		if plan.DailyAnalyses == 0 {
+			c.Next()
+			return
+		}
+
+		count, err := database.IncrementPlanUsage(UsageSubject(c), MetricAnalyses)
+		if err != nil {
+			log.Printf("Error recording plan usage: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-Plan-Limit", strconv.Itoa(plan.DailyAnalyses))
+		c.Header("X-Plan-Remaining", strconv.Itoa(max(plan.DailyAnalyses-count, 0)))
+		if count > plan.DailyAnalyses {
+			abortLimit(c, http.StatusTooManyRequests, plan, "Daily AI analysis limit reached")
+			return
+		}
+		c.Next()
+	}
+}
+
+// LimitHistory rejects a ?start= date further back than the plan allows
+func LimitHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan := CurrentPlan(c)
+		start, err := time.Parse("2006-01-02", c.Query("start"))
+		if err == nil && !HistoryAllowed(plan, start) {
+			abortLimit(c, http.StatusForbidden, plan, "start is older than your plan's history depth of "+strconv.Itoa(plan.HistoryDays)+" days")
+			return
+		}
+		c.Next()
+	}
+}
+
+// HistoryAllowed reports whether the plan can read data from start onwards
+func HistoryAllowed(plan Plan, start time.Time) bool {
+	if plan.HistoryDays == 0 {
+		return true
+	}
+	return !start.Before(time.Now().AddDate(0, 0, -plan.HistoryDays).Truncate(24 * time.Hour))
+}
+
+// LimitAlerts stops users creating more alert rules than their plan allows.
+// It must run after auth.RequireAuth.
+func LimitAlerts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plan := CurrentPlan(c)
+		if plan.MaxAlerts == 0 {
+			c.Next()
+			return
+		}
+
+		count, err := database.CountAlertRules(auth.CurrentClaims(c).UserID())
+		if err != nil {
+			log.Printf("Error counting alert rules: %v", err)
+			c.Next()
+			return
+		}
+		if count >= plan.MaxAlerts {
+			abortLimit(c, http.StatusForbidden, plan, "Your plan allows "+strconv.Itoa(plan.MaxAlerts)+" alerts")
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortLimit(c *gin.Context, status int, plan Plan, msg string) {
+	problem.Abort(c, LimitError(status, plan, msg))
+}
+
+// LimitError is the plan_limit problem for a limit of plan; details.plan
+// names the plan so clients can offer the right upgrade
+func LimitError(status int, plan Plan, msg string) *problem.Error {
+	return problem.New(status, msg+". Upgrade your plan for higher limits.").
+		WithCode(problem.CodePlanLimit).
+		WithDetail("plan", plan.Name)
+}
@@ -0,0 +1,81 @@
+// Package billing defines subscription plans, enforces their limits and
+// talks to the billing provider.
+package billing
+
+import (
+	"errors"
+	"log"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// Plan names
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+	PlanTeam = "team"
+)
+
+// Plan is the set of limits a subscription grants. Zero means unlimited.
+type Plan struct {
+	Name               string `json:"name"`
+	MonthlyPriceCents  int    `json:"monthly_price_cents"`
+	MaxComparedTickers int    `json:"max_compared_tickers"`
+	DailyAnalyses      int    `json:"daily_analyses"`
+	HistoryDays        int    `json:"history_days"`
+	MaxAlerts          int    `json:"max_alerts"`
+}
+
+// Plans in upgrade order
+var Plans = []Plan{
+	{Name: PlanFree, MonthlyPriceCents: 0, MaxComparedTickers: 2, DailyAnalyses: 5, HistoryDays: 365, MaxAlerts: 3},
+	{Name: PlanPro, MonthlyPriceCents: 1900, MaxComparedTickers: 4, DailyAnalyses: 100, HistoryDays: 5 * 365, MaxAlerts: 25},
+	{Name: PlanTeam, MonthlyPriceCents: 7900, MaxComparedTickers: 8, DailyAnalyses: 500, HistoryDays: 0, MaxAlerts: 100},
+}
+
+// Subscription statuses
+const (
+	StatusActive   = "active"
+	StatusTrialing = "trialing"
+	StatusPastDue  = "past_due"
+	StatusCanceled = "canceled"
+)
+
+// Lookup returns the named plan
+func Lookup(name string) (Plan, bool) {
+	for _, p := range Plans {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Plan{}, false
+}
+
+// Free is the plan for anonymous visitors and users without a subscription
+func Free() Plan {
+	p, _ := Lookup(PlanFree)
+	return p
+}
+
+// PlanForUser resolves the plan a user's subscription currently grants.
+// Past-due subscriptions keep their plan while the provider retries payment.
+func PlanForUser(userID int) Plan {
+	sub, err := database.GetSubscription(userID)
+	if err != nil {
+		if !errors.Is(err, database.ErrNotFound) {
+			log.Printf("Error loading subscription for user %d: %v", userID, err)
+		}
+		return Free()
+	}
+	return planForSubscription(sub)
+}
+
+func planForSubscription(sub *database.Subscription) Plan {
+	switch sub.Status {
+	case StatusActive, StatusTrialing, StatusPastDue:
+		if p, ok := Lookup(sub.Plan); ok {
+			return p
+		}
+	}
+	return Free()
+}
@@ -0,0 +1,56 @@
+package billing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+func TestPlanForSubscription(t *testing.T) {
+	tests := []struct {
+		plan, status string
+		want         string
+	}{
+		{PlanPro, StatusActive, PlanPro},
+		{PlanTeam, StatusTrialing, PlanTeam},
+		{PlanPro, StatusPastDue, PlanPro},
+		{PlanPro, StatusCanceled, PlanFree},
+		{PlanPro, "incomplete", PlanFree},
+		{"enterprise", StatusActive, PlanFree},
+		{PlanFree, StatusActive, PlanFree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.plan+"/"+tt.status, func(t *testing.T) {
+			got := planForSubscription(&database.Subscription{Plan: tt.plan, Status: tt.status})
+			if got.Name != tt.want {
+				t.Errorf("planForSubscription(%s, %s) = %s, want %s", tt.plan, tt.status, got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryAllowed(t *testing.T) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	free, _ := Lookup(PlanFree)
+	team, _ := Lookup(PlanTeam)
+	tests := []struct {
+		name  string
+		plan  Plan
+		start time.Time
+		want  bool
+	}{
+		{"today", free, today, true},
+		{"last day of the window", free, today.AddDate(0, 0, -free.HistoryDays), true},
+		{"one day too far", free, today.AddDate(0, 0, -free.HistoryDays-1), false},
+		{"years back on free", free, today.AddDate(-10, 0, 0), false},
+		{"unlimited history", team, today.AddDate(-30, 0, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HistoryAllowed(tt.plan, tt.start); got != tt.want {
+				t.Errorf("HistoryAllowed(%s, %s) = %v, want %v", tt.plan.Name, tt.start.Format("2006-01-02"), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package billing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// Lifecycle event types sent by the provider's webhooks
+const (
+	EventSubscriptionCreated  = "subscription.created"
+	EventSubscriptionUpdated  = "subscription.updated"
+	EventSubscriptionRenewed  = "subscription.renewed"
+	EventPaymentFailed        = "subscription.payment_failed"
+	EventSubscriptionCanceled = "subscription.canceled"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnknownPlan      = errors.New("unknown plan")
+	ErrNoProvider       = errors.New("BILLING_PROVIDER must be set; use fake for local development")
+)
+
+// Checkout is a hosted payment page the user is sent to
+type Checkout struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Event is a subscription lifecycle webhook, normalized across providers
+type Event struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Subscription EventSubscription `json:"subscription"`
+}
+
+// EventSubscription is the subscription's state after the event
+type EventSubscription struct {
+	ID               string    `json:"id"`
+	CustomerRef      string    `json:"customer_ref"`
+	Plan             string    `json:"plan"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+// Provider is a billing backend. Subscription state changes arrive through
+// webhooks rather than return values, so the same path handles changes made
+// here and ones made in the provider's own dashboard.
+type Provider interface {
+	Name() string
+	CreateCheckout(userID int, email, plan string) (*Checkout, error)
+	CancelSubscription(sub *database.Subscription) error
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// Current is the provider in use; main sets it from NewProvider once the
+// environment is loaded
+var Current Provider
+
+// NewProvider returns the provider named by BILLING_PROVIDER. Only the local
+// fake exists so far, and it lets users upgrade for free, so it is never
+// picked unless asked for by name.
+func NewProvider() (Provider, error) {
+	switch name := os.Getenv("BILLING_PROVIDER"); name {
+	case "fake":
+		return NewFakeProvider(os.Getenv("BILLING_WEBHOOK_SECRET")), nil
+	case "":
+		return nil, ErrNoProvider
+	default:
+		return nil, fmt.Errorf("unknown BILLING_PROVIDER %q", name)
+	}
+}
+
+// FakeEnabled reports whether the fake provider is in use, which mounts
+// its checkout and simulation routes
+func FakeEnabled() bool {
+	_, ok := Current.(*FakeProvider)
+	return ok
+}
+
+// HandleWebhook verifies a provider webhook and applies it. Events that were
+// already processed are ignored.
+func HandleWebhook(payload []byte, header http.Header) error {
+	event, err := Current.ParseWebhook(payload, header)
+	if err != nil {
+		return err
+	}
+	return Apply(event, payload)
+}
+
+// Apply records an event and updates the customer's subscription
+func Apply(event *Event, payload []byte) error {
+	userID, err := strconv.Atoi(event.Subscription.CustomerRef)
+	if err != nil {
+		return fmt.Errorf("event %s: bad customer_ref %q", event.ID, event.Subscription.CustomerRef)
+	}
+	if _, ok := Lookup(event.Subscription.Plan); !ok {
+		return fmt.Errorf("event %s: %w %q", event.ID, ErrUnknownPlan, event.Subscription.Plan)
+	}
+
+	if payload == nil {
+		if payload, err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+	fresh, err := database.RecordBillingEvent(event.ID, event.Type, payload)
+	if err != nil || !fresh {
+		return err
+	}
+
+	periodEnd := event.Subscription.CurrentPeriodEnd
+	return database.UpsertSubscription(&database.Subscription{
+		UserID:           userID,
+		Plan:             event.Subscription.Plan,
+		Status:           event.Subscription.Status,
+		Provider:         Current.Name(),
+		ProviderID:       event.Subscription.ID,
+		CurrentPeriodEnd: &periodEnd,
+	})
+}
@@ -0,0 +1,58 @@
+package billing
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		env     string
+		wantErr bool
+	}{
+		{"fake", false},
+		{"", true},
+		{"stripe", true},
+		{"Fake", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("BILLING_PROVIDER", tt.env)
+			p, err := NewProvider()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewProvider() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && p.Name() != "fake" {
+				t.Errorf("NewProvider() = %s, want fake", p.Name())
+			}
+		})
+	}
+}
+
+func TestFakeCheckoutBelongsToItsUser(t *testing.T) {
+	f := NewFakeProvider("secret")
+	var events []*Event
+	f.Webhook = func(payload []byte, header http.Header) error {
+		e, err := f.ParseWebhook(payload, header)
+		events = append(events, e)
+		return err
+	}
+
+	co, err := f.CreateCheckout(1, "owner@example.com", PlanPro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.CompleteCheckout(co.ID, 2, nil); !errors.Is(err, ErrUnknownCheckout) {
+		t.Fatalf("another user completing the checkout: err = %v, want ErrUnknownCheckout", err)
+	}
+	if err := f.CompleteCheckout(co.ID, 1, nil); err != nil {
+		t.Fatalf("owner completing the checkout: %v", err)
+	}
+	if len(events) != 1 || events[0].Subscription.CustomerRef != "1" || events[0].Subscription.Plan != PlanPro {
+		t.Errorf("events = %+v, want one pro subscription for user 1", events)
+	}
+	if err := f.CompleteCheckout(co.ID, 1, nil); !errors.Is(err, ErrUnknownCheckout) {
+		t.Errorf("completing twice: err = %v, want ErrUnknownCheckout", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package cache keeps hot, derived data such as latest prices, stored
+// ranges and computed stats out of Postgres. Entries are tagged with the
+// tickers they were built from, so saving new bars for a ticker drops
+// everything built from it. A Cache never fails a request: errors are
+// logged and read as misses.
+package cache
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Cache stores values under keys until their TTL runs out, they are evicted,
+// or one of their tags is invalidated. Every tag has a version that
+// Invalidate bumps; Set skips the write when a tag moved past the versions
+// read before the value was loaded, so a slow load can't cache data that
+// predates an invalidation made by any process sharing the cache. Values
+// returned by Get must not be modified.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Versions(tags ...string) []uint64
+	Set(key string, value []byte, ttl time.Duration, tags []string, versions []uint64)
+	Invalidate(tags ...string)
+}
+
+// DefaultMaxEntries sizes the in-memory cache when CACHE_MAX_ENTRIES is unset
+const DefaultMaxEntries = 10000
+
+// Default is the cache the app reads through. It starts as an in-memory
+// LRU; main replaces it with Open once the environment is loaded.
+var Default Cache = NewLRU(DefaultMaxEntries)
+
+// Open picks a cache from the environment: Redis when REDIS_URL is set and
+// reachable, otherwise an in-memory LRU of CACHE_MAX_ENTRIES entries (0
+// turns caching off).
+func Open() Cache {
+	if url := os.Getenv("REDIS_URL"); url != "" {
+		r, err := NewRedis(url)
+		if err == nil {
+			log.Println("✅ Caching in Redis")
+			return r
+		}
+		log.Printf("Error connecting to Redis, caching in memory instead: %v", err)
+	}
+	size := DefaultMaxEntries
+	if v, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES")); err == nil && v >= 0 {
+		size = v
+	}
+	return NewLRU(size)
+}
+
+// TickerTag tags entries built from a ticker's bars
+func TickerTag(ticker string) string { return "ticker:" + ticker }
+
+// InvalidateTickers drops everything built from the bars of tickers. The
+// database package calls it whenever bars are saved.
+func InvalidateTickers(tickers []string) {
+	tags := make([]string, len(tickers))
+	for i, t := range tickers {
+		tags[i] = TickerTag(t)
+	}
+	Default.Invalidate(tags...)
+}
+
+// Fetch returns the value cached under key, or calls load and caches its
+// result for ttl under tags. Errors from load are returned and not cached.
+// A result loaded while one of tags was invalidated is returned but not
+// cached, as it may predate the new bars.
+func Fetch[T any](key string, ttl time.Duration, tags []string, load func() (T, error)) (T, error) {
+	if data, ok := Default.Get(key); ok {
+		var v T
+		err := json.Unmarshal(data, &v)
+		if err == nil {
+			return v, nil
+		}
+		log.Printf("Error decoding cached %s: %v", key, err)
+	}
+
+	versions := Default.Versions(tags...)
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	store(key, v, ttl, tags, versions)
+	return v, nil
+}
+
+// FetchMany is Fetch for a batch: ids found under key(id) are decoded, and
+// the rest are passed to a single load, whose results are cached under
+// key(id) with tags(id). Ids load leaves out of its map are not cached.
+func FetchMany[K comparable, V any](ids []K, key func(K) string, ttl time.Duration, tags func(K) []string, load func([]K) (map[K]V, error)) (map[K]V, error) {
+	out := make(map[K]V, len(ids))
+	var missing []K
+	for _, id := range ids {
+		if data, ok := Default.Get(key(id)); ok {
+			var v V
+			if err := json.Unmarshal(data, &v); err == nil {
+				out[id] = v
+				continue
+			}
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	// One round trip for the versions of every tag in the batch
+	var allTags []string
+	for _, id := range missing {
+		for _, tag := range tags(id) {
+			if !slices.Contains(allTags, tag) {
+				allTags = append(allTags, tag)
+			}
+		}
+	}
+	read := Default.Versions(allTags...)
+	versionOf := make(map[string]uint64, len(allTags))
+	for i, tag := range allTags {
+		versionOf[tag] = read[i]
+	}
+
+	loaded, err := load(missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, v := range loaded {
+		out[id] = v
+		idTags := tags(id)
+		versions := make([]uint64, len(idTags))
+		for i, tag := range idTags {
+			versions[i] = versionOf[tag]
+		}
+		store(key(id), v, ttl, idTags, versions)
+	}
+	return out, nil
+}
+
+// store caches v as JSON under key
+func store(key string, v interface{}, ttl time.Duration, tags []string, versions []uint64) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding %s for the cache: %v", key, err)
+		return
+	}
+	Default.Set(key, data, ttl, tags, versions)
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// caches returns the implementations to run the contract tests on: the
+// LRU, plus Redis when TEST_REDIS_URL points at a server to flush keys in
+func caches(t *testing.T) map[string]Cache {
+	t.Helper()
+	out := map[string]Cache{"lru": NewLRU(100)}
+	if url := os.Getenv("TEST_REDIS_URL"); url != "" {
+		r, err := NewRedis(url)
+		if err != nil {
+			t.Fatalf("connecting to TEST_REDIS_URL: %v", err)
+		}
+		out["redis"] = r
+	}
+	return out
+}
+
+// withDefault points Default at c for the rest of the test
+func withDefault(t *testing.T, c Cache) {
+	prev := Default
+	Default = c
+	t.Cleanup(func() { Default = prev })
+}
+
+func TestSetSkipsStaleVersions(t *testing.T) {
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			tag := "test:" + t.Name()
+			read := c.Versions(tag)
+			// Bars saved while the value was being loaded
+			c.Invalidate(tag)
+			c.Set("stale:"+t.Name(), []byte("old"), time.Minute, []string{tag}, read)
+			if v, ok := c.Get("stale:" + t.Name()); ok {
+				t.Errorf("Get() = %q, want a miss for a value loaded before the invalidation", v)
+			}
+
+			c.Set("fresh:"+t.Name(), []byte("new"), time.Minute, []string{tag}, c.Versions(tag))
+			if v, ok := c.Get("fresh:" + t.Name()); !ok || string(v) != "new" {
+				t.Errorf("Get() = %q, %v, want the value set at the current version", v, ok)
+			}
+		})
+	}
+}
+
+func TestInvalidateDropsTaggedEntries(t *testing.T) {
+	for name, c := range caches(t) {
+		t.Run(name, func(t *testing.T) {
+			a, b := "a:"+t.Name(), "b:"+t.Name()
+			c.Set("both:"+t.Name(), []byte("1"), time.Minute, []string{a, b}, c.Versions(a, b))
+			c.Set("only-b:"+t.Name(), []byte("2"), time.Minute, []string{b}, c.Versions(b))
+
+			c.Invalidate(a)
+			if _, ok := c.Get("both:" + t.Name()); ok {
+				t.Error("entry tagged with the invalidated tag survived")
+			}
+			if _, ok := c.Get("only-b:" + t.Name()); !ok {
+				t.Error("entry without the invalidated tag was dropped")
+			}
+		})
+	}
+}
+
+func TestFetchDoesNotCacheARacedLoad(t *testing.T) {
+	withDefault(t, NewLRU(100))
+	tags := []string{TickerTag("AAPL")}
+	loads := 0
+
+	v, err := Fetch("latest:AAPL", time.Minute, tags, func() (int, error) {
+		loads++
+		// A save lands while the old value is being read
+		InvalidateTickers([]string{"AAPL"})
+		return 1, nil
+	})
+	if err != nil || v != 1 {
+		t.Fatalf("Fetch() = %d, %v", v, err)
+	}
+	v, _ = Fetch("latest:AAPL", time.Minute, tags, func() (int, error) {
+		loads++
+		return 2, nil
+	})
+	if v != 2 || loads != 2 {
+		t.Errorf("second Fetch() = %d after %d loads, want the reloaded 2", v, loads)
+	}
+	v, _ = Fetch("latest:AAPL", time.Minute, tags, func() (int, error) {
+		loads++
+		return 3, nil
+	})
+	if v != 2 || loads != 2 {
+		t.Errorf("third Fetch() = %d after %d loads, want the cached 2", v, loads)
+	}
+}
+
+func TestFetchManyChecksEachTag(t *testing.T) {
+	withDefault(t, NewLRU(100))
+	key := func(t string) string { return "latest:" + t }
+	tags := func(t string) []string { return []string{TickerTag(t)} }
+
+	_, err := FetchMany([]string{"AAPL", "MSFT"}, key, time.Minute, tags, func(ids []string) (map[string]int, error) {
+		InvalidateTickers([]string{"MSFT"})
+		return map[string]int{"AAPL": 1, "MSFT": 1}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Default.Get("latest:AAPL"); !ok {
+		t.Error("AAPL wasn't cached though its tag didn't move")
+	}
+	if _, ok := Default.Get("latest:MSFT"); ok {
+		t.Error("MSFT was cached though it was invalidated during the load")
+	}
+}
+
+func TestLRUEvictsAndExpires(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", []byte("a"), time.Minute, nil, nil)
+	c.Set("b", []byte("b"), time.Minute, nil, nil)
+	c.Get("a")
+	c.Set("c", []byte("c"), time.Minute, nil, nil)
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry wasn't evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+
+	c.Set("short", []byte("x"), time.Nanosecond, nil, nil)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.Get("short"); ok {
+		t.Error("expired entry was returned")
+	}
+
+	off := NewLRU(0)
+	off.Set("a", []byte("a"), time.Minute, nil, nil)
+	if _, ok := off.Get("a"); ok {
+		t.Error("NewLRU(0) cached a value")
+	}
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Cache that evicts the least recently used entry once
+// it holds its maximum. Each process has its own, so saves made by another
+// instance only show up when entries expire; use Redis to share one.
+type LRU struct {
+	max int
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	tagged  map[string]map[string]struct{} // tag to keys
+	version map[string]uint64
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+	tags    []string
+}
+
+// NewLRU holds up to max entries; 0 caches nothing
+func NewLRU(max int) *LRU {
+	return &LRU{
+		max:     max,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+		tagged:  map[string]map[string]struct{}{},
+		version: map[string]uint64{},
+	}
+}
+
+func (c *LRU) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *LRU) Versions(tags ...string) []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]uint64, len(tags))
+	for i, tag := range tags {
+		out[i] = c.version[tag]
+	}
+	return out
+}
+
+func (c *LRU) Set(key string, value []byte, ttl time.Duration, tags []string, versions []uint64) {
+	if c.max <= 0 || ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, tag := range tags {
+		if i < len(versions) && c.version[tag] != versions[i] {
+			return
+		}
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: time.Now().Add(ttl), tags: tags})
+	for _, tag := range tags {
+		if c.tagged[tag] == nil {
+			c.tagged[tag] = map[string]struct{}{}
+		}
+		c.tagged[tag][key] = struct{}{}
+	}
+	for c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU) Invalidate(tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tag := range tags {
+		c.version[tag]++
+		for key := range c.tagged[tag] {
+			c.remove(c.entries[key])
+		}
+	}
+}
+
+func (c *LRU) remove(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry)
+	delete(c.entries, e.key)
+	for _, tag := range e.tags {
+		delete(c.tagged[tag], e.key)
+		if len(c.tagged[tag]) == 0 {
+			delete(c.tagged, tag)
+		}
+	}
+}
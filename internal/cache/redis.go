@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisPrefix namespaces keys on a shared Redis
+	redisPrefix = "stocksaas:"
+	// redisTimeout bounds each call, so a slow Redis costs a miss rather
+	// than a stuck request
+	redisTimeout = 250 * time.Millisecond
+	// redisTagTTL outlives any entry and any load; a tag set only lists keys
+	// to delete, and an expired version reads as 0, which no load in flight
+	// can still hold
+	redisTagTTL = 48 * time.Hour
+	// redisPopBatch is how many keys an invalidation deletes per round trip
+	redisPopBatch = 500
+)
+
+// Redis is a Cache shared by every instance, so a save on one invalidates
+// all of them. Each tag is a set of the keys carrying it plus a version
+// counter.
+type Redis struct {
+	client *redis.Client
+}
+
+// setIfCurrent writes an entry and tags it only while every tag is still at
+// the version the caller read. KEYS are the entry, then n tag sets, then n
+// version counters; ARGV are the value, TTL in ms, tag TTL in s, then the n
+// versions. Running as one script, it lands either before an Invalidate
+// (which then deletes it) or after one (and sees the new version).
+var setIfCurrent = redis.NewScript(`
+local n = (#KEYS - 1) / 2
+for i = 1, n do
+	if tonumber(redis.call('GET', KEYS[1 + n + i]) or '0') ~= tonumber(ARGV[3 + i]) then
+		return 0
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+for i = 1, n do
+	redis.call('SADD', KEYS[1 + i], KEYS[1])
+	redis.call('EXPIRE', KEYS[1 + i], ARGV[3])
+end
+return 1
+`)
+
+func tagKey(tag string) string     { return redisPrefix + "tag:" + tag }
+func versionKey(tag string) string { return redisPrefix + "version:" + tag }
+
+// NewRedis connects to a redis:// or rediss:// URL and checks it answers
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	value, err := r.client.Get(ctx, redisPrefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Error reading %s from Redis: %v", key, err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+func (r *Redis) Versions(tags ...string) []uint64 {
+	out := make([]uint64, len(tags))
+	if len(tags) == 0 {
+		return out
+	}
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = versionKey(tag)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("Error reading tag versions from Redis: %v", err)
+		return out
+	}
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			out[i], _ = strconv.ParseUint(s, 10, 64)
+		}
+	}
+	return out
+}
+
+func (r *Redis) Set(key string, value []byte, ttl time.Duration, tags []string, versions []uint64) {
+	if ttl <= 0 {
+		return
+	}
+	keys := []string{redisPrefix + key}
+	args := []interface{}{value, ttl.Milliseconds(), int(redisTagTTL.Seconds())}
+	for _, tag := range tags {
+		keys = append(keys, tagKey(tag))
+	}
+	for i, tag := range tags {
+		keys = append(keys, versionKey(tag))
+		var v uint64
+		if i < len(versions) {
+			v = versions[i]
+		}
+		args = append(args, v)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := setIfCurrent.Run(ctx, r.client, keys, args...).Err(); err != nil {
+		log.Printf("Error writing %s to Redis: %v", key, err)
+	}
+}
+
+// Invalidate bumps each tag's version, then pops keys off its set and
+// deletes them. Popping, rather than reading the set and then deleting it,
+// keeps keys tagged meanwhile.
+func (r *Redis) Invalidate(tags ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 4*redisTimeout)
+	defer cancel()
+	for _, tag := range tags {
+		if _, err := r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Incr(ctx, versionKey(tag))
+			p.Expire(ctx, versionKey(tag), redisTagTTL)
+			return nil
+		}); err != nil {
+			log.Printf("Error invalidating %s in Redis: %v", tag, err)
+		}
+		for {
+			keys, err := r.client.SPopN(ctx, tagKey(tag), redisPopBatch).Result()
+			if err != nil {
+				log.Printf("Error invalidating %s in Redis: %v", tag, err)
+				break
+			}
+			if len(keys) == 0 {
+				break
+			}
+			if err := r.client.Del(ctx, keys...).Err(); err != nil {
+				log.Printf("Error invalidating %s in Redis: %v", tag, err)
+				break
+			}
+		}
+	}
+}
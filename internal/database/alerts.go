@@ -0,0 +1,207 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type AlertRule struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	Ticker          string     `json:"ticker"`
+	Kind            string     `json:"kind"`
+	Threshold       float64    `json:"threshold"`
+	Period          int        `json:"period"`
+	CooldownMinutes int        `json:"cooldown_minutes"`
+	Active          bool       `json:"active"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type AlertTrigger struct {
+	ID          int       `json:"id"`
+	RuleID      int       `json:"rule_id"`
+	UserID      int       `json:"user_id"`
+	Ticker      string    `json:"ticker"`
+	Kind        string    `json:"kind"`
+	BarDate     string    `json:"bar_date"`
+	Value       float64   `json:"value"`
+	Message     string    `json:"message"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// Bar is one stored daily close, used by the alert engine
+type Bar struct {
+	Date  time.Time
+	Close float64
+}
+
+const alertRuleColumns = `id, user_id, ticker, kind, threshold, period, cooldown_minutes, active, last_triggered_at, created_at`
+
+func scanAlertRule(row interface{ Scan(...interface{}) error }) (*AlertRule, error) {
+	var r AlertRule
+	err := row.Scan(&r.ID, &r.UserID, &r.Ticker, &r.Kind, &r.Threshold, &r.Period,
+		&r.CooldownMinutes, &r.Active, &r.LastTriggeredAt, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func queryAlertRules(query string, args ...interface{}) ([]AlertRule, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []AlertRule{}
+	for rows.Next() {
+		r, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *r)
+	}
+	return rules, rows.Err()
+}
+
+func CreateAlertRule(r *AlertRule) (*AlertRule, error) {
+	query := `
+		INSERT INTO alert_rules (user_id, ticker, kind, threshold, period, cooldown_minutes, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + alertRuleColumns
+
+	return scanAlertRule(DB.QueryRow(query, r.UserID, r.Ticker, r.Kind, r.Threshold, r.Period, r.CooldownMinutes, r.Active))
+}
+
+func UpdateAlertRule(r *AlertRule) (*AlertRule, error) {
+	query := `
+		UPDATE alert_rules
+		SET ticker = $3, kind = $4, threshold = $5, period = $6, cooldown_minutes = $7, active = $8
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + alertRuleColumns
+
+	updated, err := scanAlertRule(DB.QueryRow(query, r.ID, r.UserID, r.Ticker, r.Kind, r.Threshold, r.Period, r.CooldownMinutes, r.Active))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return updated, err
+}
+
+func GetAlertRule(userID, id int) (*AlertRule, error) {
+	r, err := scanAlertRule(DB.QueryRow(`SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = $1 AND user_id = $2`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+func DeleteAlertRule(userID, id int) error {
+	return execAffectingOne(`DELETE FROM alert_rules WHERE id = $1 AND user_id = $2`, id, userID)
+}
+
+func ListAlertRules(userID int) ([]AlertRule, error) {
+	return queryAlertRules(`SELECT `+alertRuleColumns+` FROM alert_rules WHERE user_id = $1 ORDER BY created_at ASC`, userID)
+}
+
+// ActiveAlertRulesForTicker returns every user's active rules on a ticker
+func ActiveAlertRulesForTicker(ticker string) ([]AlertRule, error) {
+	return queryAlertRules(`SELECT `+alertRuleColumns+` FROM alert_rules WHERE ticker = $1 AND active ORDER BY id ASC`, ticker)
+}
+
+// GetRecentBars returns up to limit of the latest closes, oldest first
+func GetRecentBars(ticker string, limit int) ([]Bar, error) {
+	query := `
+		SELECT date, close FROM (
+			SELECT date, close
+			FROM stocks
+			WHERE ticker = $1
+			ORDER BY date DESC
+			LIMIT $2
+		) recent
+		ORDER BY date ASC
+	`
+
+	rows, err := DB.Query(query, ticker, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bars []Bar
+	for rows.Next() {
+		var b Bar
+		if err := rows.Scan(&b.Date, &b.Close); err != nil {
+			return nil, err
+		}
+		bars = append(bars, b)
+	}
+	return bars, rows.Err()
+}
+
+// RecordAlertTrigger stores a trigger unless the rule already fired for this
+// bar, and stamps the rule's last trigger time. It reports whether a new
+// trigger was recorded.
+func RecordAlertTrigger(t *AlertTrigger) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO alert_triggers (rule_id, user_id, ticker, kind, bar_date, value, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (rule_id, bar_date) DO NOTHING
+		RETURNING id, triggered_at
+	`, t.RuleID, t.UserID, t.Ticker, t.Kind, t.BarDate, t.Value, t.Message).Scan(&t.ID, &t.TriggeredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`UPDATE alert_rules SET last_triggered_at = $2 WHERE id = $1`, t.RuleID, t.TriggeredAt); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ListAlertTriggers returns the user's trigger history, newest first,
+// optionally limited to one rule
+func ListAlertTriggers(userID, ruleID, limit int) ([]AlertTrigger, error) {
+	query := `
+		SELECT id, rule_id, user_id, ticker, kind, bar_date, value, message, triggered_at
+		FROM alert_triggers
+		WHERE user_id = $1 AND ($2 = 0 OR rule_id = $2)
+		ORDER BY triggered_at DESC
+		LIMIT $3
+	`
+
+	rows, err := DB.Query(query, userID, ruleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	triggers := []AlertTrigger{}
+	for rows.Next() {
+		var t AlertTrigger
+		var barDate time.Time
+		if err := rows.Scan(&t.ID, &t.RuleID, &t.UserID, &t.Ticker, &t.Kind, &barDate, &t.Value, &t.Message, &t.TriggeredAt); err != nil {
+			return nil, err
+		}
+		t.BarDate = barDate.Format("2006-01-02")
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
+
+func CountAlertRules(userID int) (int, error) {
+	var n int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM alert_rules WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
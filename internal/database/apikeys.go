@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type APIKeyUsage struct {
+	Route string `json:"route"`
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// ErrTooManyAPIKeys is returned when a user already has the most active keys
+// allowed
+var ErrTooManyAPIKeys = errors.New("too many active API keys")
+
+// CreateAPIKey stores a key unless the user already has maxActive unrevoked
+// ones. The user's row is locked while counting, so concurrent creates can't
+// both squeeze under the cap.
+func CreateAPIKey(userID int, name, prefix, keyHash string, maxActive int) (*APIKey, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return nil, err
+	}
+	var active int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL`, userID).Scan(&active); err != nil {
+		return nil, err
+	}
+	if active >= maxActive {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	var k APIKey
+	err = tx.QueryRow(`
+		INSERT INTO api_keys (user_id, name, prefix, key_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, name, prefix, created_at, last_used_at, revoked_at
+	`, userID, name, prefix, keyHash).Scan(
+		&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &k, tx.Commit()
+}
+
+func ListAPIKeys(userID int) ([]APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, created_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of the user's keys
+func RevokeAPIKey(userID, keyID int) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	res, err := DB.Exec(query, keyID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey finds the active key with this hash, records that it
+// was used and returns it with its owner
+func AuthenticateAPIKey(keyHash string) (*APIKey, *User, error) {
+	query := `
+		UPDATE api_keys k
+		SET last_used_at = CURRENT_TIMESTAMP
+		FROM users u
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND u.id = k.user_id
+		RETURNING k.id, k.user_id, k.name, k.prefix, k.created_at, k.last_used_at, k.revoked_at,
+			u.id, u.email, u.role, u.created_at
+	`
+
+	var k APIKey
+	var u User
+	err := DB.QueryRow(query, keyHash).Scan(
+		&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt,
+		&u.ID, &u.Email, &u.Role, &u.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &k, &u, nil
+}
+
+// IncrementAPIKeyUsage bumps today's counter for a key and route and returns
+// the new count
+func IncrementAPIKeyUsage(keyID int, route string) (int, error) {
+	query := `
+		INSERT INTO api_key_usage (api_key_id, route, day, count)
+		VALUES ($1, $2, CURRENT_DATE, 1)
+		ON CONFLICT (api_key_id, route, day) DO UPDATE
+		SET count = api_key_usage.count + 1
+		RETURNING count
+	`
+
+	var count int
+	err := DB.QueryRow(query, keyID, route).Scan(&count)
+	return count, err
+}
+
+// GetAPIKeyUsage returns daily counters for the user's key over the last
+// days, or ErrNotFound if the user has no such key
+func GetAPIKeyUsage(userID, keyID, days int) ([]APIKeyUsage, error) {
+	var owned bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1 AND user_id = $2)`, keyID, userID).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, ErrNotFound
+	}
+
+	query := `
+		SELECT u.route, u.day, u.count
+		FROM api_key_usage u
+		WHERE u.api_key_id = $1 AND u.day > CURRENT_DATE - $2::int
+		ORDER BY u.day DESC, u.route ASC
+	`
+
+	rows, err := DB.Query(query, keyID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []APIKeyUsage{}
+	for rows.Next() {
+		var u APIKeyUsage
+		var day time.Time
+		if err := rows.Scan(&u.Route, &day, &u.Count); err != nil {
+			return nil, err
+		}
+		u.Day = day.Format("2006-01-02")
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditEntry is one row of the append-only audit log
+type AuditEntry struct {
+	ID           int64           `json:"id"`
+	OccurredAt   time.Time       `json:"occurred_at"`
+	UserID       *int            `json:"user_id"`
+	APIKeyID     *int            `json:"api_key_id,omitempty"`
+	Principal    string          `json:"principal"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	RequestID    string          `json:"request_id"`
+	IP           string          `json:"ip"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	Status       int             `json:"status"`
+	Diff         json.RawMessage `json:"diff,omitempty"`
+}
+
+// AuditFilter narrows ListAuditEntries; zero values don't filter. BeforeID
+// is the pagination cursor: only entries with a smaller ID are returned.
+type AuditFilter struct {
+	UserID       int
+	Action       string
+	ResourceType string
+	ResourceID   string
+	RequestID    string
+	Since        time.Time
+	Until        time.Time
+	BeforeID     int64
+	Limit        int
+}
+
+func InsertAuditEntry(e *AuditEntry) error {
+	query := `
+		INSERT INTO audit_log
+			(user_id, api_key_id, principal, action, resource_type, resource_id, request_id, ip, method, path, status, diff)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, occurred_at
+	`
+
+	var diff []byte
+	if len(e.Diff) > 0 {
+		diff = e.Diff
+	}
+	return DB.QueryRow(query, e.UserID, e.APIKeyID, e.Principal, e.Action, e.ResourceType, e.ResourceID,
+		e.RequestID, e.IP, e.Method, e.Path, e.Status, diff).Scan(&e.ID, &e.OccurredAt)
+}
+
+// ListAuditEntries returns matching entries, newest first
+func ListAuditEntries(f AuditFilter) ([]AuditEntry, error) {
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if f.UserID != 0 {
+		add("user_id = ?", f.UserID)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.ResourceType != "" {
+		add("resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceID != "" {
+		add("resource_id = ?", f.ResourceID)
+	}
+	if f.RequestID != "" {
+		add("request_id = ?", f.RequestID)
+	}
+	if !f.Since.IsZero() {
+		add("occurred_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("occurred_at < ?", f.Until)
+	}
+	if f.BeforeID != 0 {
+		add("id < ?", f.BeforeID)
+	}
+
+	query := `
+		SELECT id, occurred_at, user_id, api_key_id, principal, action, resource_type, resource_id,
+			request_id, ip, method, path, status, diff
+		FROM audit_log`
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += "\n\t\tORDER BY id DESC\n\t\tLIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var diff []byte
+		if err := rows.Scan(&e.ID, &e.OccurredAt, &e.UserID, &e.APIKeyID, &e.Principal, &e.Action, &e.ResourceType,
+			&e.ResourceID, &e.RequestID, &e.IP, &e.Method, &e.Path, &e.Status, &diff); err != nil {
+			return nil, err
+		}
+		if len(diff) > 0 {
+			e.Diff = diff
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,224 @@
+package database
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/cache"
+	"github.com/lib/pq"
+)
+
+// How long cached reads live. Saving bars for a ticker drops its entries
+// sooner; the TTLs bound how stale saves made by another instance leave an
+// in-memory cache.
+const (
+	latestPriceTTL = time.Minute
+	stockRangeTTL  = time.Hour
+)
+
+// StockBar is one stored daily OHLCV row
+type StockBar struct {
+	Ticker string    `json:"ticker"`
+	Date   time.Time `json:"date"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume int64     `json:"volume"`
+}
+
+// StreamBars calls fn for each bar of tickers between start and end, in the
+// order the tickers are given and then by date, straight off the cursor so
+// long ranges aren't held in memory. An error from fn stops the scan and is
+// returned.
+func StreamBars(tickers []string, startDate, endDate string, fn func(StockBar) error) error {
+	rows, err := DB.Query(`
+        SELECT ticker, date, open, high, low, close, volume
+        FROM stocks
+        WHERE ticker = ANY($1) AND date BETWEEN $2 AND $3
+        ORDER BY array_position($1::text[], ticker::text), date
+    `, pq.Array(tickers), startDate, endDate)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b StockBar
+		if err := rows.Scan(&b.Ticker, &b.Date, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StockRange is one ticker's bars between two dates, YYYY-MM-DD. Version,
+// when set, is a RangeVersion the bars must be at least as new as.
+type StockRange struct {
+	Ticker  string
+	Start   string
+	End     string
+	Version string
+}
+
+// cacheKey includes the version, so a reader that has seen a newer one
+// misses entries cached before another process saved bars. Those saves
+// don't reach an in-memory cache, but they do change RangeVersion.
+func (r StockRange) cacheKey() string {
+	key := "bars:" + r.Ticker + ":" + r.Start + ":" + r.End
+	if r.Version != "" {
+		key += "@" + r.Version
+	}
+	return key
+}
+
+func (r StockRange) cacheTags() []string { return tickerTags(r.Ticker) }
+
+// GetStockRanges returns the bars of each range, nil for ranges with none.
+// Cached ranges are used as is and the rest are read with one query per
+// distinct pair of dates.
+func GetStockRanges(ranges []StockRange) (map[StockRange][]StockBar, error) {
+	return cache.FetchMany(ranges, StockRange.cacheKey, stockRangeTTL, StockRange.cacheTags, queryStockRanges)
+}
+
+func queryStockRanges(ranges []StockRange) (map[StockRange][]StockBar, error) {
+	type span struct{ start, end string }
+	bySpan := map[span]map[string][]StockRange{}
+	out := make(map[StockRange][]StockBar, len(ranges))
+	for _, r := range ranges {
+		s := span{r.Start, r.End}
+		if bySpan[s] == nil {
+			bySpan[s] = map[string][]StockRange{}
+		}
+		bySpan[s][r.Ticker] = append(bySpan[s][r.Ticker], r)
+		// Empty ranges are cached too, until bars arrive
+		out[r] = nil
+	}
+
+	for s, byTicker := range bySpan {
+		tickers := make([]string, 0, len(byTicker))
+		for t := range byTicker {
+			tickers = append(tickers, t)
+		}
+		err := StreamBars(tickers, s.start, s.end, func(b StockBar) error {
+			// The same ticker and dates may be asked for at several versions
+			for _, r := range byTicker[b.Ticker] {
+				out[r] = append(out[r], b)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// HasStockData reports whether any bar of ticker falls between start and end
+func HasStockData(ticker, startDate, endDate string) (bool, error) {
+	var ok bool
+	err := DB.QueryRow(`
+        SELECT EXISTS (SELECT 1 FROM stocks WHERE ticker = $1 AND date BETWEEN $2 AND $3)
+    `, ticker, startDate, endDate).Scan(&ok)
+	return ok, err
+}
+
+// RangeVersion returns how many bars of tickers fall between start and end
+// and when the newest of them was stored or revised. Together they change
+// whenever the range's data does, so they can stand in for it in an ETag
+// and, through FormatRangeVersion, in StockRange.Version.
+func RangeVersion(tickers []string, startDate, endDate string) (int, time.Time, error) {
+	var count int
+	var modified time.Time
+	err := DB.QueryRow(`
+        SELECT count(*), coalesce(max(updated_at), 'epoch')
+        FROM stocks
+        WHERE ticker = ANY($1) AND date BETWEEN $2 AND $3
+    `, pq.Array(tickers), startDate, endDate).Scan(&count, &modified)
+	return count, modified, err
+}
+
+// FormatRangeVersion writes what RangeVersion returned as a StockRange
+// version
+func FormatRangeVersion(count int, modified time.Time) string {
+	return strconv.Itoa(count) + "-" + strconv.FormatInt(modified.UnixMicro(), 10)
+}
+
+// LatestPrice is a ticker's most recent stored close and the one before it
+type LatestPrice struct {
+	Ticker    string
+	Date      time.Time
+	Close     float64
+	PrevClose float64 // 0 when only one bar is stored
+}
+
+// Change is the percent move from the previous close, 0 without one
+func (p LatestPrice) Change() float64 {
+	if p.PrevClose <= 0 {
+		return 0
+	}
+	return (p.Close - p.PrevClose) / p.PrevClose * 100
+}
+
+// GetLatestPrice returns ErrNotFound if nothing is stored for ticker
+func GetLatestPrice(ticker string) (LatestPrice, error) {
+	prices, err := GetLatestPrices([]string{ticker})
+	if err != nil {
+		return LatestPrice{}, err
+	}
+	p, ok := prices[ticker]
+	if !ok {
+		return LatestPrice{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// GetLatestPrices is GetLatestPrice for many tickers. Cached prices are
+// used as is and the rest are read in one query. Tickers with nothing
+// stored are left out of the map.
+func GetLatestPrices(tickers []string) (map[string]LatestPrice, error) {
+	return cache.FetchMany(tickers, latestPriceKey, latestPriceTTL, tickerTags, queryLatestPrices)
+}
+
+func latestPriceKey(ticker string) string { return "latest:" + ticker }
+
+func tickerTags(ticker string) []string { return []string{cache.TickerTag(ticker)} }
+
+func queryLatestPrices(tickers []string) (map[string]LatestPrice, error) {
+	rows, err := DB.Query(`
+        SELECT t.ticker, l.date, l.closes
+        FROM unnest($1::text[]) AS t(ticker)
+        CROSS JOIN LATERAL (
+            SELECT max(date) AS date, array_agg(close ORDER BY date DESC) AS closes
+            FROM (
+                SELECT date, close FROM stocks s
+                WHERE s.ticker = t.ticker
+                ORDER BY date DESC
+                LIMIT 2
+            ) last2
+        ) l
+        WHERE l.date IS NOT NULL
+    `, pq.Array(tickers))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := make(map[string]LatestPrice, len(tickers))
+	for rows.Next() {
+		var p LatestPrice
+		var closes pq.Float64Array
+		if err := rows.Scan(&p.Ticker, &p.Date, &closes); err != nil {
+			return nil, err
+		}
+		p.Close = closes[0]
+		if len(closes) > 1 {
+			p.PrevClose = closes[1]
+		}
+		prices[p.Ticker] = p
+	}
+	return prices, rows.Err()
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Subscription is a user's paid plan as last reported by the billing provider
+type Subscription struct {
+	UserID           int        `json:"user_id"`
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	Provider         string     `json:"provider"`
+	ProviderID       string     `json:"provider_subscription_id"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func GetSubscription(userID int) (*Subscription, error) {
+	query := `
+		SELECT user_id, plan, status, provider, provider_subscription_id, current_period_end, updated_at
+		FROM subscriptions
+		WHERE user_id = $1
+	`
+
+	var s Subscription
+	err := DB.QueryRow(query, userID).Scan(&s.UserID, &s.Plan, &s.Status, &s.Provider, &s.ProviderID, &s.CurrentPeriodEnd, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func UpsertSubscription(s *Subscription) error {
+	query := `
+		INSERT INTO subscriptions (user_id, plan, status, provider, provider_subscription_id, current_period_end, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE
+		SET plan = EXCLUDED.plan, status = EXCLUDED.status, provider = EXCLUDED.provider,
+			provider_subscription_id = EXCLUDED.provider_subscription_id,
+			current_period_end = EXCLUDED.current_period_end, updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := DB.Exec(query, s.UserID, s.Plan, s.Status, s.Provider, s.ProviderID, s.CurrentPeriodEnd)
+	return err
+}
+
+// RecordBillingEvent stores a provider webhook event and reports whether it
+// is new; providers retry deliveries, so duplicates must be ignored
+func RecordBillingEvent(id, eventType string, payload []byte) (bool, error) {
+	query := `
+		INSERT INTO billing_events (id, type, payload)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO NOTHING
+	`
+	res, err := DB.Exec(query, id, eventType, payload)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// IncrementPlanUsage bumps today's counter for a subject ("user:42" or
+// "ip:203.0.113.9") and metric, returning the new count
+func IncrementPlanUsage(subject, metric string) (int, error) {
+	query := `
+		INSERT INTO plan_usage (subject, metric, day, count)
+		VALUES ($1, $2, CURRENT_DATE, 1)
+		ON CONFLICT (subject, metric, day) DO UPDATE
+		SET count = plan_usage.count + 1
+		RETURNING count
+	`
+
+	var count int
+	err := DB.QueryRow(query, subject, metric).Scan(&count)
+	return count, err
+}
+
+// GetPlanUsage returns today's counter for a subject and metric
+func GetPlanUsage(subject, metric string) (int, error) {
+	var count int
+	err := DB.QueryRow(`SELECT count FROM plan_usage WHERE subject = $1 AND metric = $2 AND day = CURRENT_DATE`, subject, metric).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return count, err
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SavedComparison is a stored comparison definition with its last AI analysis
+type SavedComparison struct {
+	ID            int             `json:"id"`
+	UserID        int             `json:"user_id"`
+	OrgID         *int            `json:"org_id"`
+	Slug          string          `json:"slug"`
+	Title         string          `json:"title"`
+	Tickers       []string        `json:"tickers"`
+	StartDate     string          `json:"start_date"`
+	EndDate       string          `json:"end_date"`
+	Preset        string          `json:"preset"`
+	Template      string          `json:"template"`
+	Normalization string          `json:"normalization"`
+	Visibility    string          `json:"visibility"`
+	Analysis      json.RawMessage `json:"analysis"`
+	AnalyzedAt    *time.Time      `json:"analyzed_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+const savedComparisonColumns = `
+	id, user_id, org_id, slug, title, tickers, start_date, end_date, preset, template,
+	normalization, visibility, analysis, analyzed_at, created_at, updated_at`
+
+func scanSavedComparison(row interface{ Scan(...interface{}) error }) (*SavedComparison, error) {
+	var sc SavedComparison
+	var start, end time.Time
+	var analysis []byte
+	err := row.Scan(
+		&sc.ID, &sc.UserID, &sc.OrgID, &sc.Slug, &sc.Title, pq.Array(&sc.Tickers), &start, &end, &sc.Preset, &sc.Template,
+		&sc.Normalization, &sc.Visibility, &analysis, &sc.AnalyzedAt, &sc.CreatedAt, &sc.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	sc.StartDate = start.Format("2006-01-02")
+	sc.EndDate = end.Format("2006-01-02")
+	if len(analysis) > 0 {
+		sc.Analysis = analysis
+	}
+	return &sc, nil
+}
+
+func CreateSavedComparison(sc *SavedComparison) (*SavedComparison, error) {
+	query := `
+		INSERT INTO saved_comparisons
+			(user_id, org_id, slug, title, tickers, start_date, end_date, preset, template, normalization, visibility)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING` + savedComparisonColumns
+
+	return scanSavedComparison(DB.QueryRow(query,
+		sc.UserID, sc.OrgID, sc.Slug, sc.Title, pq.Array(sc.Tickers), sc.StartDate, sc.EndDate,
+		sc.Preset, sc.Template, sc.Normalization, sc.Visibility,
+	))
+}
+
+// UpdateSavedComparison replaces the definition and visibility of a
+// comparison, keeping its owner, slug and saved analysis
+func UpdateSavedComparison(sc *SavedComparison) (*SavedComparison, error) {
+	query := `
+		UPDATE saved_comparisons
+		SET title = $2, tickers = $3, start_date = $4, end_date = $5, preset = $6,
+			template = $7, normalization = $8, visibility = $9, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING` + savedComparisonColumns
+
+	updated, err := scanSavedComparison(DB.QueryRow(query,
+		sc.ID, sc.Title, pq.Array(sc.Tickers), sc.StartDate, sc.EndDate,
+		sc.Preset, sc.Template, sc.Normalization, sc.Visibility,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return updated, err
+}
+
+func SaveComparisonAnalysis(id int, analysis []byte) error {
+	query := `
+		UPDATE saved_comparisons
+		SET analysis = $2, analyzed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	return execAffectingOne(query, id, analysis)
+}
+
+func DeleteSavedComparison(id int) error {
+	return execAffectingOne(`DELETE FROM saved_comparisons WHERE id = $1`, id)
+}
+
+// GetSavedComparison loads a comparison by ID. Callers check access.
+func GetSavedComparison(id int) (*SavedComparison, error) {
+	query := `SELECT` + savedComparisonColumns + ` FROM saved_comparisons WHERE id = $1`
+	sc, err := scanSavedComparison(DB.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return sc, err
+}
+
+func GetSavedComparisonBySlug(slug string) (*SavedComparison, error) {
+	query := `SELECT` + savedComparisonColumns + ` FROM saved_comparisons WHERE slug = $1`
+	sc, err := scanSavedComparison(DB.QueryRow(query, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return sc, err
+}
+
+// ListSavedComparisons returns the user's personal comparisons and those of
+// their organizations
+func ListSavedComparisons(userID int) ([]SavedComparison, error) {
+	query := `SELECT` + savedComparisonColumns + ` FROM saved_comparisons WHERE ` + accessibleTo + ` ORDER BY updated_at DESC`
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []SavedComparison{}
+	for rows.Next() {
+		sc, err := scanSavedComparison(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *sc)
+	}
+	return list, rows.Err()
+}
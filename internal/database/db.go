@@ -7,6 +7,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/chuma-beep/stock-saas/internal/cache"
 	_ "github.com/lib/pq"
 )
 
@@ -43,53 +44,125 @@ func Close() {
 	}
 }
 
-func SaveStock(ticker string, date time.Time, open, high, low, close float64, volume int64) error {
-	query := `
+// saveStockQuery leaves unchanged bars alone, so refetching a range doesn't
+// bump updated_at and invalidate ETags built from it
+const saveStockQuery = `
         INSERT INTO stocks (ticker, date, open, high, low, close, volume)
         VALUES ($1, $2, $3, $4, $5, $6, $7)
         ON CONFLICT (ticker, date) DO UPDATE
-        SET open = $3, high = $4, low = $5, close = $6, volume = $7
+        SET open = $3, high = $4, low = $5, close = $6, volume = $7, updated_at = CURRENT_TIMESTAMP
+        WHERE (stocks.open, stocks.high, stocks.low, stocks.close, stocks.volume) IS DISTINCT FROM ($3, $4, $5, $6, $7)
     `
 
-	_, err := DB.Exec(query, ticker, date, open, high, low, close, volume)
+// saveHooks run after bars are stored, see OnStocksSaved
+var saveHooks []func(tickers []string)
+
+// OnStocksSaved registers fn to be called with the tickers whose bars were
+// just stored. Hooks must be registered at startup and must not block.
+func OnStocksSaved(fn func(tickers []string)) {
+	saveHooks = append(saveHooks, fn)
+}
+
+func stocksSaved(tickers []string) {
+	// Before the hooks, so they read the new bars
+	cache.InvalidateTickers(tickers)
+	StocksSaved(tickers)
+}
+
+// StocksSaved runs the save hooks for tickers stored with StoreStockBatch
+func StocksSaved(tickers []string) {
+	if len(tickers) == 0 {
+		return
+	}
+	for _, fn := range saveHooks {
+		fn(tickers)
+	}
+}
+
+func SaveStock(ticker string, date time.Time, open, high, low, close float64, volume int64) error {
+	_, err := DB.Exec(saveStockQuery, ticker, date, open, high, low, close, volume)
+	if err == nil {
+		stocksSaved([]string{ticker})
+	}
 	return err
 }
 
+// SaveStockBatch upserts bars like SaveStock, in one transaction
+func SaveStockBatch(bars []StockBar) error {
+	if err := StoreStockBatch(bars); err != nil {
+		return err
+	}
+	StocksSaved(batchTickers(bars))
+	return nil
+}
+
+// StoreStockBatch is SaveStockBatch without the save hooks, for callers
+// that store one upload in many batches: they call StocksSaved once at the
+// end rather than once per batch. Cached reads are still dropped per batch.
+func StoreStockBatch(bars []StockBar) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(saveStockQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, b := range bars {
+		if _, err := stmt.Exec(b.Ticker, b.Date, b.Open, b.High, b.Low, b.Close, b.Volume); err != nil {
+			return fmt.Errorf("saving %s %s: %w", b.Ticker, b.Date.Format("2006-01-02"), err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	cache.InvalidateTickers(batchTickers(bars))
+	return nil
+}
+
+// batchTickers lists the distinct tickers of bars in order
+func batchTickers(bars []StockBar) []string {
+	var tickers []string
+	seen := map[string]bool{}
+	for _, b := range bars {
+		if !seen[b.Ticker] {
+			seen[b.Ticker] = true
+			tickers = append(tickers, b.Ticker)
+		}
+	}
+	return tickers
+}
+
+// GetStockData returns ticker's bars between start and end as JSON-ready
+// rows, from the cache when it has them
 func GetStockData(ticker, startDate, endDate string) ([]map[string]interface{}, error) {
-	query := `
-        SELECT ticker, date, open, high, low, close, volume
-        FROM stocks
-        WHERE ticker = $1 AND date BETWEEN $2 AND $3
-        ORDER BY date ASC
-    `
+	return GetStockDataAt(ticker, startDate, endDate, "")
+}
 
-	rows, err := DB.Query(query, ticker, startDate, endDate)
+// GetStockDataAt is GetStockData for a response labelled with version (see
+// FormatRangeVersion), so the rows are never older than its ETag says
+func GetStockDataAt(ticker, startDate, endDate, version string) ([]map[string]interface{}, error) {
+	r := StockRange{Ticker: ticker, Start: startDate, End: endDate, Version: version}
+	ranges, err := GetStockRanges([]StockRange{r})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	var results []map[string]interface{}
-	for rows.Next() {
-		var ticker string
-		var date time.Time
-		var open, high, low, close float64
-		var volume int64
-
-		if err := rows.Scan(&ticker, &date, &open, &high, &low, &close, &volume); err != nil {
-			return nil, err
-		}
-
+	for _, b := range ranges[r] {
 		results = append(results, map[string]interface{}{
-			"ticker": ticker,
-			"date":   date.Format("2006-01-02"),
-			"open":   open,
-			"high":   high,
-			"low":    low,
-			"close":  close,
-			"volume": volume,
+			"ticker": b.Ticker,
+			"date":   b.Date.Format("2006-01-02"),
+			"open":   b.Open,
+			"high":   b.High,
+			"low":    b.Low,
+			"close":  b.Close,
+			"volume": b.Volume,
 		})
 	}
-
 	return results, nil
 }
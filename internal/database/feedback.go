@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Feedback moderation statuses
+const (
+	FeedbackNew      = "new"
+	FeedbackTriaged  = "triaged"
+	FeedbackResolved = "resolved"
+	FeedbackSpam     = "spam"
+)
+
+var FeedbackStatuses = []string{FeedbackNew, FeedbackTriaged, FeedbackResolved, FeedbackSpam}
+
+type Feedback struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Feedback  string     `json:"feedback"`
+	Status    string     `json:"status"`
+	Notes     string     `json:"notes"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// FeedbackFilter narrows ListFeedback; zero values don't filter. Query
+// matches name, email or text case-insensitively; BeforeID is the cursor.
+type FeedbackFilter struct {
+	Status   string
+	Query    string
+	BeforeID int
+	Limit    int
+}
+
+const feedbackColumns = `id, COALESCE(name, ''), COALESCE(email, ''), feedback, status, notes, created_at, updated_at`
+
+// CreateFeedback stores a submission with its initial status and notes
+func CreateFeedback(f *Feedback) (*Feedback, error) {
+	query := `
+		INSERT INTO feedback (name, email, feedback, status, notes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + feedbackColumns
+
+	return scanFeedback(DB.QueryRow(query, f.Name, f.Email, f.Feedback, f.Status, f.Notes))
+}
+
+func GetFeedback(id int) (*Feedback, error) {
+	query := `SELECT ` + feedbackColumns + ` FROM feedback WHERE id = $1`
+	f, err := scanFeedback(DB.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// ListFeedback returns matching feedback, newest first
+func ListFeedback(f FeedbackFilter) ([]Feedback, error) {
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if f.Status != "" {
+		add("status = ?", f.Status)
+	}
+	if f.Query != "" {
+		add("(name ILIKE ? OR email ILIKE ? OR feedback ILIKE ?)", "%"+escapeLike(f.Query)+"%")
+	}
+	if f.BeforeID != 0 {
+		add("id < ?", f.BeforeID)
+	}
+
+	query := `SELECT ` + feedbackColumns + ` FROM feedback`
+	if len(where) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += "\n\t\tORDER BY id DESC\n\t\tLIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feedback := []Feedback{}
+	for rows.Next() {
+		fb, err := scanFeedback(rows)
+		if err != nil {
+			return nil, err
+		}
+		feedback = append(feedback, *fb)
+	}
+	return feedback, rows.Err()
+}
+
+// UpdateFeedback sets the status and internal notes
+func UpdateFeedback(id int, status, notes string) (*Feedback, error) {
+	query := `
+		UPDATE feedback SET status = $2, notes = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + feedbackColumns
+
+	f, err := scanFeedback(DB.QueryRow(query, id, status, notes))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func scanFeedback(row interface{ Scan(...interface{}) error }) (*Feedback, error) {
+	var f Feedback
+	if err := row.Scan(&f.ID, &f.Name, &f.Email, &f.Feedback, &f.Status, &f.Notes, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// escapeLike makes s match literally inside a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// NotificationChannel is where a user wants notifications delivered: an
+// email address or a webhook URL. Events empty means every event.
+type NotificationChannel struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationDelivery is one attempt series to deliver an event to a channel
+type NotificationDelivery struct {
+	ID           int        `json:"id"`
+	ChannelID    int        `json:"channel_id"`
+	UserID       int        `json:"user_id"`
+	Event        string     `json:"event"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	ResponseCode int        `json:"response_code,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DeliveredAt  *time.Time `json:"delivered_at"`
+}
+
+const notificationChannelColumns = `id, user_id, kind, target, secret, events, enabled, created_at`
+
+func scanNotificationChannel(row interface{ Scan(...interface{}) error }) (*NotificationChannel, error) {
+	var ch NotificationChannel
+	err := row.Scan(&ch.ID, &ch.UserID, &ch.Kind, &ch.Target, &ch.Secret, pq.Array(&ch.Events), &ch.Enabled, &ch.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Events == nil {
+		ch.Events = []string{}
+	}
+	return &ch, nil
+}
+
+func queryNotificationChannels(query string, args ...interface{}) ([]NotificationChannel, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []NotificationChannel{}
+	for rows.Next() {
+		ch, err := scanNotificationChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, *ch)
+	}
+	return channels, rows.Err()
+}
+
+func CreateNotificationChannel(ch *NotificationChannel) (*NotificationChannel, error) {
+	query := `
+		INSERT INTO notification_channels (user_id, kind, target, secret, events, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + notificationChannelColumns
+
+	return scanNotificationChannel(DB.QueryRow(query, ch.UserID, ch.Kind, ch.Target, ch.Secret, pq.Array(ch.Events), ch.Enabled))
+}
+
+// UpdateNotificationChannel changes a channel's target, events and enabled
+// flag; the kind and signing secret stay the same
+func UpdateNotificationChannel(ch *NotificationChannel) (*NotificationChannel, error) {
+	query := `
+		UPDATE notification_channels
+		SET target = $3, events = $4, enabled = $5
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + notificationChannelColumns
+
+	updated, err := scanNotificationChannel(DB.QueryRow(query, ch.ID, ch.UserID, ch.Target, pq.Array(ch.Events), ch.Enabled))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return updated, err
+}
+
+func GetNotificationChannel(userID, id int) (*NotificationChannel, error) {
+	query := `SELECT ` + notificationChannelColumns + ` FROM notification_channels WHERE id = $1 AND user_id = $2`
+	ch, err := scanNotificationChannel(DB.QueryRow(query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return ch, err
+}
+
+func DeleteNotificationChannel(userID, id int) error {
+	return execAffectingOne(`DELETE FROM notification_channels WHERE id = $1 AND user_id = $2`, id, userID)
+}
+
+func ListNotificationChannels(userID int) ([]NotificationChannel, error) {
+	query := `SELECT ` + notificationChannelColumns + ` FROM notification_channels WHERE user_id = $1 ORDER BY created_at ASC`
+	return queryNotificationChannels(query, userID)
+}
+
+// ChannelsForEvent returns the user's enabled channels subscribed to event
+func ChannelsForEvent(userID int, event string) ([]NotificationChannel, error) {
+	query := `
+		SELECT ` + notificationChannelColumns + `
+		FROM notification_channels
+		WHERE user_id = $1 AND enabled AND (cardinality(events) = 0 OR $2 = ANY(events))
+		ORDER BY id ASC
+	`
+	return queryNotificationChannels(query, userID, event)
+}
+
+func LogNotificationDelivery(d *NotificationDelivery) error {
+	query := `
+		INSERT INTO notification_deliveries
+			(channel_id, user_id, event, status, attempts, response_code, error, delivered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	return DB.QueryRow(query, d.ChannelID, d.UserID, d.Event, d.Status, d.Attempts,
+		d.ResponseCode, d.Error, d.DeliveredAt).Scan(&d.ID, &d.CreatedAt)
+}
+
+// ListNotificationDeliveries returns the user's delivery log, newest first,
+// optionally limited to one channel
+func ListNotificationDeliveries(userID, channelID, limit int) ([]NotificationDelivery, error) {
+	query := `
+		SELECT id, channel_id, user_id, event, status, attempts, response_code, error, created_at, delivered_at
+		FROM notification_deliveries
+		WHERE user_id = $1 AND ($2 = 0 OR channel_id = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := DB.Query(query, userID, channelID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []NotificationDelivery{}
+	for rows.Next() {
+		var d NotificationDelivery
+		if err := rows.Scan(&d.ID, &d.ChannelID, &d.UserID, &d.Event, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.Error, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy *int      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role is the requesting user's role when listing their organizations
+	Role string `json:"role,omitempty"`
+}
+
+type OrgMember struct {
+	UserID  int       `json:"user_id"`
+	Email   string    `json:"email"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// CreateOrganization creates an organization with its creator as owner
+func CreateOrganization(name string, ownerID int, ownerRole string) (*Organization, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	org := Organization{Role: ownerRole}
+	err = tx.QueryRow(`
+		INSERT INTO organizations (name, created_by)
+		VALUES ($1, $2)
+		RETURNING id, name, created_by, created_at
+	`, name, ownerID).Scan(&org.ID, &org.Name, &org.CreatedBy, &org.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO org_members (org_id, user_id, role) VALUES ($1, $2, $3)`, org.ID, ownerID, ownerRole); err != nil {
+		return nil, err
+	}
+	return &org, tx.Commit()
+}
+
+func GetOrganization(id int) (*Organization, error) {
+	var org Organization
+	err := DB.QueryRow(`SELECT id, name, created_by, created_at FROM organizations WHERE id = $1`, id).
+		Scan(&org.ID, &org.Name, &org.CreatedBy, &org.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// ListOrganizationsForUser returns the organizations the user belongs to,
+// with their role in each
+func ListOrganizationsForUser(userID int) ([]Organization, error) {
+	query := `
+		SELECT o.id, o.name, o.created_by, o.created_at, m.role
+		FROM organizations o
+		JOIN org_members m ON m.org_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.name ASC
+	`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []Organization{}
+	for rows.Next() {
+		var org Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.CreatedBy, &org.CreatedAt, &org.Role); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+func RenameOrganization(id int, name string) error {
+	return execAffectingOne(`UPDATE organizations SET name = $2 WHERE id = $1`, id, name)
+}
+
+// DeleteOrganization removes the organization, its memberships and every
+// resource it owns
+func DeleteOrganization(id int) error {
+	return execAffectingOne(`DELETE FROM organizations WHERE id = $1`, id)
+}
+
+// GetOrgMemberRole returns the user's role in the organization
+func GetOrgMemberRole(orgID, userID int) (string, error) {
+	var role string
+	err := DB.QueryRow(`SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2`, orgID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return role, err
+}
+
+func ListOrgMembers(orgID int) ([]OrgMember, error) {
+	query := `
+		SELECT m.user_id, u.email, m.role, m.added_at
+		FROM org_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY m.added_at ASC
+	`
+
+	rows, err := DB.Query(query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []OrgMember{}
+	for rows.Next() {
+		var m OrgMember
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Role, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func AddOrgMember(orgID, userID int, role string) error {
+	_, err := DB.Exec(`INSERT INTO org_members (org_id, user_id, role) VALUES ($1, $2, $3)`, orgID, userID, role)
+	return err
+}
+
+func UpdateOrgMemberRole(orgID, userID int, role string) error {
+	return execAffectingOne(`UPDATE org_members SET role = $3 WHERE org_id = $1 AND user_id = $2`, orgID, userID, role)
+}
+
+func RemoveOrgMember(orgID, userID int) error {
+	return execAffectingOne(`DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`, orgID, userID)
+}
+
+func CountOrgMembersWithRole(orgID int, role string) (int, error) {
+	var n int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM org_members WHERE org_id = $1 AND role = $2`, orgID, role).Scan(&n)
+	return n, err
+}
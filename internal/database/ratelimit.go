@@ -0,0 +1,26 @@
+package database
+
+import "time"
+
+// IncrementRateLimit bumps key's counter for the current fixed window and
+// returns the new count and when the window resets. Older windows for the
+// key are dropped as it goes.
+func IncrementRateLimit(key string, window time.Duration) (int, time.Time, error) {
+	query := `
+		WITH win AS (
+			SELECT to_timestamp(floor(extract(epoch FROM now()) / $2::integer) * $2::integer) AS start
+		), pruned AS (
+			DELETE FROM rate_limits WHERE key = $1 AND window_start < (SELECT start FROM win)
+		)
+		INSERT INTO rate_limits (key, window_start, count)
+		SELECT $1, start, 1 FROM win
+		ON CONFLICT (key, window_start) DO UPDATE
+		SET count = rate_limits.count + 1
+		RETURNING count, window_start
+	`
+
+	var count int
+	var start time.Time
+	err := DB.QueryRow(query, key, int(window.Seconds())).Scan(&count, &start)
+	return count, start.Add(window), err
+}
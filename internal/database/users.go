@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a lookup matches no row
+var ErrNotFound = errors.New("not found")
+
+type User struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func CreateUser(email, passwordHash string) (*User, error) {
+	query := `
+		INSERT INTO users (email, password_hash)
+		VALUES ($1, $2)
+		RETURNING id, email, password_hash, role, created_at
+	`
+
+	var u User
+	err := DB.QueryRow(query, email, passwordHash).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func GetUserByEmail(email string) (*User, error) {
+	return getUser(`SELECT id, email, password_hash, role, created_at FROM users WHERE email = $1`, email)
+}
+
+func GetUserByID(id int) (*User, error) {
+	return getUser(`SELECT id, email, password_hash, role, created_at FROM users WHERE id = $1`, id)
+}
+
+func getUser(query string, arg interface{}) (*User, error) {
+	var u User
+	err := DB.QueryRow(query, arg).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.Role, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func SaveRefreshToken(userID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err := DB.Exec(query, userID, tokenHash, expiresAt)
+	return err
+}
+
+// ConsumeRefreshToken revokes a valid, unexpired refresh token and returns its
+// owner, so each refresh token can only be used once
+func ConsumeRefreshToken(tokenHash string) (int, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id
+	`
+
+	var userID int
+	err := DB.QueryRow(query, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Watchlist struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"user_id"`
+	OrgID     *int            `json:"org_id"`
+	Name      string          `json:"name"`
+	Items     []WatchlistItem `json:"items"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type WatchlistItem struct {
+	Symbol   string    `json:"symbol"`
+	Position int       `json:"position"`
+	Notes    string    `json:"notes"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// accessibleTo matches rows the user owns personally or that belong to one
+// of their organizations; the user ID must be $1
+const accessibleTo = `((user_id = $1 AND org_id IS NULL) OR org_id IN (SELECT org_id FROM org_members WHERE user_id = $1))`
+
+// CreateWatchlist creates a personal watchlist, or a shared one when orgID
+// is set, with its items in one transaction
+func CreateWatchlist(userID int, orgID *int, name string, items []WatchlistItem) (*Watchlist, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	w := Watchlist{Items: []WatchlistItem{}}
+	err = tx.QueryRow(`
+		INSERT INTO watchlists (user_id, org_id, name)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, org_id, name, created_at, updated_at
+	`, userID, orgID, name).Scan(&w.ID, &w.UserID, &w.OrgID, &w.Name, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertWatchlistItems(tx, w.ID, items); err != nil {
+		return nil, err
+	}
+	return &w, tx.Commit()
+}
+
+// ListWatchlists returns the user's personal watchlists and those of their
+// organizations, with their items
+func ListWatchlists(userID int) ([]Watchlist, error) {
+	query := `
+		SELECT id, user_id, org_id, name, created_at, updated_at
+		FROM watchlists
+		WHERE ` + accessibleTo + `
+		ORDER BY created_at ASC
+	`
+
+	rows, err := DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []Watchlist{}
+	for rows.Next() {
+		var w Watchlist
+		if err := rows.Scan(&w.ID, &w.UserID, &w.OrgID, &w.Name, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(lists))
+	for i, w := range lists {
+		ids[i] = int64(w.ID)
+	}
+	items, err := getWatchlistsItems(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range lists {
+		lists[i].Items = items[lists[i].ID]
+		if lists[i].Items == nil {
+			lists[i].Items = []WatchlistItem{}
+		}
+	}
+	return lists, nil
+}
+
+// GetWatchlist loads a watchlist with its items. Callers check access.
+func GetWatchlist(id int) (*Watchlist, error) {
+	query := `
+		SELECT id, user_id, org_id, name, created_at, updated_at
+		FROM watchlists
+		WHERE id = $1
+	`
+
+	var w Watchlist
+	err := DB.QueryRow(query, id).Scan(&w.ID, &w.UserID, &w.OrgID, &w.Name, &w.CreatedAt, &w.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Items, err = getWatchlistItems(w.ID); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func RenameWatchlist(id int, name string) error {
+	query := `
+		UPDATE watchlists
+		SET name = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+	return execAffectingOne(query, id, name)
+}
+
+func DeleteWatchlist(id int) error {
+	return execAffectingOne(`DELETE FROM watchlists WHERE id = $1`, id)
+}
+
+// ReplaceWatchlistItems sets the full, ordered list of symbols in one transaction
+func ReplaceWatchlistItems(id int, items []WatchlistItem) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE watchlists SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM watchlist_items WHERE watchlist_id = $1`, id); err != nil {
+		return err
+	}
+	if err := insertWatchlistItems(tx, id, items); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertWatchlistItems adds items to a watchlist in order
+func insertWatchlistItems(tx *sql.Tx, id int, items []WatchlistItem) error {
+	for i, item := range items {
+		_, err := tx.Exec(`
+			INSERT INTO watchlist_items (watchlist_id, symbol, position, notes)
+			VALUES ($1, $2, $3, $4)
+		`, id, item.Symbol, i, item.Notes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpsertWatchlistItem adds a symbol at the end of the list, or updates its notes
+func UpsertWatchlistItem(id int, symbol, notes string) error {
+	query := `
+		INSERT INTO watchlist_items (watchlist_id, symbol, position, notes)
+		SELECT w.id, $2, COALESCE((SELECT MAX(position) + 1 FROM watchlist_items WHERE watchlist_id = w.id), 0), $3
+		FROM watchlists w
+		WHERE w.id = $1
+		ON CONFLICT (watchlist_id, symbol) DO UPDATE
+		SET notes = EXCLUDED.notes
+	`
+	return execAffectingOne(query, id, symbol, notes)
+}
+
+func DeleteWatchlistItem(id int, symbol string) error {
+	query := `DELETE FROM watchlist_items WHERE watchlist_id = $1 AND symbol = $2`
+	return execAffectingOne(query, id, symbol)
+}
+
+// GetWatchlistSymbols returns the ordered symbols of a watchlist the user
+// can see
+func GetWatchlistSymbols(userID, id int) ([]string, error) {
+	var exists bool
+	err := DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM watchlists WHERE id = $2 AND `+accessibleTo+`)`, userID, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	items, err := getWatchlistItems(id)
+	if err != nil {
+		return nil, err
+	}
+	symbols := make([]string, len(items))
+	for i, item := range items {
+		symbols[i] = item.Symbol
+	}
+	return symbols, nil
+}
+
+func getWatchlistItems(watchlistID int) ([]WatchlistItem, error) {
+	query := `
+		SELECT symbol, position, notes, added_at
+		FROM watchlist_items
+		WHERE watchlist_id = $1
+		ORDER BY position ASC, symbol ASC
+	`
+
+	rows, err := DB.Query(query, watchlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []WatchlistItem{}
+	for rows.Next() {
+		var item WatchlistItem
+		if err := rows.Scan(&item.Symbol, &item.Position, &item.Notes, &item.AddedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// getWatchlistsItems loads the items of several watchlists in one query,
+// keyed by watchlist ID
+func getWatchlistsItems(ids []int64) (map[int][]WatchlistItem, error) {
+	query := `
+		SELECT watchlist_id, symbol, position, notes, added_at
+		FROM watchlist_items
+		WHERE watchlist_id = ANY($1)
+		ORDER BY watchlist_id, position ASC, symbol ASC
+	`
+
+	rows, err := DB.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := map[int][]WatchlistItem{}
+	for rows.Next() {
+		var id int
+		var item WatchlistItem
+		if err := rows.Scan(&id, &item.Symbol, &item.Position, &item.Notes, &item.AddedAt); err != nil {
+			return nil, err
+		}
+		items[id] = append(items[id], item)
+	}
+	return items, rows.Err()
+}
+
+// execAffectingOne runs a write and reports ErrNotFound when nothing matched
+func execAffectingOne(query string, args ...interface{}) error {
+	res, err := DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
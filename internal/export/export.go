@@ -0,0 +1,102 @@
+// Package export writes tabular results as CSV, JSON, XLSX or Parquet one
+// row at a time, so large date ranges stream from the database cursor to
+// the client without being built up in memory.
+package export
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Export formats
+const (
+	CSV     = "csv"
+	JSON    = "json"
+	XLSX    = "xlsx"
+	Parquet = "parquet"
+)
+
+// Formats lists what ?format= accepts
+var Formats = []string{CSV, JSON, XLSX, Parquet}
+
+// Kind is a column's type. Row values must be string, time.Time, float64
+// and int64 respectively.
+type Kind int
+
+const (
+	String Kind = iota
+	Date
+	Float
+	Int
+)
+
+// Column describes one output column
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// Writer writes rows in one format. Close flushes whatever the format keeps
+// until the end (the XLSX zip directory, the Parquet footer) and must be
+// called even when no rows were written.
+type Writer interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+// Valid reports whether format is one of Formats
+func Valid(format string) bool {
+	return slices.Contains(Formats, format)
+}
+
+// NewWriter starts a document named name (the XLSX sheet, the Parquet
+// schema) with the given columns
+func NewWriter(format string, w io.Writer, name string, cols []Column) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w, cols)
+	case JSON:
+		return newJSONWriter(w, cols), nil
+	case XLSX:
+		return newXLSXWriter(w, name, cols)
+	case Parquet:
+		return newParquetWriter(w, name, cols), nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// ContentType is the media type to send for format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSON:
+		return "application/json; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/octet-stream"
+}
+
+// dateFormat is how dates appear in the text formats
+const dateFormat = "2006-01-02"
+
+// text renders a value for CSV and XLSX inline strings
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(dateFormat)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowGroupSize bounds how many rows are buffered before a row group
+// is flushed to the client
+const parquetRowGroupSize = 50000
+
+type parquetWriter struct {
+	w     *parquet.Writer
+	index []int // column position in the schema, which orders leaves by name
+}
+
+func newParquetWriter(w io.Writer, name string, cols []Column) *parquetWriter {
+	group := parquet.Group{}
+	for _, c := range cols {
+		switch c.Kind {
+		case String:
+			group[c.Name] = parquet.String()
+		case Date:
+			group[c.Name] = parquet.Date()
+		case Float:
+			group[c.Name] = parquet.Leaf(parquet.DoubleType)
+		case Int:
+			group[c.Name] = parquet.Int(64)
+		}
+	}
+	schema := parquet.NewSchema(name, group)
+
+	pw := &parquetWriter{
+		w:     parquet.NewWriter(w, schema, parquet.Compression(&parquet.Snappy), parquet.MaxRowsPerRowGroup(parquetRowGroupSize)),
+		index: make([]int, len(cols)),
+	}
+	for i, c := range cols {
+		leaf, _ := schema.Lookup(c.Name)
+		pw.index[i] = leaf.ColumnIndex
+	}
+	return pw
+}
+
+func (pw *parquetWriter) Write(row []interface{}) error {
+	out := make(parquet.Row, len(row))
+	for i, v := range row {
+		var value parquet.Value
+		switch v := v.(type) {
+		case string:
+			value = parquet.ByteArrayValue([]byte(v))
+		case time.Time:
+			value = parquet.Int32Value(int32(v.Unix() / 86400))
+		case float64:
+			value = parquet.DoubleValue(v)
+		case int64:
+			value = parquet.Int64Value(v)
+		}
+		out[pw.index[i]] = value.Level(0, 0, pw.index[i])
+	}
+	_, err := pw.w.WriteRows([]parquet.Row{out})
+	return err
+}
+
+func (pw *parquetWriter) Close() error {
+	return pw.w.Close()
+}
@@ -0,0 +1,54 @@
+package export
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response streams an export as a file download. Nothing is sent until the
+// first row, so a query that fails or finds nothing can still be answered
+// with a normal error.
+type Response struct {
+	c        *gin.Context
+	format   string
+	filename string
+	name     string
+	cols     []Column
+	w        Writer
+}
+
+// NewResponse prepares a download of filename (without extension)
+func NewResponse(c *gin.Context, format, filename, name string, cols []Column) *Response {
+	return &Response{c: c, format: format, filename: filename, name: name, cols: cols}
+}
+
+// Write sends row, starting the download on the first call
+func (r *Response) Write(row []interface{}) error {
+	if r.w == nil {
+		r.c.Header("Content-Type", ContentType(r.format))
+		r.c.Header("Content-Disposition", `attachment; filename="`+r.filename+"."+r.format+`"`)
+		r.c.Status(http.StatusOK)
+		w, err := NewWriter(r.format, r.c.Writer, r.name, r.cols)
+		if err != nil {
+			return err
+		}
+		r.w = w
+	}
+	return r.w.Write(row)
+}
+
+// Started reports whether any of the download has been sent
+func (r *Response) Started() bool {
+	return r.w != nil
+}
+
+// Close finishes the file. Leave a failed download unclosed: a truncated
+// CSV or an XLSX/Parquet file without its directory is better than one
+// that looks complete.
+func (r *Response) Close() error {
+	if r.w == nil {
+		return nil
+	}
+	return r.w.Close()
+}
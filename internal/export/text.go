@@ -0,0 +1,85 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, cols []Column) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.Name
+	}
+	return cw, cw.w.Write(header)
+}
+
+func (cw *csvWriter) Write(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		record[i] = text(v)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonWriter writes a JSON array of objects keyed by column name
+type jsonWriter struct {
+	w    *bufio.Writer
+	cols []Column
+	n    int
+}
+
+func newJSONWriter(w io.Writer, cols []Column) *jsonWriter {
+	return &jsonWriter{w: bufio.NewWriter(w), cols: cols}
+}
+
+func (jw *jsonWriter) Write(row []interface{}) error {
+	sep := ",\n"
+	if jw.n == 0 {
+		sep = "[\n"
+	}
+	jw.n++
+	if _, err := jw.w.WriteString(sep + "{"); err != nil {
+		return err
+	}
+	for i, v := range row {
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(dateFormat)
+		}
+		key, _ := json.Marshal(jw.cols[i].Name)
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			jw.w.WriteByte(',')
+		}
+		jw.w.Write(key)
+		jw.w.WriteByte(':')
+		jw.w.Write(val)
+	}
+	return jw.w.WriteByte('}')
+}
+
+func (jw *jsonWriter) Close() error {
+	end := "\n]\n"
+	if jw.n == 0 {
+		end = "[]\n"
+	}
+	if _, err := jw.w.WriteString(end); err != nil {
+		return err
+	}
+	return jw.w.Flush()
+}
@@ -0,0 +1,159 @@
+// Package gql serves a GraphQL view of stored prices, indicators and saved
+// analyses, so a dashboard can load in one request what takes several REST
+// calls. Lookups that every ticker in a list needs go through request-scoped
+// Loaders, so a query over N tickers costs one query per kind of data, not N.
+package gql
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/authz"
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+const (
+	// maxQueryBytes caps the request body and the query text
+	maxQueryBytes = 64 << 10
+	// maxDepth stops deeply nested queries
+	maxDepth = 10
+	// maxParallelism must cover a full list of tickers, or their loads
+	// can't all join one batch
+	maxParallelism = 2 * maxTickers
+)
+
+var schema = graphql.MustParseSchema(schemaSDL, &Query{},
+	graphql.UseFieldResolvers(),
+	graphql.MaxDepth(maxDepth),
+	graphql.MaxParallelism(maxParallelism),
+	graphql.MaxQueryLength(maxQueryBytes),
+)
+
+// Handler serves POST /graphql with a body of {"query", "operationName",
+// "variables"}. Like most GraphQL servers it answers 200 with an errors
+// list for query and resolver errors, including queries over maxFields or
+// maxAliases.
+func Handler(c *gin.Context) {
+	var req struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxQueryBytes)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Respond(c, http.StatusRequestEntityTooLarge, "Queries are limited to 64 KB")
+			return
+		}
+		problem.Respond(c, http.StatusBadRequest, `Send a JSON body like {"query": "{ ticker(symbol: \"AAPL\") { latest { close } } }"}`)
+		return
+	}
+	if req.Query == "" {
+		problem.Respond(c, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	if fields, aliases := queryCost(req.Query); fields > maxFields || aliases > maxAliases {
+		c.JSON(http.StatusOK, &graphql.Response{Errors: []*gqlerrors.QueryError{{
+			Message: fmt.Sprintf("Queries may select up to %d fields and use up to %d aliases; this one selects %d and uses %d",
+				maxFields, maxAliases, fields, aliases),
+			Extensions: map[string]interface{}{"code": problem.CodeValidationFailed},
+		}}})
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), requestKey{}, newRequest(c))
+	c.JSON(http.StatusOK, schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+type requestKey struct{}
+
+// request is what resolvers share for one GraphQL request
+type request struct {
+	gin    *gin.Context
+	claims *auth.Claims
+	plan   billing.Plan
+
+	latest *Loader[string, database.LatestPrice]
+	bars   *Loader[database.StockRange, []database.StockBar]
+
+	// authzMu serializes authz checks, which cache org roles on the gin
+	// context, since resolvers run concurrently
+	authzMu sync.Mutex
+}
+
+func newRequest(c *gin.Context) *request {
+	return &request{
+		gin:    c,
+		claims: auth.CurrentClaims(c),
+		plan:   billing.CurrentPlan(c),
+		latest: NewLoader(database.GetLatestPrices),
+		bars:   NewLoader(database.GetStockRanges),
+	}
+}
+
+func requestFrom(ctx context.Context) *request {
+	return ctx.Value(requestKey{}).(*request)
+}
+
+// can reports whether the caller may perform action on res
+func (r *request) can(action authz.Action, res authz.Resource) bool {
+	r.authzMu.Lock()
+	defer r.authzMu.Unlock()
+	return authz.Can(r.gin, action, res)
+}
+
+// resolverError reports a problem as a GraphQL error, with the problem's
+// code and details in extensions
+type resolverError struct {
+	problem *problem.Error
+}
+
+func (e resolverError) Error() string { return e.problem.Message }
+
+func (e resolverError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.problem.Code}
+	if e.problem.Details != nil {
+		ext["details"] = e.problem.Details
+	}
+	return ext
+}
+
+func fail(e *problem.Error) error {
+	return resolverError{problem: e}
+}
+
+// failInternal logs err and hides it from the client
+func failInternal(err error, what string) error {
+	log.Printf("Error loading %s: %v", what, err)
+	return fail(problem.New(http.StatusInternalServerError, "Failed to load "+what))
+}
+
+// JSON passes a stored JSON document through unchanged
+type JSON json.RawMessage
+
+func (JSON) ImplementsGraphQLType(name string) bool { return name == "JSON" }
+
+func (j *JSON) UnmarshalGraphQL(input interface{}) error {
+	return errors.New("JSON is output only")
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(j).MarshalJSON()
+}
@@ -0,0 +1,201 @@
+package gql
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxFields caps the fields one document selects, counting each
+	// fragment spread as the fields of its fragment
+	maxFields = 500
+	// maxAliases caps aliases, which let a query ask for the same
+	// expensive field many times over
+	maxAliases = 50
+)
+
+// selections counts a block of a document: one operation or fragment
+type selections struct {
+	fields  int
+	aliases int
+	spreads []string
+}
+
+// queryCost returns how many fields and aliases a document selects, with
+// fragment spreads expanded. It only needs to be good enough to refuse
+// oversized queries before they run; malformed documents are left to the
+// GraphQL validator.
+func queryCost(query string) (fields, aliases int) {
+	tokens := lex(query)
+	fragments := map[string]*selections{}
+	var operations []*selections
+
+	var cur *selections
+	braces, parens := 0, 0
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok {
+		case "(":
+			parens++
+			continue
+		case ")":
+			parens--
+			continue
+		}
+		if parens > 0 {
+			// Arguments, variable definitions and their object values
+			continue
+		}
+
+		if braces == 0 {
+			switch tok {
+			case "fragment":
+				if i+1 < len(tokens) {
+					cur = &selections{}
+					fragments[tokens[i+1]] = cur
+				}
+			case "query", "mutation", "subscription":
+				cur = &selections{}
+				operations = append(operations, cur)
+			case "{":
+				if cur == nil {
+					// Shorthand query
+					cur = &selections{}
+					operations = append(operations, cur)
+				}
+				braces++
+			}
+			continue
+		}
+
+		switch {
+		case tok == "{":
+			braces++
+		case tok == "}":
+			braces--
+			if braces == 0 {
+				cur = nil
+			}
+		case tok == "...":
+			// A named spread, or an inline fragment with or without a type
+			if i+1 < len(tokens) && tokens[i+1] == "on" {
+				i += 2
+			} else if i+1 < len(tokens) && isName(tokens[i+1]) {
+				cur.spreads = append(cur.spreads, tokens[i+1])
+				i++
+			}
+		case tok == "@":
+			// Directive name; its arguments are skipped as parens
+			i++
+		case isName(tok):
+			cur.fields++
+			if i+2 < len(tokens) && tokens[i+1] == ":" {
+				cur.aliases++
+				i += 2
+			}
+		}
+	}
+
+	// Fragments may spread other fragments; cycles are invalid and count 0
+	totals := map[string]selections{}
+	visiting := map[string]bool{}
+	var total func(s *selections) selections
+	total = func(s *selections) selections {
+		out := selections{fields: s.fields, aliases: s.aliases}
+		for _, name := range s.spreads {
+			f, ok := fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			t, done := totals[name]
+			if !done {
+				visiting[name] = true
+				t = total(f)
+				visiting[name] = false
+				totals[name] = t
+			}
+			out.fields += t.fields
+			out.aliases += t.aliases
+		}
+		return out
+	}
+	for _, op := range operations {
+		t := total(op)
+		fields += t.fields
+		aliases += t.aliases
+	}
+	return fields, aliases
+}
+
+// lex splits a GraphQL document into names, numbers and punctuators,
+// dropping whitespace, commas, comments and string contents
+func lex(src string) []string {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], `"""`):
+			end := strings.Index(src[i+3:], `"""`)
+			for end >= 0 && strings.HasSuffix(src[i+3:i+3+end], `\`) {
+				// \""" is an escaped delimiter
+				next := strings.Index(src[i+3+end+3:], `"""`)
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += 3 + next
+			}
+			if end < 0 {
+				return tokens
+			}
+			tokens = append(tokens, `""`)
+			i += 3 + end + 3
+		case c == '"':
+			i++
+			for i < len(src) && src[i] != '"' && src[i] != '\n' {
+				if src[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			tokens = append(tokens, `""`)
+			i++
+		case strings.HasPrefix(src[i:], "..."):
+			tokens = append(tokens, "...")
+			i += 3
+		case isNameStart(c):
+			j := i + 1
+			for j < len(src) && (isNameStart(src[j]) || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case c == '-' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] == 'e' || src[j] == 'E' || src[j] == '+' || src[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, "0")
+			i = j
+		default:
+			_, size := utf8.DecodeRuneInString(src[i:])
+			tokens = append(tokens, src[i:i+size])
+			i += size
+		}
+	}
+	return tokens
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isName(tok string) bool {
+	return tok != "" && isNameStart(tok[0])
+}
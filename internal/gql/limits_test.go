@@ -0,0 +1,45 @@
+package gql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryCost(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantFields  int
+		wantAliases int
+	}{
+		{"shorthand", `{ ticker(symbol: "AAPL") { latest { close change } } }`, 4, 0},
+		{"named with variables", `query Q($s: String! = "AAPL", $o: In = {a: 1, b: [2]}) { ticker(symbol: $s) { symbol } }`, 2, 0},
+		{"aliases", `{ a: ticker(symbol: "A") { symbol } b: ticker(symbol: "B") { s: symbol } }`, 4, 3},
+		{"strings and comments", "{ ticker(symbol: \"x { y z }\") { # latest { close }\n symbol } }", 2, 0},
+		{"block string", `{ ticker(symbol: """a: b { c } \""" d""") { symbol } }`, 2, 0},
+		{"directives", `{ ticker(symbol: "A") @include(if: true) { symbol @skip(if: false) } }`, 2, 0},
+		{"inline fragments", `{ ticker(symbol: "A") { ... on Ticker { symbol } ... @include(if: true) { latest { close } } } }`, 4, 0},
+		{"fragments expand per spread", `{ a: ticker(symbol: "A") { ...F } b: ticker(symbol: "B") { ...F } }
+			fragment F on Ticker { symbol x: latest { close } }`, 8, 4},
+		{"nested fragments", `{ ticker(symbol: "A") { ...F } } fragment F on Ticker { ...G symbol } fragment G on Ticker { latest { close } }`, 4, 0},
+		{"fragment cycle", `{ ticker(symbol: "A") { ...F } } fragment F on Ticker { ...F symbol }`, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, aliases := queryCost(tt.query)
+			if fields != tt.wantFields || aliases != tt.wantAliases {
+				t.Errorf("queryCost() = %d fields, %d aliases, want %d, %d", fields, aliases, tt.wantFields, tt.wantAliases)
+			}
+		})
+	}
+}
+
+func TestQueryCostCatchesFragmentFanOut(t *testing.T) {
+	// Ten spreads of a fragment with ten spreads of a 10-field fragment
+	inner := "fragment I on Ticker { " + strings.Repeat("symbol ", 10) + "}"
+	outer := "fragment O on Ticker { " + strings.Repeat("...I ", 10) + "}"
+	query := `{ ticker(symbol: "A") { ` + strings.Repeat("...O ", 10) + "} } " + outer + " " + inner
+	if fields, _ := queryCost(query); fields <= maxFields {
+		t.Errorf("queryCost() = %d fields, want over %d", fields, maxFields)
+	}
+}
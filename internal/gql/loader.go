@@ -0,0 +1,85 @@
+package gql
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// loaderWait is how long a loader collects keys before fetching.
+	// Resolvers for the items of a list run concurrently, so their loads
+	// land well within it.
+	loaderWait = 2 * time.Millisecond
+	// loaderMaxBatch caps the keys sent to one fetch
+	loaderMaxBatch = 100
+)
+
+// Loader batches the Load calls made close together into a single fetch
+// and remembers the results for the rest of the request, so N tickers in
+// one query cost one database round trip instead of N. Build one per
+// request with NewLoader.
+type Loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	results map[K]*loadResult[V]
+	pending []K
+}
+
+type loadResult[V any] struct {
+	done  chan struct{}
+	value V
+	found bool
+	err   error
+}
+
+// NewLoader wraps fetch, which returns values by key and leaves missing
+// keys out of its map
+func NewLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, results: map[K]*loadResult[V]{}}
+}
+
+// Load waits for key's batch and returns its value, whether it was found,
+// and the batch's error
+func (l *Loader[K, V]) Load(key K) (V, bool, error) {
+	l.mu.Lock()
+	r, ok := l.results[key]
+	if !ok {
+		r = &loadResult[V]{done: make(chan struct{})}
+		l.results[key] = r
+		l.pending = append(l.pending, key)
+		switch len(l.pending) {
+		case 1:
+			time.AfterFunc(loaderWait, l.dispatch)
+		case loaderMaxBatch:
+			go l.dispatch()
+		}
+	}
+	l.mu.Unlock()
+
+	<-r.done
+	return r.value, r.found, r.err
+}
+
+// dispatch fetches whatever is pending; a timer that fires after a full
+// batch already went out finds nothing or a smaller batch
+func (l *Loader[K, V]) dispatch() {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+
+	values, err := l.fetch(keys)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, k := range keys {
+		r := l.results[k]
+		r.value, r.found = values[k]
+		r.err = err
+		close(r.done)
+	}
+}
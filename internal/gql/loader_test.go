@@ -0,0 +1,105 @@
+package gql
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// countingFetch doubles each key, leaves out negative ones and records the
+// batches it was called with
+type countingFetch struct {
+	mu      sync.Mutex
+	batches [][]int
+	err     error
+}
+
+func (f *countingFetch) fetch(keys []int) (map[int]int, error) {
+	f.mu.Lock()
+	f.batches = append(f.batches, append([]int(nil), keys...))
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	out := map[int]int{}
+	for _, k := range keys {
+		if k >= 0 {
+			out[k] = 2 * k
+		}
+	}
+	return out, nil
+}
+
+// loadAll loads keys concurrently, as resolvers for a list do
+func loadAll(l *Loader[int, int], keys []int) []error {
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Go(func() {
+			v, found, err := l.Load(k)
+			switch {
+			case err != nil:
+				errs[i] = err
+			case found != (k >= 0) || found && v != 2*k:
+				errs[i] = errors.New("wrong value")
+			}
+		})
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestLoaderBatchesConcurrentLoads(t *testing.T) {
+	f := &countingFetch{}
+	l := NewLoader(f.fetch)
+	for i, err := range loadAll(l, []int{1, 2, 3, -1, 2, 1}) {
+		if err != nil {
+			t.Errorf("load %d: %v", i, err)
+		}
+	}
+	if len(f.batches) != 1 || len(f.batches[0]) != 4 {
+		t.Errorf("batches = %v, want one batch of the 4 distinct keys", f.batches)
+	}
+
+	// Results are remembered for the rest of the request
+	if v, found, err := l.Load(3); v != 6 || !found || err != nil {
+		t.Errorf("Load(3) = %d, %v, %v", v, found, err)
+	}
+	if len(f.batches) != 1 {
+		t.Errorf("a remembered key was fetched again: %v", f.batches)
+	}
+}
+
+func TestLoaderSplitsLargeBatches(t *testing.T) {
+	f := &countingFetch{}
+	l := NewLoader(f.fetch)
+	keys := make([]int, 2*loaderMaxBatch+1)
+	for i := range keys {
+		keys[i] = i
+	}
+	for i, err := range loadAll(l, keys) {
+		if err != nil {
+			t.Fatalf("load %d: %v", i, err)
+		}
+	}
+	total := 0
+	for _, b := range f.batches {
+		if len(b) > loaderMaxBatch {
+			t.Errorf("batch of %d keys, want at most %d", len(b), loaderMaxBatch)
+		}
+		total += len(b)
+	}
+	if total != len(keys) {
+		t.Errorf("fetched %d keys, want each of the %d once", total, len(keys))
+	}
+}
+
+func TestLoaderSharesTheBatchError(t *testing.T) {
+	f := &countingFetch{err: errors.New("connection reset")}
+	l := NewLoader(f.fetch)
+	for i, err := range loadAll(l, []int{1, 2}) {
+		if !errors.Is(err, f.err) {
+			t.Errorf("load %d: err = %v, want the fetch error", i, err)
+		}
+	}
+}
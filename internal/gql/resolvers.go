@@ -0,0 +1,390 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/analytics"
+	"github.com/chuma-beep/stock-saas/internal/authz"
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/cache"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/handlers"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+)
+
+const (
+	// maxTickers caps the tickers one list may ask for, as /current-prices does
+	maxTickers = 50
+
+	maxIndicatorPeriod = 200
+
+	// statsTTL matches how long the bars behind them stay cached
+	statsTTL = time.Hour
+)
+
+// Query is the root resolver
+type Query struct{}
+
+func (q *Query) Ticker(args struct{ Symbol string }) (*tickerResolver, error) {
+	errs := validate.Errors{}
+	symbol := errs.Ticker("symbol", args.Symbol)
+	if len(errs) > 0 {
+		return nil, fail(errs.Problem())
+	}
+	return &tickerResolver{symbol: symbol}, nil
+}
+
+func (q *Query) Tickers(args struct{ Symbols *[]string }) ([]*tickerResolver, error) {
+	if args.Symbols == nil {
+		return tickerResolvers(handlers.DefaultTickers()), nil
+	}
+	errs := validate.Errors{}
+	symbols := errs.Tickers("symbols", *args.Symbols)
+	if len(symbols) > maxTickers {
+		errs.Add("symbols", "at most 50 tickers can be requested")
+	}
+	if len(errs) > 0 {
+		return nil, fail(errs.Problem())
+	}
+	return tickerResolvers(symbols), nil
+}
+
+func (q *Query) Watchlist(ctx context.Context, args struct{ ID int32 }) (*watchlistResolver, error) {
+	r := requestFrom(ctx)
+	if r.claims == nil {
+		return nil, fail(problem.New(http.StatusUnauthorized, "Log in to read a watchlist"))
+	}
+	w, err := database.GetWatchlist(int(args.ID))
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, failInternal(err, "watchlist")
+	}
+	if err != nil || !r.can(authz.Read, resource(w.UserID, w.OrgID)) {
+		return nil, fail(problem.New(http.StatusNotFound, "Watchlist not found"))
+	}
+	return &watchlistResolver{w}, nil
+}
+
+func (q *Query) SavedComparisons(ctx context.Context, args struct{ AnalyzedOnly bool }) ([]*comparisonResolver, error) {
+	r := requestFrom(ctx)
+	if r.claims == nil {
+		return nil, fail(problem.New(http.StatusUnauthorized, "Log in to read saved comparisons"))
+	}
+	list, err := database.ListSavedComparisons(r.claims.UserID())
+	if err != nil {
+		return nil, failInternal(err, "comparisons")
+	}
+	resolvers := []*comparisonResolver{}
+	for i := range list {
+		if args.AnalyzedOnly && list[i].Analysis == nil {
+			continue
+		}
+		resolvers = append(resolvers, &comparisonResolver{&list[i]})
+	}
+	return resolvers, nil
+}
+
+func (q *Query) SavedComparison(ctx context.Context, args struct{ ID int32 }) (*comparisonResolver, error) {
+	r := requestFrom(ctx)
+	if r.claims == nil {
+		return nil, fail(problem.New(http.StatusUnauthorized, "Log in to read saved comparisons"))
+	}
+	sc, err := database.GetSavedComparison(int(args.ID))
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, failInternal(err, "comparison")
+	}
+	if err != nil || !r.can(authz.Read, resource(sc.UserID, sc.OrgID)) {
+		return nil, fail(problem.New(http.StatusNotFound, "Comparison not found"))
+	}
+	return &comparisonResolver{sc}, nil
+}
+
+func resource(ownerID int, orgID *int) authz.Resource {
+	res := authz.Resource{OwnerID: ownerID}
+	if orgID != nil {
+		res.OrgID = *orgID
+	}
+	return res
+}
+
+type tickerResolver struct {
+	symbol string
+}
+
+func tickerResolvers(symbols []string) []*tickerResolver {
+	list := make([]*tickerResolver, len(symbols))
+	for i, s := range symbols {
+		list[i] = &tickerResolver{symbol: s}
+	}
+	return list
+}
+
+func (t *tickerResolver) Symbol() string { return t.symbol }
+
+type price struct {
+	Date      string
+	Close     float64
+	PrevClose *float64
+	Change    float64
+}
+
+func (t *tickerResolver) Latest(ctx context.Context) (*price, error) {
+	p, found, err := requestFrom(ctx).latest.Load(t.symbol)
+	if err != nil {
+		return nil, failInternal(err, "latest prices")
+	}
+	if !found {
+		return nil, nil
+	}
+	out := &price{Date: p.Date.Format(validate.DateFormat), Close: p.Close, Change: p.Change()}
+	if p.PrevClose > 0 {
+		out.PrevClose = &p.PrevClose
+	}
+	return out, nil
+}
+
+type bar struct {
+	Date   string
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+type barsArgs struct {
+	Start    string
+	End      string
+	Interval string
+}
+
+func (t *tickerResolver) Bars(ctx context.Context, args barsArgs) ([]*bar, error) {
+	bars, _, err := t.load(ctx, args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+	return resample(bars, args.Interval), nil
+}
+
+type rangeArgs struct {
+	Start string
+	End   string
+}
+
+type stats struct {
+	Start         string
+	End           string
+	Bars          int32
+	FirstClose    float64
+	LastClose     float64
+	PercentChange float64
+	High          float64
+	Low           float64
+	AverageVolume float64
+	Volatility    float64
+	MaxDrawdown   float64
+	PeakDate      *string
+	TroughDate    *string
+}
+
+// Stats are cached per range, like the bars they are computed from
+func (t *tickerResolver) Stats(ctx context.Context, args rangeArgs) (*stats, error) {
+	rng, err := checkRange(ctx, args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+	key := "stats:" + t.symbol + ":" + rng.StartDate() + ":" + rng.EndDate()
+	return cache.Fetch(key, statsTTL, []string{cache.TickerTag(t.symbol)}, func() (*stats, error) {
+		bars, err := t.bars(ctx, rng)
+		if err != nil || len(bars) == 0 {
+			return nil, err
+		}
+		return computeStats(bars, rng), nil
+	})
+}
+
+func computeStats(bars []database.StockBar, rng validate.Range) *stats {
+	closes := make([]float64, len(bars))
+	s := &stats{
+		Start: rng.StartDate(),
+		End:   rng.EndDate(),
+		Bars:  int32(len(bars)),
+		High:  bars[0].High,
+		Low:   bars[0].Low,
+	}
+	volume := 0.0
+	for i, b := range bars {
+		closes[i] = b.Close
+		s.High = math.Max(s.High, b.High)
+		s.Low = math.Min(s.Low, b.Low)
+		volume += float64(b.Volume)
+	}
+	s.FirstClose, s.LastClose = closes[0], closes[len(closes)-1]
+	s.PercentChange = analytics.PercentChange(closes)
+	s.AverageVolume = volume / float64(len(bars))
+	s.Volatility = analytics.Volatility(closes)
+
+	dd := analytics.MaxDrawdown(closes)
+	s.MaxDrawdown = dd.MaxDrawdown
+	if dd.MaxDrawdown > 0 {
+		peak := bars[dd.PeakIndex].Date.Format(validate.DateFormat)
+		trough := bars[dd.TroughIndex].Date.Format(validate.DateFormat)
+		s.PeakDate, s.TroughDate = &peak, &trough
+	}
+	return s
+}
+
+type indicatorPoint struct {
+	Date  string
+	Close float64
+	Value float64
+}
+
+type indicatorArgs struct {
+	Name   string
+	Start  string
+	End    string
+	Period int32
+}
+
+func (t *tickerResolver) Indicator(ctx context.Context, args indicatorArgs) ([]*indicatorPoint, error) {
+	period := int(args.Period)
+	if period < 1 || period > maxIndicatorPeriod {
+		errs := validate.Errors{}
+		errs.Add("period", "must be between 1 and "+strconv.Itoa(maxIndicatorPeriod))
+		return nil, fail(errs.Problem())
+	}
+	stream, err := analytics.NewStream(strings.ToLower(args.Name), period)
+	if err != nil {
+		return nil, fail(problem.New(http.StatusBadRequest, err.Error()))
+	}
+
+	bars, _, err := t.load(ctx, args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+	points := []*indicatorPoint{}
+	for _, b := range bars {
+		if v := stream.Next(b.Close); !math.IsNaN(v) {
+			points = append(points, &indicatorPoint{Date: b.Date.Format(validate.DateFormat), Close: b.Close, Value: v})
+		}
+	}
+	return points, nil
+}
+
+// load validates a range against the caller's plan and returns the daily
+// bars in it
+func (t *tickerResolver) load(ctx context.Context, start, end string) ([]database.StockBar, validate.Range, error) {
+	rng, err := checkRange(ctx, start, end)
+	if err != nil {
+		return nil, rng, err
+	}
+	bars, err := t.bars(ctx, rng)
+	return bars, rng, err
+}
+
+// checkRange parses a range and checks it against the caller's plan
+func checkRange(ctx context.Context, start, end string) (validate.Range, error) {
+	r := requestFrom(ctx)
+	errs := validate.Errors{}
+	rng := errs.DateRange("start", "end", start, end)
+	if len(errs) > 0 {
+		return rng, fail(errs.Problem())
+	}
+	if !billing.HistoryAllowed(r.plan, rng.Start) {
+		return rng, fail(billing.LimitError(http.StatusForbidden, r.plan,
+			"start is older than your plan's history depth of "+strconv.Itoa(r.plan.HistoryDays)+" days"))
+	}
+	return rng, nil
+}
+
+// bars loads the daily bars in rng, batched with every other ticker asking
+// for the same range
+func (t *tickerResolver) bars(ctx context.Context, rng validate.Range) ([]database.StockBar, error) {
+	bars, _, err := requestFrom(ctx).bars.Load(database.StockRange{Ticker: t.symbol, Start: rng.StartDate(), End: rng.EndDate()})
+	if err != nil {
+		return nil, failInternal(err, "stock data")
+	}
+	return bars, nil
+}
+
+// resample merges daily bars into weekly (ISO weeks) or monthly ones
+func resample(daily []database.StockBar, interval string) []*bar {
+	bucket := func(d time.Time) int {
+		switch interval {
+		case "WEEKLY":
+			y, w := d.ISOWeek()
+			return y*100 + w
+		case "MONTHLY":
+			return d.Year()*100 + int(d.Month())
+		}
+		return int(d.Unix() / 86400)
+	}
+
+	out := []*bar{}
+	var cur *bar
+	curBucket := -1
+	for _, b := range daily {
+		if k := bucket(b.Date); cur == nil || k != curBucket {
+			cur = &bar{Date: b.Date.Format(validate.DateFormat), Open: b.Open, High: b.High, Low: b.Low}
+			curBucket = k
+			out = append(out, cur)
+		}
+		cur.High = math.Max(cur.High, b.High)
+		cur.Low = math.Min(cur.Low, b.Low)
+		cur.Close = b.Close
+		cur.Volume += float64(b.Volume)
+	}
+	return out
+}
+
+type watchlistResolver struct {
+	w *database.Watchlist
+}
+
+func (r *watchlistResolver) ID() int32    { return int32(r.w.ID) }
+func (r *watchlistResolver) Name() string { return r.w.Name }
+func (r *watchlistResolver) Tickers() []*tickerResolver {
+	symbols := make([]string, len(r.w.Items))
+	for i, item := range r.w.Items {
+		symbols[i] = item.Symbol
+	}
+	return tickerResolvers(symbols)
+}
+
+type comparisonResolver struct {
+	sc *database.SavedComparison
+}
+
+func (r *comparisonResolver) ID() int32                  { return int32(r.sc.ID) }
+func (r *comparisonResolver) Slug() string               { return r.sc.Slug }
+func (r *comparisonResolver) Title() string              { return r.sc.Title }
+func (r *comparisonResolver) Tickers() []*tickerResolver { return tickerResolvers(r.sc.Tickers) }
+func (r *comparisonResolver) StartDate() string          { return r.sc.StartDate }
+func (r *comparisonResolver) EndDate() string            { return r.sc.EndDate }
+func (r *comparisonResolver) Normalization() string      { return r.sc.Normalization }
+func (r *comparisonResolver) Visibility() string         { return r.sc.Visibility }
+func (r *comparisonResolver) CreatedAt() string          { return r.sc.CreatedAt.Format(time.RFC3339) }
+func (r *comparisonResolver) UpdatedAt() string          { return r.sc.UpdatedAt.Format(time.RFC3339) }
+
+func (r *comparisonResolver) Analysis() *JSON {
+	if r.sc.Analysis == nil {
+		return nil
+	}
+	j := JSON(r.sc.Analysis)
+	return &j
+}
+
+func (r *comparisonResolver) AnalyzedAt() *string {
+	if r.sc.AnalyzedAt == nil {
+		return nil
+	}
+	s := r.sc.AnalyzedAt.Format(time.RFC3339)
+	return &s
+}
@@ -0,0 +1,223 @@
+// Package guardrails post-processes AI output: explicit recommendations and
+// price targets are rewritten, and percentages, dollar figures and dates
+// that don't match the facts the model was given are flagged. Only figures
+// written as 12.3%, $123.45 or 2025-01-31 are checked; numbers in prose
+// ("a twelve percent drop", "last March") are not.
+package guardrails
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Disclaimer is appended to every piece of AI-generated content we return
+const Disclaimer = "⚠️ AI-generated for informational purposes only — not investment advice. Do your own research before making any investment decision."
+
+const (
+	RuleRecommendation = "recommendation"
+	RulePriceTarget    = "price_target"
+	RuleUnknownNumber  = "unverified_number"
+	RuleUnknownDate    = "unverified_date"
+
+	ActionRewritten = "rewritten"
+	ActionFlagged   = "flagged"
+)
+
+const removedRecommendation = "[Removed: explicit trading recommendation]"
+const removedPriceTarget = "[Removed: price target]"
+
+// Violation records one guardrail hit
+type Violation struct {
+	Rule    string `json:"rule"`
+	Action  string `json:"action"`
+	Excerpt string `json:"excerpt"`
+}
+
+var (
+	recommendationPattern = regexp.MustCompile(`(?i)\b(strong(ly)?\s+(buy|sell)|(you|investors|traders|we)\s+should\s+(buy|sell|short|dump|load up)|(i|we)\s+recommend\s+(buying|selling|shorting)|(buy|sell|short)\s+(now|today|immediately)|(buy|sell|short)\s+(?-i:[A-Z]{1,5})(\.[A-Z])?\b|load\s+up\s+on|go\s+(all[- ]in|long|short)\s+on)`)
+	priceTargetPattern    = regexp.MustCompile(`(?i)\b(price\s+target|target\s+price|PT)\b[^.!?\n]*?\$?\d|\b(will|could|should|to)\s+(hit|reach|climb to|fall to|drop to)\s+\$\d`)
+	percentPattern        = regexp.MustCompile(`[-+−]?\d+(?:\.\d+)?\s?%`)
+	pricePattern          = regexp.MustCompile(`[-+−]?\$\d{1,3}(?:,\d{3})*(?:\.\d+)?\b|[-+−]?\$\d+(?:\.\d+)?\b`)
+	datePattern           = regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`)
+)
+
+// Facts are what a response may quote: computed numbers, as percentages or
+// prices, and YYYY-MM-DD dates
+type Facts struct {
+	Numbers []float64
+	Dates   []string
+}
+
+// Add appends other's facts to f
+func (f *Facts) Add(other Facts) {
+	f.Numbers = append(f.Numbers, other.Numbers...)
+	f.Dates = append(f.Dates, other.Dates...)
+}
+
+// Check rewrites recommendations and price targets and flags percentages,
+// prices and dates that aren't among the facts. It never adds the
+// disclaimer.
+func Check(text string, facts Facts) (string, []Violation) {
+	var violations []Violation
+
+	text, v := rewriteSentences(text, recommendationPattern, RuleRecommendation, removedRecommendation)
+	violations = append(violations, v...)
+	text, v = rewriteSentences(text, priceTargetPattern, RulePriceTarget, removedPriceTarget)
+	violations = append(violations, v...)
+
+	for _, pattern := range []*regexp.Regexp{percentPattern, pricePattern} {
+		for _, match := range pattern.FindAllString(text, -1) {
+			if !matchesAllowed(match, facts.Numbers) {
+				violations = append(violations, Violation{Rule: RuleUnknownNumber, Action: ActionFlagged, Excerpt: match})
+			}
+		}
+	}
+	for _, match := range datePattern.FindAllString(text, -1) {
+		if !slices.Contains(facts.Dates, match) {
+			violations = append(violations, Violation{Rule: RuleUnknownDate, Action: ActionFlagged, Excerpt: match})
+		}
+	}
+	return text, violations
+}
+
+// CheckAll runs Check over a list of strings, e.g. bullet points
+func CheckAll(items []string, facts Facts) ([]string, []Violation) {
+	var violations []Violation
+	out := make([]string, len(items))
+	for i, item := range items {
+		var v []Violation
+		out[i], v = Check(item, facts)
+		violations = append(violations, v...)
+	}
+	return out, violations
+}
+
+// WithDisclaimer appends the disclaimer unless the text already ends with it
+func WithDisclaimer(text string) string {
+	if strings.HasSuffix(strings.TrimSpace(text), Disclaimer) {
+		return text
+	}
+	return strings.TrimRight(text, "\n") + "\n\n" + Disclaimer
+}
+
+// Log writes violations to the server log so they can be reviewed
+func Log(source string, violations []Violation) {
+	for _, v := range violations {
+		log.Printf("Guardrail %s (%s) in %s: %q", v.Rule, v.Action, source, v.Excerpt)
+	}
+}
+
+// FactsFromJSON collects every number and date in a JSON document, e.g.
+// tool output. Fractions are also added as percentages since correlations
+// come back as 0.72.
+func FactsFromJSON(raw []byte) Facts {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return Facts{}
+	}
+	var out Facts
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case float64:
+			out.Numbers = append(out.Numbers, t)
+			if math.Abs(t) <= 1 {
+				out.Numbers = append(out.Numbers, t*100)
+			}
+		case string:
+			out.Dates = append(out.Dates, datePattern.FindAllString(t, -1)...)
+		case []interface{}:
+			for _, item := range t {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for _, item := range t {
+				walk(item)
+			}
+		}
+	}
+	walk(doc)
+	return out
+}
+
+func rewriteSentences(text string, pattern *regexp.Regexp, rule, replacement string) (string, []Violation) {
+	var violations []Violation
+	for offset := 0; offset < len(text); {
+		loc := pattern.FindStringIndex(text[offset:])
+		if loc == nil {
+			break
+		}
+		start, end := sentenceBounds(text, offset, offset+loc[0], offset+loc[1])
+		violations = append(violations, Violation{Rule: rule, Action: ActionRewritten, Excerpt: strings.TrimSpace(text[start:end])})
+		text = text[:start] + replacement + text[end:]
+		offset = start + len(replacement)
+	}
+	return text, violations
+}
+
+// sentenceBounds widens [start, end) to the sentence or line around it,
+// without reaching back before min
+func sentenceBounds(text string, min, start, end int) (int, int) {
+	for start > min && !sentenceEnd(text, start-1) {
+		start--
+	}
+	for start < end && (text[start] == ' ' || text[start] == '\t') {
+		start++
+	}
+	for end < len(text) && !sentenceEnd(text, end) {
+		end++
+	}
+	if end < len(text) && text[end] != '\n' {
+		end++
+	}
+	return start, end
+}
+
+// sentenceEnd reports whether text[i] ends a sentence; a '.' only counts
+// when followed by whitespace so decimals like 12.4 stay intact
+func sentenceEnd(text string, i int) bool {
+	switch text[i] {
+	case '!', '?', '\n':
+		return true
+	case '.':
+		return i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\n'
+	}
+	return false
+}
+
+// matchesAllowed compares a "12.3%" or "$1,234.5" figure against the
+// computed values, allowing for the rounding implied by how many decimals
+// were written. A figure written with a sign must match in sign too, so
+// "-5%" doesn't pass for a 5% gain; an unsigned one matches either way,
+// since prose like "fell 3.2%" carries the direction.
+func matchesAllowed(match string, allowed []float64) bool {
+	s := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(match), "%"))
+	s = strings.Replace(s, "−", "-", 1)
+	s = strings.ReplaceAll(strings.Replace(s, "$", "", 1), ",", "")
+	signed := strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+")
+	value, err := strconv.ParseFloat(strings.TrimPrefix(s, "+"), 64)
+	if err != nil {
+		return true
+	}
+
+	tolerance := 0.5
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		tolerance = 0.5 * math.Pow(10, -float64(len(s)-i-1))
+	}
+	tolerance += 1e-9
+
+	for _, a := range allowed {
+		if !signed {
+			a = math.Abs(a)
+		}
+		if math.Abs(value-a) <= tolerance {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package guardrails
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func rules(violations []Violation) []string {
+	out := make([]string, len(violations))
+	for i, v := range violations {
+		out[i] = v.Rule
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	facts := Facts{Numbers: []float64{12.345, -3.2, 187.5, 0.72 * 100}, Dates: []string{"2025-01-02", "2025-03-31"}}
+	tests := []struct {
+		name      string
+		text      string
+		wantText  string
+		wantRules []string
+	}{
+		{name: "clean", text: "AAPL gained 12.3% while MSFT fell 3.2%.",
+			wantText: "AAPL gained 12.3% while MSFT fell 3.2%."},
+		{name: "rounding follows decimals written", text: "Up 12% and 12.35%, correlation 72%.",
+			wantText: "Up 12% and 12.35%, correlation 72%."},
+		{name: "unknown percent", text: "AAPL gained 15.1%.",
+			wantText: "AAPL gained 15.1%.", wantRules: []string{RuleUnknownNumber}},
+		{name: "minus sign variants", text: "MSFT moved −3.2% (-3.2%).",
+			wantText: "MSFT moved −3.2% (-3.2%)."},
+		{name: "sign must match", text: "MSFT rose +3.2% and AAPL fell -12.3%.",
+			wantText: "MSFT rose +3.2% and AAPL fell -12.3%.", wantRules: []string{RuleUnknownNumber, RuleUnknownNumber}},
+		{name: "signed gain", text: "AAPL returned +12.3%, trading near -$187.50.",
+			wantText: "AAPL returned +12.3%, trading near -$187.50.", wantRules: []string{RuleUnknownNumber}},
+		{name: "prices", text: "It closed at $187.50, not $1,000.",
+			wantText: "It closed at $187.50, not $1,000.", wantRules: []string{RuleUnknownNumber}},
+		{name: "dates", text: "From 2025-01-02 to 2025-04-01.",
+			wantText: "From 2025-01-02 to 2025-04-01.", wantRules: []string{RuleUnknownDate}},
+		{name: "recommendation sentence", text: "AAPL led. You should buy AAPL now. MSFT lagged.",
+			wantText: "AAPL led. " + removedRecommendation + " MSFT lagged.", wantRules: []string{RuleRecommendation}},
+		{name: "ticker recommendation", text: "Strong momentum. Sell MSFT.",
+			wantText: "Strong momentum. " + removedRecommendation, wantRules: []string{RuleRecommendation}},
+		{name: "price target", text: "AAPL led.\nAnalysts see a price target of $250.\nMSFT lagged.",
+			wantText: "AAPL led.\n" + removedPriceTarget + "\nMSFT lagged.", wantRules: []string{RulePriceTarget}},
+		{name: "decimal isn't a sentence end", text: "Up 12.3% so buy now.",
+			wantText: removedRecommendation, wantRules: []string{RuleRecommendation}},
+		{name: "plain buy isn't a recommendation", text: "Buyers stepped in after the dip.",
+			wantText: "Buyers stepped in after the dip."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, violations := Check(tt.text, facts)
+			if got != tt.wantText {
+				t.Errorf("text = %q, want %q", got, tt.wantText)
+			}
+			if !slices.Equal(rules(violations), tt.wantRules) {
+				t.Errorf("violations = %+v, want rules %v", violations, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestWithDisclaimer(t *testing.T) {
+	once := WithDisclaimer("Summary.\n")
+	if !strings.HasSuffix(once, "\n\n"+Disclaimer) {
+		t.Errorf("WithDisclaimer() = %q", once)
+	}
+	if twice := WithDisclaimer(once); twice != once {
+		t.Errorf("disclaimer added twice: %q", twice)
+	}
+}
+
+func TestFactsFromJSON(t *testing.T) {
+	f := FactsFromJSON([]byte(`{"change": 12.5, "correlation": 0.72, "rows": [{"date": "2025-01-02"}, {"note": "2025-02-03 close"}]}`))
+	for _, n := range []float64{12.5, 0.72, 72} {
+		if !slices.Contains(f.Numbers, n) {
+			t.Errorf("Numbers = %v, missing %v", f.Numbers, n)
+		}
+	}
+	slices.Sort(f.Dates)
+	if !slices.Equal(f.Dates, []string{"2025-01-02", "2025-02-03"}) {
+		t.Errorf("Dates = %v", f.Dates)
+	}
+	if got := FactsFromJSON([]byte("not json")); len(got.Numbers)+len(got.Dates) != 0 {
+		t.Errorf("FactsFromJSON(invalid) = %+v, want empty", got)
+	}
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/alerts"
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTriggerLimit = 50
+	maxTriggerLimit     = 500
+)
+
+type alertRequest struct {
+	Ticker          string  `json:"ticker"`
+	Kind            string  `json:"kind"`
+	Threshold       float64 `json:"threshold"`
+	Period          int     `json:"period"`
+	CooldownMinutes *int    `json:"cooldown_minutes"`
+	Active          *bool   `json:"active"`
+}
+
+func ListAlerts(c *gin.Context) {
+	rules, err := database.ListAlertRules(auth.CurrentClaims(c).UserID())
+	if err != nil {
+		log.Printf("Error listing alerts: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch alerts")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alerts": rules})
+}
+
+func CreateAlert(c *gin.Context) {
+	rule, ok := bindAlert(c)
+	if !ok {
+		return
+	}
+	rule.UserID = auth.CurrentClaims(c).UserID()
+
+	created, err := database.CreateAlertRule(rule)
+	if !alertOK(c, err) {
+		return
+	}
+	audit.SetResourceID(c, strconv.Itoa(created.ID))
+	audit.Diff(c, nil, created)
+	c.JSON(http.StatusCreated, gin.H{"alert": created})
+}
+
+func GetAlert(c *gin.Context) {
+	id, ok := alertID(c)
+	if !ok {
+		return
+	}
+	rule, err := database.GetAlertRule(auth.CurrentClaims(c).UserID(), id)
+	if !alertOK(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"alert": rule})
+}
+
+// UpdateAlert replaces a rule's definition; trigger history is kept
+func UpdateAlert(c *gin.Context) {
+	id, ok := alertID(c)
+	if !ok {
+		return
+	}
+	rule, ok := bindAlert(c)
+	if !ok {
+		return
+	}
+	rule.ID = id
+	rule.UserID = auth.CurrentClaims(c).UserID()
+
+	before, err := database.GetAlertRule(rule.UserID, id)
+	if !alertOK(c, err) {
+		return
+	}
+	updated, err := database.UpdateAlertRule(rule)
+	if !alertOK(c, err) {
+		return
+	}
+	audit.Diff(c, before, updated)
+	c.JSON(http.StatusOK, gin.H{"alert": updated})
+}
+
+func DeleteAlert(c *gin.Context) {
+	id, ok := alertID(c)
+	if !ok {
+		return
+	}
+	userID := auth.CurrentClaims(c).UserID()
+	before, err := database.GetAlertRule(userID, id)
+	if !alertOK(c, err) {
+		return
+	}
+	if !alertOK(c, database.DeleteAlertRule(userID, id)) {
+		return
+	}
+	audit.Diff(c, before, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Alert deleted"})
+}
+
+// ListAlertTriggers returns trigger history for all of the user's alerts,
+// or for one alert when mounted under /alerts/:id
+func ListAlertTriggers(c *gin.Context) {
+	userID := auth.CurrentClaims(c).UserID()
+
+	ruleID := 0
+	if c.Param("id") != "" {
+		id, ok := alertID(c)
+		if !ok {
+			return
+		}
+		if _, err := database.GetAlertRule(userID, id); !alertOK(c, err) {
+			return
+		}
+		ruleID = id
+	}
+
+	limit := defaultTriggerLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTriggerLimit {
+			problem.Respond(c, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	triggers, err := database.ListAlertTriggers(userID, ruleID, limit)
+	if err != nil {
+		log.Printf("Error listing alert triggers: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch alert history")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"triggers": triggers})
+}
+
+func bindAlert(c *gin.Context) (*database.AlertRule, bool) {
+	var req alertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return nil, false
+	}
+
+	errs := validate.Errors{}
+	ticker := errs.Ticker("ticker", req.Ticker)
+	if !validate.OK(c, errs) {
+		return nil, false
+	}
+
+	rule := &database.AlertRule{
+		Ticker:          ticker,
+		Kind:            strings.ToLower(strings.TrimSpace(req.Kind)),
+		Threshold:       req.Threshold,
+		Period:          req.Period,
+		CooldownMinutes: alerts.DefaultCooldownMinutes,
+		Active:          true,
+	}
+	if req.CooldownMinutes != nil {
+		rule.CooldownMinutes = *req.CooldownMinutes
+	}
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	if err := alerts.Normalize(rule); err != nil {
+		problem.Respond(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return rule, true
+}
+
+func alertID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid alert id")
+		return 0, false
+	}
+	return id, true
+}
+
+// alertOK turns a database error into a response; true means no error
+func alertOK(c *gin.Context, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "Alert not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error handling alert: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to process alert")
+		return false
+	}
+	return true
+}
@@ -1,25 +1,29 @@
 package handler
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
+	"log"
 	"net/http"
-	"os"
-	"time"
 
+	"github.com/chuma-beep/stock-saas/internal/analytics"
+	"github.com/chuma-beep/stock-saas/internal/guardrails"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/prompts"
+	"github.com/chuma-beep/stock-saas/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
 type StockComparison struct {
-	Ticker        string  `json:"ticker"`
-	PercentChange float64 `json:"percent_change"`
-	Data          []struct {
-		Date   string  `json:"date"`
-		Close  float64 `json:"close"`
-		Volume int64   `json:"volume"`
-	} `json:"data"`
+	Ticker        string            `json:"ticker"`
+	PercentChange float64           `json:"percent_change"`
+	Data          []ComparisonPoint `json:"data"`
+}
+
+type ComparisonPoint struct {
+	Date   string  `json:"date"`
+	Close  float64 `json:"close"`
+	Volume int64   `json:"volume"`
 }
 
 type ComparisonResponse struct {
@@ -29,58 +33,20 @@ type ComparisonResponse struct {
 }
 
 type AnalyzeRequest struct {
-	Comparison ComparisonResponse `json:"comparison"`
-	Preset     string             `json:"preset"`
+	Comparison      ComparisonResponse `json:"comparison"`
+	Preset          string             `json:"preset"`
+	Template        string             `json:"template"`         // prompt template name, "default" if empty
+	TemplateVersion int                `json:"template_version"` // 0 picks the latest version
+	Params          map[string]string  `json:"params"`           // overrides the template's params
 }
 
 type AnalyzeResponse struct {
-	Analysis string `json:"analysis"`
-}
-
-// Groq structs
-type GroqMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type GroqRequest struct {
-	Model       string        `json:"model"`
-	Messages    []GroqMessage `json:"messages"`
-	Temperature float64       `json:"temperature"`
-	MaxTokens   int           `json:"max_tokens"`
-}
-
-type GroqChoice struct {
-	Message struct {
-		Content string `json:"content"`
-	} `json:"message"`
-}
-
-type GroqResponse struct {
-	Choices []GroqChoice `json:"choices"`
-}
-
-// Helper: Pearson correlation on returns
-func calculateCorrelation(returns1, returns2 []float64) float64 {
-	n := len(returns1)
-	if n != len(returns2) || n < 2 {
-		return 0
-	}
-	var sum1, sum2, sum1Sq, sum2Sq, pSum float64
-	for i := 0; i < n; i++ {
-		r1, r2 := returns1[i], returns2[i]
-		sum1 += r1
-		sum2 += r2
-		sum1Sq += r1 * r1
-		sum2Sq += r2 * r2
-		pSum += r1 * r2
-	}
-	num := pSum - (sum1 * sum2 / float64(n))
-	den := math.Sqrt((sum1Sq - math.Pow(sum1, 2)/float64(n)) * (sum2Sq - math.Pow(sum2, 2)/float64(n)))
-	if den == 0 {
-		return 0
-	}
-	return num / den
+	Analysis   string                 `json:"analysis"` // markdown rendering, kept for older clients
+	Structured *StructuredAnalysis    `json:"structured,omitempty"`
+	Template   string                 `json:"template,omitempty"`
+	Version    int                    `json:"template_version,omitempty"`
+	Disclaimer string                 `json:"disclaimer,omitempty"`
+	Flags      []guardrails.Violation `json:"flags,omitempty"`
 }
 
 // Helper: ternary for string
@@ -91,41 +57,48 @@ func ternary(b bool, t, f string) string {
 	return f
 }
 
-// Helper: Annualized volatility (%)
-func calculateVolatility(prices []float64) float64 {
-	n := len(prices)
-	if n < 2 {
-		return 0
-	}
-	returns := make([]float64, n-1)
-	for i := 1; i < n; i++ {
-		returns[i-1] = (prices[i] - prices[i-1]) / prices[i-1]
-	}
-	mean := 0.0
-	for _, r := range returns {
-		mean += r
-	}
-	mean /= float64(len(returns))
-	variance := 0.0
-	for _, r := range returns {
-		variance += math.Pow(r-mean, 2)
-	}
-	variance /= float64(len(returns) - 1)
-	return math.Sqrt(variance) * math.Sqrt(252) * 100
+// AnalysisRequestError means the request can't be analyzed as sent
+type AnalysisRequestError struct {
+	Message string
+}
+
+func (e *AnalysisRequestError) Error() string {
+	return e.Message
 }
 
+// ErrAIUnavailable means the model couldn't be reached or rate limited us
+var ErrAIUnavailable = errors.New("AI insights temporarily unavailable")
+
 // AnalyzeComparison handler
 func AnalyzeComparison(c *gin.Context) {
 	var req AnalyzeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		problem.Respond(c, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
+	resp, err := RunAnalysis(services.NewGroqClient(), req)
+	var reqErr *AnalysisRequestError
+	switch {
+	case errors.As(err, &reqErr):
+		problem.Respond(c, http.StatusBadRequest, reqErr.Message)
+	case errors.Is(err, ErrAIUnavailable):
+		log.Printf("Groq analysis failed: %v", err)
+		problem.Write(c, problem.Upstream(err, "AI insights temporarily unavailable, try again soon"))
+	case err != nil:
+		log.Printf("Analysis failed: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Internal error")
+	default:
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// RunAnalysis is the analyze pipeline: stats, prompt template, structured
+// model output and guardrails. It is shared by the handler and cmd/evalprompts.
+func RunAnalysis(client services.ChatClient, req AnalyzeRequest) (*AnalyzeResponse, error) {
 	comp := req.Comparison
 	if len(comp.Comparison) != 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected two stocks for comparison"})
-		return
+		return nil, &AnalysisRequestError{Message: "Expected two stocks for comparison"}
 	}
 
 	stockA, stockB := comp.Comparison[0], comp.Comparison[1]
@@ -140,17 +113,9 @@ func AnalyzeComparison(c *gin.Context) {
 		closesB[i] = d.Close
 	}
 
-	// Returns for correlation
-	returnsA := make([]float64, len(closesA)-1)
-	returnsB := make([]float64, len(closesB)-1)
-	for i := 1; i < len(closesA); i++ {
-		returnsA[i-1] = (closesA[i] - closesA[i-1]) / closesA[i-1]
-		returnsB[i-1] = (closesB[i] - closesB[i-1]) / closesB[i-1]
-	}
-
-	corr := calculateCorrelation(returnsA, returnsB)
-	volA := calculateVolatility(closesA)
-	volB := calculateVolatility(closesB)
+	corr := analytics.Correlation(analytics.Returns(closesA), analytics.Returns(closesB))
+	volA := analytics.Volatility(closesA)
+	volB := analytics.Volatility(closesB)
 
 	winner := stockA.Ticker
 	margin := stockA.PercentChange - stockB.PercentChange
@@ -159,73 +124,89 @@ func AnalyzeComparison(c *gin.Context) {
 		margin = -margin
 	}
 
-	// Build prompt— this is where the magic happens. Structured for consistent, engaging output.
-	prompt := fmt.Sprintf(`You are an expert stock analyst explaining to savvy retail traders.
-
-Compare %s vs %s over %s to %s (%s period).
-
-Key stats:
-- %s: %.2f%% (%s)
-- %s: %.2f%% (%s)
-- Winner: %s by %.2f%%
-- Correlation: %.1f%%
-- Volatility: %s %.1f%%, %s %.1f%%
-
-Explain in bullet points:
-• Who won and why (tie to stats)
-• Key drivers (volume, highs/lows, volatility)
-• Seasonal context (e.g., holiday buzz, Santa rally)
-• Risks/opportunities (hedging if correlated, options if volatile)
-• Fun takeaway
-
-Under 300 words, emojis for punch.`,
-		stockA.Ticker, stockB.Ticker, comp.StartDate, comp.EndDate, req.Preset,
-		stockA.Ticker, stockA.PercentChange, ternary(stockA.PercentChange >= 0, "up", "down"),
-		stockB.Ticker, stockB.PercentChange, ternary(stockB.PercentChange >= 0, "up", "down"),
-		winner, margin,
-		corr*100,
-		stockA.Ticker, volA, stockB.Ticker, volB,
-	)
-
-	groqReq := GroqRequest{
-		Model:       "llama-3.3-70b-versatile",
-		Messages:    []GroqMessage{{Role: "user", Content: prompt}},
-		Temperature: 0.7,
-		MaxTokens:   500,
-	}
-
-	body, err := json.Marshal(groqReq)
+	// Build prompt from the selected template— this is where the magic happens
+	tmpl, err := prompts.Get(ternary(req.Template == "", prompts.DefaultName, req.Template), req.TemplateVersion)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
-		return
-	}
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	greq, err := http.NewRequest("POST", "https://api.groq.com/openai/v1/chat/completions", bytes.NewBuffer(body))
+		return nil, &AnalysisRequestError{Message: err.Error()}
+	}
+
+	prompt, err := tmpl.Render(prompts.Data{
+		TickerA:     stockA.Ticker,
+		TickerB:     stockB.Ticker,
+		StartDate:   comp.StartDate,
+		EndDate:     comp.EndDate,
+		Preset:      req.Preset,
+		ChangeA:     stockA.PercentChange,
+		ChangeB:     stockB.PercentChange,
+		Winner:      winner,
+		Margin:      margin,
+		Correlation: corr * 100,
+		VolA:        volA,
+		VolB:        volB,
+		Schema:      analysisSchema,
+	}, req.Params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
-		return
-	}
-	greq.Header.Set("Authorization", "Bearer "+os.Getenv("GROQ_API_KEY"))
-	greq.Header.Set("Content-Type", "application/json")
-
-	gresp, err := client.Do(greq)
-	if err != nil || gresp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusOK, AnalyzeResponse{Analysis: "🧠 AI insights temporarily unavailable (rate limit or network issue)—try again soon!"})
-		return
+		// The template and its params come from the request, so a render
+		// failure is the caller's to fix
+		return nil, &AnalysisRequestError{Message: err.Error()}
 	}
-	defer gresp.Body.Close()
 
-	var groqResp GroqResponse
-	if err := json.NewDecoder(gresp.Body).Decode(&groqResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "AI response error"})
-		return
+	groqReq := services.GroqRequest{
+		Model:       tmpl.Model,
+		Messages:    []services.GroqMessage{{Role: "user", Content: prompt}},
+		Temperature: tmpl.Temperature,
+		MaxTokens:   tmpl.MaxTokens,
 	}
 
-	analysis := "No analysis generated"
-	if len(groqResp.Choices) > 0 {
-		analysis = groqResp.Choices[0].Message.Content
+	// The model may not contradict the stats on who won; on a tie either
+	// ticker is accepted
+	expected := winner
+	if margin == 0 {
+		expected = ""
 	}
+	structured, raw, err := requestStructuredAnalysis(client, groqReq, expected, stockA.Ticker, stockB.Ticker)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAIUnavailable, err)
+	}
+
+	// Guardrails: only the stats and dates in the prompt may be quoted
+	allowed := guardrails.Facts{
+		Numbers: []float64{stockA.PercentChange, stockB.PercentChange, margin, corr * 100, volA, volB},
+		Dates:   []string{comp.StartDate, comp.EndDate},
+	}
+
+	if structured == nil {
+		// The model never produced valid JSON; fall back to whatever it said
+		log.Printf("Structured analysis invalid after %d attempts", maxAnalysisAttempts)
+		analysis := "No analysis generated"
+		var flags []guardrails.Violation
+		if raw != "" {
+			analysis, flags = guardrails.Check(raw, allowed)
+			guardrails.Log("analyze", flags)
+		}
+		return &AnalyzeResponse{
+			Analysis:   guardrails.WithDisclaimer(analysis),
+			Template:   tmpl.Name,
+			Version:    tmpl.Version,
+			Disclaimer: guardrails.Disclaimer,
+			Flags:      flags,
+		}, nil
+	}
+
+	flags := structured.applyGuardrails(allowed)
+	guardrails.Log("analyze", flags)
+
+	return &AnalyzeResponse{
+		Analysis:   guardrails.WithDisclaimer(structured.Markdown()),
+		Structured: structured,
+		Template:   tmpl.Name,
+		Version:    tmpl.Version,
+		Disclaimer: guardrails.Disclaimer,
+		Flags:      flags,
+	}, nil
+}
 
-	c.JSON(http.StatusOK, AnalyzeResponse{Analysis: analysis})
+// ListPromptTemplates returns the presets that can be passed as "template"
+func ListPromptTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"templates": prompts.List()})
 }
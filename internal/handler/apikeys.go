@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey issues a key for the current user. The full key is only
+// returned here; afterwards only its prefix is visible.
+func CreateAPIKey(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		problem.Respond(c, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		log.Printf("Error generating API key: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	apiKey, err := database.CreateAPIKey(auth.CurrentClaims(c).UserID(), req.Name, prefix, hash, auth.MaxActiveAPIKeys)
+	if errors.Is(err, database.ErrTooManyAPIKeys) {
+		problem.Write(c, problem.New(http.StatusConflict,
+			fmt.Sprintf("You can have %d active API keys; revoke one first", auth.MaxActiveAPIKeys)).
+			WithDetail("limit", auth.MaxActiveAPIKeys))
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving API key: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	audit.SetResourceID(c, strconv.Itoa(apiKey.ID))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": apiKey,
+		"key":     key,
+		"message": "Store this key now, it won't be shown again",
+	})
+}
+
+func ListAPIKeys(c *gin.Context) {
+	keys, err := database.ListAPIKeys(auth.CurrentClaims(c).UserID())
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch API keys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys, "daily_quotas": auth.DailyQuotas, "max_active": auth.MaxActiveAPIKeys})
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid API key id")
+		return
+	}
+
+	err = database.RevokeAPIKey(auth.CurrentClaims(c).UserID(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking API key: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// GetAPIKeyUsage returns daily request counters per route, last 30 days by default
+func GetAPIKeyUsage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid API key id")
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		problem.Respond(c, http.StatusBadRequest, "days must be between 1 and 365")
+		return
+	}
+
+	usage, err := database.GetAPIKeyUsage(auth.CurrentClaims(c).UserID(), id, days)
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching API key usage: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch usage")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"api_key_id":   id,
+		"usage":        usage,
+		"daily_quotas": auth.DailyQuotas,
+	})
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/guardrails"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/services"
+	"github.com/chuma-beep/stock-saas/internal/tools"
+	"github.com/gin-gonic/gin"
+)
+
+type AskRequest struct {
+	Question string `json:"question"`
+	MaxSteps int    `json:"max_steps"`
+}
+
+// AskQuestion answers free-form questions by letting the model call tools
+// over the stored stock data instead of relying on a fixed stats block
+func AskQuestion(c *gin.Context) {
+	var req AskRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Question == "" {
+		problem.Respond(c, http.StatusBadRequest, "question is required")
+		return
+	}
+	if req.MaxSteps > tools.DefaultMaxSteps {
+		req.MaxSteps = tools.DefaultMaxSteps
+	}
+
+	system := fmt.Sprintf(`You are an expert stock analyst. Today is %s.
+Answer using only data returned by the tools; call them to fetch prices and compute stats.
+Only tickers already stored in the database are available. If data is missing, say so.
+Be concise: under 200 words, cite the numbers you used.`, time.Now().Format("2006-01-02"))
+
+	groqReq := services.GroqRequest{
+		Model: "llama-3.3-70b-versatile",
+		Messages: []services.GroqMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: req.Question},
+		},
+		Temperature: 0.2,
+		MaxTokens:   700,
+	}
+
+	result, err := tools.StockTools(billing.CurrentPlan(c)).Run(services.NewGroqClient(), groqReq, req.MaxSteps)
+	if err != nil {
+		log.Printf("Tool-calling run failed: %v", err)
+		problem.Write(c, problem.Upstream(err, "AI insights temporarily unavailable, try again soon"))
+		return
+	}
+
+	// Guardrails: figures and dates must come from what the tools returned
+	var allowed guardrails.Facts
+	for _, step := range result.Steps {
+		allowed.Add(guardrails.FactsFromJSON(step.Output))
+	}
+	answer, flags := guardrails.Check(result.Answer, allowed)
+	guardrails.Log("ask", flags)
+
+	c.JSON(http.StatusOK, gin.H{
+		"answer":     guardrails.WithDisclaimer(answer),
+		"steps":      result.Steps,
+		"disclaimer": guardrails.Disclaimer,
+		"flags":      flags,
+	})
+}
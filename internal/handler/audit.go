@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// ListAuditLog serves the admin audit log, newest first. Filters: user_id,
+// action, resource_type, resource_id, request_id, since and until (RFC 3339
+// or YYYY-MM-DD); page with ?before=<next_cursor>.
+func ListAuditLog(c *gin.Context) {
+	fail := func(msg string) {
+		problem.Respond(c, http.StatusBadRequest, msg)
+	}
+
+	f := database.AuditFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+		RequestID:    c.Query("request_id"),
+		Limit:        defaultAuditLimit,
+	}
+
+	var err error
+	if v := c.Query("user_id"); v != "" {
+		if f.UserID, err = strconv.Atoi(v); err != nil {
+			fail("Invalid user_id")
+			return
+		}
+	}
+	if v := c.Query("before"); v != "" {
+		if f.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			fail("Invalid before cursor")
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			fail("limit must be between 1 and 500")
+			return
+		}
+		f.Limit = n
+	}
+	if f.Since, err = parseAuditTime(c.Query("since")); err != nil {
+		fail("since must be RFC 3339 or YYYY-MM-DD")
+		return
+	}
+	if f.Until, err = parseAuditTime(c.Query("until")); err != nil {
+		fail("until must be RFC 3339 or YYYY-MM-DD")
+		return
+	}
+
+	entries, err := database.ListAuditEntries(f)
+	if err != nil {
+		log.Printf("Error listing audit log: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch audit log")
+		return
+	}
+
+	var next *int64
+	if len(entries) == f.Limit {
+		next = &entries[len(entries)-1].ID
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "next_cursor": next})
+}
+
+func parseAuditTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
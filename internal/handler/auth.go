@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const minPasswordLength = 8
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type TokenResponse struct {
+	AccessToken  string         `json:"access_token"`
+	RefreshToken string         `json:"refresh_token"`
+	TokenType    string         `json:"token_type"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+	User         *database.User `json:"user"`
+}
+
+func Signup(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	errs := validate.Errors{}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		errs.Add("email", "must be a valid email address")
+	}
+	switch {
+	case len(req.Password) < minPasswordLength:
+		errs.Add("password", "must be at least 8 characters")
+	case len(req.Password) > auth.MaxPasswordBytes:
+		errs.Add("password", "must be at most 72 bytes")
+	}
+	if !validate.OK(c, errs) {
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
+
+	user, err := database.CreateUser(email, hash)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			problem.Respond(c, http.StatusConflict, "An account with this email already exists")
+			return
+		}
+		log.Printf("Error creating user: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
+
+	issueTokens(c, http.StatusCreated, user)
+}
+
+func Login(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	user, err := database.GetUserByEmail(strings.ToLower(strings.TrimSpace(req.Email)))
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Error loading user: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	// Unknown emails still pay for a bcrypt comparison, so response times
+	// don't reveal which addresses have accounts
+	hash := ""
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if !auth.CheckPassword(hash, req.Password) {
+		problem.Respond(c, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+
+	issueTokens(c, http.StatusOK, user)
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh pair.
+// The old refresh token is revoked so it can't be replayed.
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		problem.Respond(c, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	userID, err := database.ConsumeRefreshToken(auth.HashToken(req.RefreshToken))
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error consuming refresh token: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userID, err)
+		problem.Respond(c, http.StatusUnauthorized, auth.ErrInvalidToken.Error())
+		return
+	}
+
+	issueTokens(c, http.StatusOK, user)
+}
+
+// Me returns the authenticated user
+func Me(c *gin.Context) {
+	claims := auth.CurrentClaims(c)
+	user, err := database.GetUserByID(claims.UserID())
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func issueTokens(c *gin.Context, status int, user *database.User) {
+	access, expiresAt, err := auth.NewAccessToken(user.ID, user.Email, user.Role)
+	if err != nil {
+		log.Printf("Error signing access token: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to issue token")
+		return
+	}
+
+	refresh, refreshHash, err := auth.NewRefreshToken()
+	if err == nil {
+		err = database.SaveRefreshToken(user.ID, refreshHash, time.Now().Add(auth.RefreshTokenTTL))
+	}
+	if err != nil {
+		log.Printf("Error saving refresh token: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to issue token")
+		return
+	}
+
+	c.JSON(status, TokenResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+		User:         user,
+	})
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const maxWebhookBody = 64 << 10
+
+func ListPlans(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"plans": billing.Plans})
+}
+
+// GetSubscription returns the user's plan, subscription and today's usage
+func GetSubscription(c *gin.Context) {
+	claims := auth.CurrentClaims(c)
+	sub, err := database.GetSubscription(claims.UserID())
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Error loading subscription: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+	analyses, err := database.GetPlanUsage(billing.UsageSubject(c), billing.MetricAnalyses)
+	if err != nil {
+		log.Printf("Error loading plan usage: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan":         billing.CurrentPlan(c),
+		"subscription": sub,
+		"usage":        gin.H{"analyses_today": analyses},
+	})
+}
+
+// CreateCheckout starts an upgrade; the client redirects to the returned URL
+func CreateCheckout(c *gin.Context) {
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	claims := auth.CurrentClaims(c)
+	checkout, err := billing.Current.CreateCheckout(claims.UserID(), claims.Email, req.Plan)
+	if errors.Is(err, billing.ErrUnknownPlan) {
+		problem.Respond(c, http.StatusBadRequest, "plan must be pro or team")
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating checkout: %v", err)
+		problem.Respond(c, http.StatusBadGateway, "Failed to start checkout")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"checkout": checkout})
+}
+
+// CancelSubscription asks the provider to cancel; the change lands through
+// its webhook
+func CancelSubscription(c *gin.Context) {
+	sub, ok := activeSubscription(c)
+	if !ok {
+		return
+	}
+	if err := billing.Current.CancelSubscription(sub); err != nil {
+		log.Printf("Error canceling subscription: %v", err)
+		problem.Respond(c, http.StatusBadGateway, "Failed to cancel subscription")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription canceled"})
+}
+
+// BillingWebhook receives subscription lifecycle events from the provider
+func BillingWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if !billingWebhookOK(c, billing.HandleWebhook(payload, c.Request.Header)) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// CompleteFakeCheckout stands in for the provider's payment page when the
+// fake provider is configured
+func CompleteFakeCheckout(c *gin.Context) {
+	fake, ok := billing.Current.(*billing.FakeProvider)
+	if !ok {
+		problem.Respond(c, http.StatusNotFound, "Not found")
+		return
+	}
+
+	userID := auth.CurrentClaims(c).UserID()
+	sub, err := database.GetSubscription(userID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Error loading subscription: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+
+	err = fake.CompleteCheckout(c.Param("id"), userID, sub)
+	if errors.Is(err, billing.ErrUnknownCheckout) {
+		problem.Respond(c, http.StatusNotFound, "Checkout not found")
+		return
+	}
+	if !billingWebhookOK(c, err) {
+		return
+	}
+	respondWithSubscription(c)
+}
+
+// SimulateBillingEvent makes the fake provider send a renewal, failed
+// payment or cancellation webhook for the user's subscription
+func SimulateBillingEvent(c *gin.Context) {
+	fake, ok := billing.Current.(*billing.FakeProvider)
+	if !ok {
+		problem.Respond(c, http.StatusNotFound, "Not found")
+		return
+	}
+	var req struct {
+		Event string `json:"event"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	switch req.Event {
+	case billing.EventSubscriptionRenewed, billing.EventPaymentFailed, billing.EventSubscriptionCanceled:
+	default:
+		problem.Respond(c, http.StatusBadRequest, "event must be subscription.renewed, subscription.payment_failed or subscription.canceled")
+		return
+	}
+
+	sub, ok := activeSubscription(c)
+	if !ok {
+		return
+	}
+	if !billingWebhookOK(c, fake.Simulate(req.Event, sub)) {
+		return
+	}
+	respondWithSubscription(c)
+}
+
+func activeSubscription(c *gin.Context) (*database.Subscription, bool) {
+	sub, err := database.GetSubscription(auth.CurrentClaims(c).UserID())
+	if err == nil && sub.Status == billing.StatusCanceled {
+		err = database.ErrNotFound
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "No active subscription")
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error loading subscription: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load subscription")
+		return nil, false
+	}
+	return sub, true
+}
+
+func respondWithSubscription(c *gin.Context) {
+	sub, err := database.GetSubscription(auth.CurrentClaims(c).UserID())
+	if err != nil {
+		log.Printf("Error loading subscription: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load subscription")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscription": sub})
+}
+
+// billingWebhookOK turns a webhook processing error into a response; true
+// means no error
+func billingWebhookOK(c *gin.Context, err error) bool {
+	if errors.Is(err, billing.ErrInvalidSignature) {
+		problem.Respond(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err != nil {
+		log.Printf("Error processing billing webhook: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to process billing event")
+		return false
+	}
+	return true
+}
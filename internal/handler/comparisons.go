@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/authz"
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/services"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	slugLength         = 8
+	slugAlphabet       = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	slugCreateAttempts = 5
+)
+
+const (
+	visibilityPrivate = "private"
+	visibilityPublic  = "public"
+)
+
+const (
+	normalizationNone  = "none"
+	normalizationPct   = "percent"
+	normalizationIndex = "index"
+)
+
+// uniqueViolationCode is Postgres' error code for a UNIQUE constraint hit
+const uniqueViolationCode = "23505"
+
+type comparisonRequest struct {
+	Title         string   `json:"title"`
+	Tickers       []string `json:"tickers"`
+	StartDate     string   `json:"start_date"`
+	EndDate       string   `json:"end_date"`
+	Preset        string   `json:"preset"`
+	Template      string   `json:"template"`
+	Normalization string   `json:"normalization"`
+	Visibility    string   `json:"visibility"`
+	OrgID         *int     `json:"org_id"`
+}
+
+// SaveComparison stores a comparison definition and gives it a share slug.
+// With org_id set it is shared with that organization.
+func SaveComparison(c *gin.Context) {
+	sc, ok := bindComparison(c)
+	if !ok {
+		return
+	}
+	if sc.OrgID != nil && !authz.Check(c, authz.Write, authz.Org(*sc.OrgID), "Organization not found") {
+		return
+	}
+	sc.UserID = auth.CurrentClaims(c).UserID()
+
+	var saved *database.SavedComparison
+	var err error
+	for attempt := 0; attempt < slugCreateAttempts; attempt++ {
+		if sc.Slug, err = newSlug(); err != nil {
+			break
+		}
+		saved, err = database.CreateSavedComparison(sc)
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolationCode {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("Error saving comparison: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to save comparison")
+		return
+	}
+
+	audit.SetResourceID(c, strconv.Itoa(saved.ID))
+	audit.Diff(c, nil, saved)
+	c.JSON(http.StatusCreated, gin.H{"comparison": saved})
+}
+
+func ListComparisons(c *gin.Context) {
+	list, err := database.ListSavedComparisons(auth.CurrentClaims(c).UserID())
+	if err != nil {
+		log.Printf("Error listing comparisons: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch comparisons")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comparisons": list})
+}
+
+func GetComparison(c *gin.Context) {
+	sc, ok := loadComparison(c, authz.Read)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comparison": sc})
+}
+
+// UpdateComparison changes the definition or visibility; the slug and owner
+// stay the same
+func UpdateComparison(c *gin.Context) {
+	sc, ok := bindComparison(c)
+	if !ok {
+		return
+	}
+	current, ok := loadComparison(c, authz.Write)
+	if !ok {
+		return
+	}
+	sc.ID = current.ID
+
+	updated, err := database.UpdateSavedComparison(sc)
+	if !comparisonOK(c, err) {
+		return
+	}
+	audit.Diff(c, current, updated)
+	c.JSON(http.StatusOK, gin.H{"comparison": updated})
+}
+
+func DeleteComparison(c *gin.Context) {
+	sc, ok := loadComparison(c, authz.Delete)
+	if !ok {
+		return
+	}
+	if !comparisonOK(c, database.DeleteSavedComparison(sc.ID)) {
+		return
+	}
+	audit.Diff(c, sc, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Comparison deleted"})
+}
+
+// AnalyzeSavedComparison runs the AI analysis on fresh data and stores it
+// with the comparison so shared links show it without another model call
+func AnalyzeSavedComparison(c *gin.Context) {
+	sc, ok := loadComparison(c, authz.Write)
+	if !ok {
+		return
+	}
+	if len(sc.Tickers) != 2 {
+		problem.Respond(c, http.StatusBadRequest, "AI analysis needs exactly two tickers")
+		return
+	}
+
+	series, err := loadComparisonSeries(sc)
+	if err != nil {
+		log.Printf("Error loading comparison data: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load stock data")
+		return
+	}
+	for _, s := range series {
+		if len(s.Data) == 0 {
+			problem.Respond(c, http.StatusNotFound, "Missing data. Fetch stocks first using /fetch/:ticker")
+			return
+		}
+	}
+
+	resp, err := RunAnalysis(services.NewGroqClient(), AnalyzeRequest{
+		Comparison: ComparisonResponse{StartDate: sc.StartDate, EndDate: sc.EndDate, Comparison: series},
+		Preset:     sc.Preset,
+		Template:   sc.Template,
+	})
+	var reqErr *AnalysisRequestError
+	switch {
+	case errors.As(err, &reqErr):
+		problem.Respond(c, http.StatusBadRequest, reqErr.Message)
+		return
+	case errors.Is(err, ErrAIUnavailable):
+		log.Printf("Groq analysis failed: %v", err)
+		problem.Write(c, problem.Upstream(err, "AI insights temporarily unavailable, try again soon"))
+		return
+	case err != nil:
+		log.Printf("Analysis failed: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	analysis, _ := json.Marshal(resp)
+	if !comparisonOK(c, database.SaveComparisonAnalysis(sc.ID, analysis)) {
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetSharedComparison serves /c/:slug: the saved definition and analysis plus
+// fresh price data. Private comparisons are only visible to their owner or,
+// when shared, to members of the organization.
+func GetSharedComparison(c *gin.Context) {
+	sc, err := database.GetSavedComparisonBySlug(c.Param("slug"))
+	if !comparisonOK(c, err) {
+		return
+	}
+	if sc.Visibility == visibilityPrivate && !authz.Can(c, authz.Read, comparisonResource(sc)) {
+		problem.Respond(c, http.StatusNotFound, "Comparison not found")
+		return
+	}
+
+	series, err := loadComparisonSeries(sc)
+	if err != nil {
+		log.Printf("Error loading comparison data: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load stock data")
+		return
+	}
+
+	data := make([]gin.H, len(series))
+	for i, s := range series {
+		data[i] = gin.H{
+			"ticker":         s.Ticker,
+			"percent_change": s.PercentChange,
+			"data":           normalizePoints(s.Data, sc.Normalization),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"title":         sc.Title,
+		"slug":          sc.Slug,
+		"tickers":       sc.Tickers,
+		"start_date":    sc.StartDate,
+		"end_date":      sc.EndDate,
+		"preset":        sc.Preset,
+		"normalization": sc.Normalization,
+		"comparison":    data,
+		"analysis":      sc.Analysis,
+		"analyzed_at":   sc.AnalyzedAt,
+	})
+}
+
+func bindComparison(c *gin.Context) (*database.SavedComparison, bool) {
+	var req comparisonRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return nil, false
+	}
+
+	fail := func(msg string) (*database.SavedComparison, bool) {
+		problem.Respond(c, http.StatusBadRequest, msg)
+		return nil, false
+	}
+
+	plan := billing.CurrentPlan(c)
+	if len(req.Tickers) < 2 {
+		return fail("At least 2 tickers are required")
+	}
+	if len(req.Tickers) > plan.MaxComparedTickers {
+		problem.Write(c, billing.LimitError(http.StatusForbidden, plan,
+			fmt.Sprintf("Your plan compares up to %d tickers", plan.MaxComparedTickers)))
+		return nil, false
+	}
+	errs := validate.Errors{}
+	tickers := make([]string, len(req.Tickers))
+	for i, t := range req.Tickers {
+		tickers[i] = errs.Ticker(fmt.Sprintf("tickers[%d]", i), t)
+	}
+	r := errs.DateRange("start_date", "end_date", req.StartDate, req.EndDate)
+	if !validate.OK(c, errs) {
+		return nil, false
+	}
+	if !billing.HistoryAllowed(plan, r.Start) {
+		problem.Write(c, billing.LimitError(http.StatusForbidden, plan,
+			fmt.Sprintf("start_date is older than your plan's history depth of %d days", plan.HistoryDays)))
+		return nil, false
+	}
+
+	if req.Normalization == "" {
+		req.Normalization = normalizationNone
+	}
+	switch req.Normalization {
+	case normalizationNone, normalizationPct, normalizationIndex:
+	default:
+		return fail("normalization must be none, percent or index")
+	}
+
+	if req.Visibility == "" {
+		req.Visibility = visibilityPrivate
+	}
+	switch req.Visibility {
+	case visibilityPrivate, visibilityPublic:
+	default:
+		return fail("visibility must be private or public")
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = strings.Join(tickers, " vs ")
+	}
+
+	return &database.SavedComparison{
+		Title:         title,
+		Tickers:       tickers,
+		StartDate:     r.StartDate(),
+		EndDate:       r.EndDate(),
+		Preset:        req.Preset,
+		Template:      req.Template,
+		Normalization: req.Normalization,
+		Visibility:    req.Visibility,
+		OrgID:         req.OrgID,
+	}, true
+}
+
+// loadComparisonSeries reads current data for every ticker in the comparison
+func loadComparisonSeries(sc *database.SavedComparison) ([]StockComparison, error) {
+	series := make([]StockComparison, len(sc.Tickers))
+	for i, ticker := range sc.Tickers {
+		rows, err := database.GetStockData(ticker, sc.StartDate, sc.EndDate)
+		if err != nil {
+			return nil, err
+		}
+
+		s := StockComparison{Ticker: ticker, Data: make([]ComparisonPoint, len(rows))}
+		for j, row := range rows {
+			s.Data[j] = ComparisonPoint{
+				Date:   row["date"].(string),
+				Close:  row["close"].(float64),
+				Volume: row["volume"].(int64),
+			}
+		}
+		if len(s.Data) > 0 {
+			first, last := s.Data[0].Close, s.Data[len(s.Data)-1].Close
+			s.PercentChange = ((last - first) / first) * 100
+		}
+		series[i] = s
+	}
+	return series, nil
+}
+
+// normalizePoints adds a "value" to each point: percent change from the first
+// close, or the close rebased to 100
+func normalizePoints(points []ComparisonPoint, normalization string) []gin.H {
+	out := make([]gin.H, len(points))
+	for i, p := range points {
+		out[i] = gin.H{"date": p.Date, "close": p.Close, "volume": p.Volume}
+		if normalization == normalizationNone || points[0].Close == 0 {
+			continue
+		}
+		ratio := p.Close / points[0].Close
+		if normalization == normalizationPct {
+			out[i]["value"] = (ratio - 1) * 100
+		} else {
+			out[i]["value"] = ratio * 100
+		}
+	}
+	return out
+}
+
+func newSlug() (string, error) {
+	b := make([]byte, slugLength)
+	max := big.NewInt(int64(len(slugAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = slugAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// loadComparison reads the :id comparison and checks the principal may
+// perform action on it
+func loadComparison(c *gin.Context, action authz.Action) (*database.SavedComparison, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid comparison id")
+		return nil, false
+	}
+	sc, err := database.GetSavedComparison(id)
+	if !comparisonOK(c, err) {
+		return nil, false
+	}
+	if !authz.Check(c, action, comparisonResource(sc), "Comparison not found") {
+		return nil, false
+	}
+	return sc, true
+}
+
+func comparisonResource(sc *database.SavedComparison) authz.Resource {
+	return authz.Resource{OwnerID: sc.UserID, OrgID: orgIDOf(sc.OrgID)}
+}
+
+// comparisonOK turns a database error into a response; true means no error
+func comparisonOK(c *gin.Context, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "Comparison not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error handling saved comparison: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to process comparison")
+		return false
+	}
+	return true
+}
@@ -1,84 +1,246 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
-	"time"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/chuma-beep/stock-saas/internal/audit"
 	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/spam"
 	"github.com/gin-gonic/gin"
 )
 
-type Feedback struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Feedback  string    `json:"feedback"`
-	CreatedAt time.Time `json:"created_at"`
-}
+const (
+	defaultFeedbackLimit = 50
+	maxFeedbackLimit     = 200
+	maxFeedbackNotes     = 5000
+
+	maxFeedbackBody = 16 << 10
+	maxFeedbackText = 5000
+	maxFeedbackName = 100
+	maxEmailLength  = 254
+)
 
+// SubmitFeedback accepts anonymous feedback. Posts that trip the honeypot
+// are dropped and ones the classifier flags go straight to the spam queue;
+// both get the normal response so bots can't tell.
 func SubmitFeedback(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFeedbackBody)
+
 	var req struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Feedback string `json:"feedback"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		Feedback  string `json:"feedback"`
+		Website   string `json:"website"` // honeypot, hidden from people
+		Challenge string `json:"challenge"`
+		Nonce     string `json:"nonce"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Respond(c, http.StatusRequestEntityTooLarge, "Feedback is too large")
+			return
+		}
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	if req.Feedback == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Feedback is required"})
+	f := &database.Feedback{
+		Name:     strings.TrimSpace(req.Name),
+		Email:    strings.TrimSpace(req.Email),
+		Feedback: strings.TrimSpace(req.Feedback),
+		Status:   database.FeedbackNew,
+	}
+	if f.Feedback == "" {
+		problem.Respond(c, http.StatusBadRequest, "Feedback is required")
+		return
+	}
+	if utf8.RuneCountInString(f.Feedback) > maxFeedbackText {
+		problem.Respond(c, http.StatusBadRequest, "Feedback must be at most 5000 characters")
 		return
 	}
+	if utf8.RuneCountInString(f.Name) > maxFeedbackName {
+		problem.Respond(c, http.StatusBadRequest, "Name must be at most 100 characters")
+		return
+	}
+	if f.Email != "" {
+		addr, err := mail.ParseAddress(f.Email)
+		if err != nil || addr.Address != f.Email || len(f.Email) > maxEmailLength {
+			problem.Respond(c, http.StatusBadRequest, "Email must be a valid address")
+			return
+		}
+	}
 
-	query := `
-		INSERT INTO feedback (name, email, feedback)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at
-	`
+	if req.Website != "" {
+		log.Printf("Dropped feedback from %s: honeypot filled", c.ClientIP())
+		c.JSON(http.StatusOK, gin.H{"message": "Feedback submitted successfully"})
+		return
+	}
+	if spam.PowDifficulty() > 0 && !spam.VerifySolution(req.Challenge, req.Nonce) {
+		problem.Respond(c, http.StatusBadRequest, "Missing or invalid challenge; solve a new one from GET /feedback/challenge")
+		return
+	}
 
-	var id int
-	var createdAt time.Time
-	err := database.DB.QueryRow(query, req.Name, req.Email, req.Feedback).Scan(&id, &createdAt)
+	verdict, err := spam.Current.Classify(spam.Submission{Name: f.Name, Email: f.Email, Text: f.Feedback, IP: c.ClientIP()})
+	if err != nil {
+		log.Printf("Error classifying feedback: %v", err)
+	} else if verdict.Spam {
+		f.Status = database.FeedbackSpam
+		f.Notes = "Auto-flagged: " + strings.Join(verdict.Reasons, ", ")
+	}
+
+	f, err = database.CreateFeedback(f)
 	if err != nil {
 		log.Printf("Error saving feedback: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		problem.Respond(c, http.StatusInternalServerError, "Failed to save feedback")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Feedback submitted successfully",
-		"id":      id,
+		"id":      f.ID,
 	})
 }
 
-func GetFeedback(c *gin.Context) {
-	query := `
-		SELECT id, name, email, feedback, created_at
-		FROM feedback
-		ORDER BY created_at DESC
-		LIMIT 100
-	`
-
-	rows, err := database.DB.Query(query)
+// FeedbackChallenge issues the proof-of-work challenge SubmitFeedback
+// expects. difficulty 0 means none is required.
+func FeedbackChallenge(c *gin.Context) {
+	ch, err := spam.NewChallenge()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feedback"})
+		log.Printf("Error creating feedback challenge: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create challenge")
 		return
 	}
-	defer rows.Close()
+	c.JSON(http.StatusOK, gin.H{"challenge": ch})
+}
 
-	var feedbacks []Feedback
-	for rows.Next() {
-		var f Feedback
-		err := rows.Scan(&f.ID, &f.Name, &f.Email, &f.Feedback, &f.CreatedAt)
+// ListFeedback is the admin moderation queue, newest first. Filter with
+// ?status= and search name, email and text with ?q=; page with
+// ?before=<next_cursor>.
+func ListFeedback(c *gin.Context) {
+	f := database.FeedbackFilter{
+		Status: c.Query("status"),
+		Query:  strings.TrimSpace(c.Query("q")),
+		Limit:  defaultFeedbackLimit,
+	}
+	if f.Status != "" && !slices.Contains(database.FeedbackStatuses, f.Status) {
+		problem.Respond(c, http.StatusBadRequest, "status must be new, triaged, resolved or spam")
+		return
+	}
+	if v := c.Query("before"); v != "" {
+		id, err := strconv.Atoi(v)
 		if err != nil {
-			continue
+			problem.Respond(c, http.StatusBadRequest, "Invalid before cursor")
+			return
+		}
+		f.BeforeID = id
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxFeedbackLimit {
+			problem.Respond(c, http.StatusBadRequest, "limit must be between 1 and 200")
+			return
 		}
-		feedbacks = append(feedbacks, f)
+		f.Limit = n
+	}
+
+	feedbacks, err := database.ListFeedback(f)
+	if err != nil {
+		log.Printf("Error listing feedback: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch feedback")
+		return
+	}
+
+	var next *int
+	if len(feedbacks) == f.Limit {
+		next = &feedbacks[len(feedbacks)-1].ID
 	}
+	c.JSON(http.StatusOK, gin.H{"feedbacks": feedbacks, "next_cursor": next})
+}
 
-	c.JSON(http.StatusOK, gin.H{"feedbacks": feedbacks})
+func GetFeedback(c *gin.Context) {
+	id, ok := feedbackID(c)
+	if !ok {
+		return
+	}
+	f, err := database.GetFeedback(id)
+	if !feedbackOK(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"feedback": f})
+}
+
+// UpdateFeedback moves feedback through the workflow and edits its internal
+// notes. Omitted fields are left as they are.
+func UpdateFeedback(c *gin.Context) {
+	id, ok := feedbackID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Status *string `json:"status"`
+		Notes  *string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Status == nil && req.Notes == nil) {
+		problem.Respond(c, http.StatusBadRequest, "status or notes is required")
+		return
+	}
+
+	current, err := database.GetFeedback(id)
+	if !feedbackOK(c, err) {
+		return
+	}
+	status, notes := current.Status, current.Notes
+	if req.Status != nil {
+		status = *req.Status
+		if !slices.Contains(database.FeedbackStatuses, status) {
+			problem.Respond(c, http.StatusBadRequest, "status must be new, triaged, resolved or spam")
+			return
+		}
+	}
+	if req.Notes != nil {
+		notes = strings.TrimSpace(*req.Notes)
+		if utf8.RuneCountInString(notes) > maxFeedbackNotes {
+			problem.Respond(c, http.StatusBadRequest, "notes must be at most 5000 characters")
+			return
+		}
+	}
+
+	updated, err := database.UpdateFeedback(id, status, notes)
+	if !feedbackOK(c, err) {
+		return
+	}
+	audit.Diff(c, current, updated)
+	c.JSON(http.StatusOK, gin.H{"feedback": updated})
+}
+
+func feedbackID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid feedback id")
+		return 0, false
+	}
+	return id, true
+}
+
+// feedbackOK turns a database error into a response; true means no error
+func feedbackOK(c *gin.Context, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "Feedback not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error handling feedback: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to process feedback")
+		return false
+	}
+	return true
 }
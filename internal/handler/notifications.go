@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/notify"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxNotificationChannels = 10
+	// webhookResolveTimeout bounds the DNS lookup that checks a webhook target
+	webhookResolveTimeout = 3 * time.Second
+)
+
+type notificationChannelRequest struct {
+	Kind    string   `json:"kind"`
+	Target  string   `json:"target"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+func ListNotificationChannels(c *gin.Context) {
+	channels, err := database.ListNotificationChannels(auth.CurrentClaims(c).UserID())
+	if err != nil {
+		log.Printf("Error listing notification channels: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch notification channels")
+		return
+	}
+	for i := range channels {
+		channels[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": channels})
+}
+
+// CreateNotificationChannel adds an email or webhook destination. Webhook
+// channels get a signing secret, which is only returned here.
+func CreateNotificationChannel(c *gin.Context) {
+	var req notificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	ch, ok := normalizeNotificationChannel(c, strings.ToLower(strings.TrimSpace(req.Kind)), req)
+	if !ok {
+		return
+	}
+	ch.UserID = auth.CurrentClaims(c).UserID()
+
+	existing, err := database.ListNotificationChannels(ch.UserID)
+	if !notificationChannelOK(c, err) {
+		return
+	}
+	if len(existing) >= maxNotificationChannels {
+		problem.Respond(c, http.StatusBadRequest, "You can have at most 10 notification channels")
+		return
+	}
+
+	if ch.Kind == notify.KindWebhook {
+		if ch.Secret, err = notify.NewWebhookSecret(); !notificationChannelOK(c, err) {
+			return
+		}
+	}
+
+	created, err := database.CreateNotificationChannel(ch)
+	if !notificationChannelOK(c, err) {
+		return
+	}
+	audit.SetResourceID(c, strconv.Itoa(created.ID))
+	audit.Diff(c, nil, auditedChannel(created))
+	c.JSON(http.StatusCreated, gin.H{"channel": created})
+}
+
+func GetNotificationChannel(c *gin.Context) {
+	id, ok := notificationChannelID(c)
+	if !ok {
+		return
+	}
+	ch, err := database.GetNotificationChannel(auth.CurrentClaims(c).UserID(), id)
+	if !notificationChannelOK(c, err) {
+		return
+	}
+	ch.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"channel": ch})
+}
+
+// UpdateNotificationChannel changes the target, events or enabled flag.
+// The kind can't change; create a new channel instead.
+func UpdateNotificationChannel(c *gin.Context) {
+	id, ok := notificationChannelID(c)
+	if !ok {
+		return
+	}
+	var req notificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	userID := auth.CurrentClaims(c).UserID()
+	current, err := database.GetNotificationChannel(userID, id)
+	if !notificationChannelOK(c, err) {
+		return
+	}
+	ch, ok := normalizeNotificationChannel(c, current.Kind, req)
+	if !ok {
+		return
+	}
+	ch.ID = id
+	ch.UserID = userID
+
+	updated, err := database.UpdateNotificationChannel(ch)
+	if !notificationChannelOK(c, err) {
+		return
+	}
+	audit.Diff(c, auditedChannel(current), auditedChannel(updated))
+	updated.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"channel": updated})
+}
+
+func DeleteNotificationChannel(c *gin.Context) {
+	id, ok := notificationChannelID(c)
+	if !ok {
+		return
+	}
+	userID := auth.CurrentClaims(c).UserID()
+	before, err := database.GetNotificationChannel(userID, id)
+	if !notificationChannelOK(c, err) {
+		return
+	}
+	if !notificationChannelOK(c, database.DeleteNotificationChannel(userID, id)) {
+		return
+	}
+	audit.Diff(c, auditedChannel(before), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Notification channel deleted"})
+}
+
+// auditedChannel is what the audit log keeps of a channel. Webhook URLs
+// often carry a token, so only their fingerprint is recorded.
+func auditedChannel(ch *database.NotificationChannel) *database.NotificationChannel {
+	if ch == nil || ch.Kind != notify.KindWebhook {
+		return ch
+	}
+	out := *ch
+	out.Target = audit.Fingerprint(ch.Target)
+	return &out
+}
+
+// TestNotificationChannel sends a test message right away so users can
+// check their SMTP or webhook setup. It only says whether delivery worked:
+// echoing the remote status would let a webhook probe other hosts.
+func TestNotificationChannel(c *gin.Context) {
+	id, ok := notificationChannelID(c)
+	if !ok {
+		return
+	}
+	ch, err := database.GetNotificationChannel(auth.CurrentClaims(c).UserID(), id)
+	if !notificationChannelOK(c, err) {
+		return
+	}
+
+	msg := notify.NewMessage(notify.EventTest, "Test notification", "This is a test notification from Stock SaaS.",
+		map[string]interface{}{"channel_id": ch.ID})
+	delivery := notify.Default.Deliver(*ch, msg)
+	if delivery.Status != notify.StatusDelivered {
+		problem.Respond(c, http.StatusBadGateway, "Test notification could not be delivered")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivered": true, "attempts": delivery.Attempts})
+}
+
+// ListNotificationDeliveries returns the delivery log, newest first
+func ListNotificationDeliveries(c *gin.Context) {
+	channelID := 0
+	if v := c.Query("channel_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "Invalid channel_id")
+			return
+		}
+		channelID = id
+	}
+
+	limit := defaultTriggerLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTriggerLimit {
+			problem.Respond(c, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := database.ListNotificationDeliveries(auth.CurrentClaims(c).UserID(), channelID, limit)
+	if err != nil {
+		log.Printf("Error listing notification deliveries: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch delivery log")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func normalizeNotificationChannel(c *gin.Context, kind string, req notificationChannelRequest) (*database.NotificationChannel, bool) {
+	fail := func(msg string) (*database.NotificationChannel, bool) {
+		problem.Respond(c, http.StatusBadRequest, msg)
+		return nil, false
+	}
+
+	target := strings.TrimSpace(req.Target)
+	switch kind {
+	case notify.KindEmail:
+		addr, err := mail.ParseAddress(target)
+		if err != nil {
+			return fail("target must be a valid email address")
+		}
+		target = addr.Address
+	case notify.KindWebhook:
+		ctx, cancel := context.WithTimeout(c.Request.Context(), webhookResolveTimeout)
+		defer cancel()
+		if err := notify.CheckWebhookURL(ctx, target); err != nil {
+			return fail(err.Error())
+		}
+	default:
+		return fail("kind must be email or webhook")
+	}
+
+	events := []string{}
+	for _, e := range req.Events {
+		e = strings.TrimSpace(e)
+		if !slices.Contains(notify.Events, e) {
+			return fail("Unknown event: " + e)
+		}
+		if !slices.Contains(events, e) {
+			events = append(events, e)
+		}
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	return &database.NotificationChannel{Kind: kind, Target: target, Events: events, Enabled: enabled}, true
+}
+
+func notificationChannelID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid channel id")
+		return 0, false
+	}
+	return id, true
+}
+
+// notificationChannelOK turns an error into a response; true means no error
+func notificationChannelOK(c *gin.Context, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "Notification channel not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error handling notification channel: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to process notification channel")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/authz"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type orgMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// ListOrganizations returns the organizations the user belongs to
+func ListOrganizations(c *gin.Context) {
+	orgs, err := database.ListOrganizationsForUser(auth.CurrentClaims(c).UserID())
+	if err != nil {
+		log.Printf("Error listing organizations: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch organizations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+}
+
+// CreateOrganization creates an organization owned by the caller
+func CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		problem.Respond(c, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	org, err := database.CreateOrganization(strings.TrimSpace(req.Name), auth.CurrentClaims(c).UserID(), authz.RoleOwner)
+	if !orgOK(c, err) {
+		return
+	}
+	audit.SetResourceID(c, strconv.Itoa(org.ID))
+	audit.Diff(c, nil, org)
+	c.JSON(http.StatusCreated, gin.H{"organization": org})
+}
+
+// GetOrganization returns the organization and its members
+func GetOrganization(c *gin.Context) {
+	orgID, _ := strconv.Atoi(c.Param("id"))
+	org, err := database.GetOrganization(orgID)
+	if !orgOK(c, err) {
+		return
+	}
+	org.Role = authz.Role(c, orgID)
+
+	members, err := database.ListOrgMembers(orgID)
+	if !orgOK(c, err) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"organization": org, "members": members})
+}
+
+func RenameOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		problem.Respond(c, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	orgID, _ := strconv.Atoi(c.Param("id"))
+	before, err := database.GetOrganization(orgID)
+	if !orgOK(c, err) {
+		return
+	}
+	if !orgOK(c, database.RenameOrganization(orgID, strings.TrimSpace(req.Name))) {
+		return
+	}
+	audit.Diff(c, gin.H{"name": before.Name}, gin.H{"name": strings.TrimSpace(req.Name)})
+	GetOrganization(c)
+}
+
+// DeleteOrganization deletes the organization and its shared resources
+func DeleteOrganization(c *gin.Context) {
+	orgID, _ := strconv.Atoi(c.Param("id"))
+	if !orgOK(c, database.DeleteOrganization(orgID)) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted"})
+}
+
+// AddOrgMember adds an existing user by email. Admins can add analysts and
+// viewers; only owners can add admins and owners.
+func AddOrgMember(c *gin.Context) {
+	var req orgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	orgID, _ := strconv.Atoi(c.Param("id"))
+	if !canAssignRole(c, orgID, req.Role) {
+		return
+	}
+
+	user, err := database.GetUserByEmail(strings.ToLower(strings.TrimSpace(req.Email)))
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "No user with that email")
+		return
+	}
+	if !orgOK(c, err) {
+		return
+	}
+
+	err = database.AddOrgMember(orgID, user.ID, req.Role)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+		problem.Respond(c, http.StatusConflict, "User is already a member")
+		return
+	}
+	if !orgOK(c, err) {
+		return
+	}
+	audit.Diff(c, nil, gin.H{"member_id": user.ID, "role": req.Role})
+	respondWithMembers(c, http.StatusCreated, orgID)
+}
+
+// UpdateOrgMember changes a member's role
+func UpdateOrgMember(c *gin.Context) {
+	var req orgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	orgID, _ := strconv.Atoi(c.Param("id"))
+	userID, ok := memberUserID(c)
+	if !ok || !canManageMember(c, orgID, userID) || !canAssignRole(c, orgID, req.Role) {
+		return
+	}
+	if req.Role != authz.RoleOwner && !keepsAnOwner(c, orgID, userID) {
+		return
+	}
+
+	before, err := database.GetOrgMemberRole(orgID, userID)
+	if !orgMemberOK(c, err) {
+		return
+	}
+	if !orgMemberOK(c, database.UpdateOrgMemberRole(orgID, userID, req.Role)) {
+		return
+	}
+	audit.Diff(c, gin.H{"member_id": userID, "role": before}, gin.H{"member_id": userID, "role": req.Role})
+	respondWithMembers(c, http.StatusOK, orgID)
+}
+
+// RemoveOrgMember removes a member. Any member may remove themselves.
+func RemoveOrgMember(c *gin.Context) {
+	orgID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid organization id")
+		return
+	}
+	userID, ok := memberUserID(c)
+	if !ok {
+		return
+	}
+
+	self := userID == auth.CurrentClaims(c).UserID()
+	if self {
+		if authz.Role(c, orgID) == "" {
+			problem.Respond(c, http.StatusNotFound, "Organization not found")
+			return
+		}
+	} else if !authz.Check(c, authz.ManageMembers, authz.Org(orgID), "Organization not found") || !canManageMember(c, orgID, userID) {
+		return
+	}
+	if !keepsAnOwner(c, orgID, userID) {
+		return
+	}
+
+	before, err := database.GetOrgMemberRole(orgID, userID)
+	if !orgMemberOK(c, err) {
+		return
+	}
+	if !orgMemberOK(c, database.RemoveOrgMember(orgID, userID)) {
+		return
+	}
+	audit.Diff(c, gin.H{"member_id": userID, "role": before}, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+func respondWithMembers(c *gin.Context, status, orgID int) {
+	members, err := database.ListOrgMembers(orgID)
+	if !orgOK(c, err) {
+		return
+	}
+	c.JSON(status, gin.H{"members": members})
+}
+
+func memberUserID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid user id")
+		return 0, false
+	}
+	return id, true
+}
+
+// canAssignRole checks role is valid and not above what the caller may grant:
+// owners grant anything, admins only analyst and viewer
+func canAssignRole(c *gin.Context, orgID int, role string) bool {
+	if !authz.ValidRole(role) {
+		problem.Respond(c, http.StatusBadRequest, "role must be owner, admin, analyst or viewer")
+		return false
+	}
+	if caller := authz.Role(c, orgID); caller != authz.RoleOwner && !authz.Outranks(caller, role) {
+		problem.Respond(c, http.StatusForbidden, "You can't grant the "+role+" role")
+		return false
+	}
+	return true
+}
+
+// canManageMember stops admins from changing or removing their peers and owners
+func canManageMember(c *gin.Context, orgID, userID int) bool {
+	target, err := database.GetOrgMemberRole(orgID, userID)
+	if !orgMemberOK(c, err) {
+		return false
+	}
+	if caller := authz.Role(c, orgID); caller != authz.RoleOwner && !authz.Outranks(caller, target) {
+		problem.Respond(c, http.StatusForbidden, "You can't manage a member with the "+target+" role")
+		return false
+	}
+	return true
+}
+
+// keepsAnOwner stops the last owner from being demoted or removed
+func keepsAnOwner(c *gin.Context, orgID, userID int) bool {
+	role, err := database.GetOrgMemberRole(orgID, userID)
+	if !orgMemberOK(c, err) {
+		return false
+	}
+	if role != authz.RoleOwner {
+		return true
+	}
+	owners, err := database.CountOrgMembersWithRole(orgID, authz.RoleOwner)
+	if !orgOK(c, err) {
+		return false
+	}
+	if owners <= 1 {
+		problem.Respond(c, http.StatusBadRequest, "An organization needs at least one owner")
+		return false
+	}
+	return true
+}
+
+// orgOK turns a database error into a response; true means no error
+func orgOK(c *gin.Context, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "Organization not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error handling organization: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to process organization")
+		return false
+	}
+	return true
+}
+
+// orgMemberOK is orgOK for membership lookups
+func orgMemberOK(c *gin.Context, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "Member not found")
+		return false
+	}
+	return orgOK(c, err)
+}
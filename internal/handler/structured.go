@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/guardrails"
+	"github.com/chuma-beep/stock-saas/internal/services"
+)
+
+// maxAnalysisAttempts bounds how often we ask the model to fix malformed JSON
+const maxAnalysisAttempts = 3
+
+// StructuredAnalysis is the JSON shape the model is asked to produce
+type StructuredAnalysis struct {
+	Winner        string   `json:"winner"`
+	Drivers       []string `json:"drivers"`
+	Risks         []string `json:"risks"`
+	Opportunities []string `json:"opportunities"`
+	Takeaway      string   `json:"takeaway"`
+	Confidence    string   `json:"confidence"`
+}
+
+// analysisSchema is included in the prompt so the model knows the contract
+const analysisSchema = `{
+  "winner": "<ticker that performed better>",
+  "drivers": ["<key driver tied to the stats>", "..."],
+  "risks": ["<risk>", "..."],
+  "opportunities": ["<opportunity>", "..."],
+  "takeaway": "<one fun sentence>",
+  "confidence": "low" | "medium" | "high"
+}`
+
+// Validate checks the analysis against the schema and the compared tickers.
+// winner is the ticker with the higher return, or "" on a tie, in which case
+// either ticker will do.
+func (a *StructuredAnalysis) Validate(winner string, tickers ...string) []string {
+	var problems []string
+
+	validWinner := false
+	for _, t := range tickers {
+		if strings.EqualFold(a.Winner, t) {
+			validWinner = true
+		}
+	}
+	switch {
+	case !validWinner:
+		problems = append(problems, fmt.Sprintf("winner must be one of %s", strings.Join(tickers, ", ")))
+	case winner != "" && !strings.EqualFold(a.Winner, winner):
+		problems = append(problems, fmt.Sprintf("winner must be %s, which had the higher return", winner))
+	}
+	if len(nonEmpty(a.Drivers)) == 0 {
+		problems = append(problems, "drivers must contain at least one item")
+	}
+	if len(nonEmpty(a.Risks)) == 0 {
+		problems = append(problems, "risks must contain at least one item")
+	}
+	if len(nonEmpty(a.Opportunities)) == 0 {
+		problems = append(problems, "opportunities must contain at least one item")
+	}
+	if strings.TrimSpace(a.Takeaway) == "" {
+		problems = append(problems, "takeaway is required")
+	}
+	switch a.Confidence {
+	case "low", "medium", "high":
+	default:
+		problems = append(problems, `confidence must be "low", "medium" or "high"`)
+	}
+	return problems
+}
+
+// Markdown renders the analysis for clients that can't use the structure
+func (a *StructuredAnalysis) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**🏆 Winner: %s**\n\n", a.Winner)
+	writeSection(&b, "📈 Key drivers", a.Drivers)
+	writeSection(&b, "⚠️ Risks", a.Risks)
+	writeSection(&b, "💡 Opportunities", a.Opportunities)
+	fmt.Fprintf(&b, "**🎯 Takeaway:** %s\n\n", a.Takeaway)
+	fmt.Fprintf(&b, "_Confidence: %s_", a.Confidence)
+	return b.String()
+}
+
+// applyGuardrails rewrites advice and price targets in every field and flags
+// figures that don't match the computed stats
+func (a *StructuredAnalysis) applyGuardrails(allowed guardrails.Facts) []guardrails.Violation {
+	var violations, v []guardrails.Violation
+	a.Drivers, v = guardrails.CheckAll(a.Drivers, allowed)
+	violations = append(violations, v...)
+	a.Risks, v = guardrails.CheckAll(a.Risks, allowed)
+	violations = append(violations, v...)
+	a.Opportunities, v = guardrails.CheckAll(a.Opportunities, allowed)
+	violations = append(violations, v...)
+	a.Takeaway, v = guardrails.Check(a.Takeaway, allowed)
+	violations = append(violations, v...)
+	return violations
+}
+
+func writeSection(b *strings.Builder, title string, items []string) {
+	fmt.Fprintf(b, "**%s**\n", title)
+	for _, item := range nonEmpty(items) {
+		fmt.Fprintf(b, "- %s\n", item)
+	}
+	b.WriteString("\n")
+}
+
+func nonEmpty(items []string) []string {
+	var out []string
+	for _, item := range items {
+		if strings.TrimSpace(item) != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseStructuredAnalysis decodes model output, tolerating code fences
+func parseStructuredAnalysis(content, winner string, tickers ...string) (*StructuredAnalysis, []string) {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	var a StructuredAnalysis
+	if err := json.Unmarshal([]byte(content), &a); err != nil {
+		return nil, []string{fmt.Sprintf("output is not valid JSON: %v", err)}
+	}
+	if problems := a.Validate(winner, tickers...); len(problems) > 0 {
+		return nil, problems
+	}
+	for _, t := range tickers {
+		if strings.EqualFold(a.Winner, t) {
+			a.Winner = t
+		}
+	}
+	return &a, nil
+}
+
+// requestStructuredAnalysis asks for JSON output and feeds validation errors
+// back to the model until it complies or we run out of attempts. The last
+// raw output is returned alongside so callers can still show something.
+// winner is the computed winner, as for Validate.
+func requestStructuredAnalysis(client services.ChatClient, req services.GroqRequest, winner string, tickers ...string) (*StructuredAnalysis, string, error) {
+	req.ResponseFormat = &services.GroqResponseFormat{Type: "json_object"}
+
+	var raw string
+	for attempt := 1; attempt <= maxAnalysisAttempts; attempt++ {
+		resp, err := client.CreateChatCompletion(req)
+		if err != nil {
+			return nil, raw, err
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		raw = resp.Choices[0].Message.Content
+		analysis, problems := parseStructuredAnalysis(raw, winner, tickers...)
+		if analysis != nil {
+			return analysis, raw, nil
+		}
+
+		req.Messages = append(req.Messages,
+			services.GroqMessage{Role: "assistant", Content: raw},
+			services.GroqMessage{Role: "user", Content: "Your JSON did not match the schema:\n- " +
+				strings.Join(problems, "\n- ") + "\n\nReply again with only the corrected JSON object."},
+		)
+	}
+	return nil, raw, nil
+}
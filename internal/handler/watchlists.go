@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/authz"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+)
+
+const maxWatchlistSymbols = 50
+
+type watchlistItemRequest struct {
+	Symbol string `json:"symbol"`
+	Notes  string `json:"notes"`
+}
+
+func ListWatchlists(c *gin.Context) {
+	lists, err := database.ListWatchlists(auth.CurrentClaims(c).UserID())
+	if err != nil {
+		log.Printf("Error listing watchlists: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to fetch watchlists")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"watchlists": lists})
+}
+
+// CreateWatchlist creates a personal watchlist, or a shared one when org_id
+// names an organization where the user can write
+func CreateWatchlist(c *gin.Context) {
+	var req struct {
+		Name  string                 `json:"name"`
+		OrgID *int                   `json:"org_id"`
+		Items []watchlistItemRequest `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		problem.Respond(c, http.StatusBadRequest, "name is required")
+		return
+	}
+	if req.OrgID != nil && !authz.Check(c, authz.Write, authz.Org(*req.OrgID), "Organization not found") {
+		return
+	}
+	items, ok := normalizeWatchlistItems(c, req.Items)
+	if !ok {
+		return
+	}
+
+	w, err := database.CreateWatchlist(auth.CurrentClaims(c).UserID(), req.OrgID, strings.TrimSpace(req.Name), items)
+	if err != nil {
+		log.Printf("Error creating watchlist: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to create watchlist")
+		return
+	}
+
+	audit.SetResourceID(c, strconv.Itoa(w.ID))
+	respondWithWatchlist(c, http.StatusCreated, nil, w.ID)
+}
+
+func GetWatchlist(c *gin.Context) {
+	w, ok := loadWatchlist(c, authz.Read)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"watchlist": w})
+}
+
+func RenameWatchlist(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		problem.Respond(c, http.StatusBadRequest, "name is required")
+		return
+	}
+	w, ok := loadWatchlist(c, authz.Write)
+	if !ok {
+		return
+	}
+
+	if !watchlistWriteOK(c, database.RenameWatchlist(w.ID, strings.TrimSpace(req.Name))) {
+		return
+	}
+	respondWithWatchlist(c, http.StatusOK, w, w.ID)
+}
+
+func DeleteWatchlist(c *gin.Context) {
+	w, ok := loadWatchlist(c, authz.Delete)
+	if !ok {
+		return
+	}
+	if !watchlistWriteOK(c, database.DeleteWatchlist(w.ID)) {
+		return
+	}
+	audit.Diff(c, w, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Watchlist deleted"})
+}
+
+// ReplaceWatchlistItems sets the full list; array order becomes display order
+func ReplaceWatchlistItems(c *gin.Context) {
+	var req struct {
+		Items []watchlistItemRequest `json:"items"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	items, ok := normalizeWatchlistItems(c, req.Items)
+	if !ok {
+		return
+	}
+	w, ok := loadWatchlist(c, authz.Write)
+	if !ok {
+		return
+	}
+
+	if !watchlistWriteOK(c, database.ReplaceWatchlistItems(w.ID, items)) {
+		return
+	}
+	respondWithWatchlist(c, http.StatusOK, w, w.ID)
+}
+
+// AddWatchlistItem appends a symbol, or updates its notes if already present
+func AddWatchlistItem(c *gin.Context) {
+	var req watchlistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if c.Param("symbol") != "" {
+		req.Symbol = c.Param("symbol")
+	}
+	items, ok := normalizeWatchlistItems(c, []watchlistItemRequest{req})
+	if !ok {
+		return
+	}
+
+	w, ok := loadWatchlist(c, authz.Write)
+	if !ok {
+		return
+	}
+	// Only a new symbol can overflow the list; editing notes always works
+	onList := slices.ContainsFunc(w.Items, func(item database.WatchlistItem) bool { return item.Symbol == items[0].Symbol })
+	if !onList && len(w.Items) >= maxWatchlistSymbols {
+		problem.Respond(c, http.StatusBadRequest, "A watchlist can hold at most 50 symbols")
+		return
+	}
+
+	if !watchlistWriteOK(c, database.UpsertWatchlistItem(w.ID, items[0].Symbol, items[0].Notes)) {
+		return
+	}
+	respondWithWatchlist(c, http.StatusOK, w, w.ID)
+}
+
+func DeleteWatchlistItem(c *gin.Context) {
+	w, ok := loadWatchlist(c, authz.Write)
+	if !ok {
+		return
+	}
+	// Symbols saved before tickers were normalized may not parse; match them as sent
+	symbol, err := validate.NormalizeTicker(c.Param("symbol"))
+	if err != nil {
+		symbol = strings.ToUpper(c.Param("symbol"))
+	}
+	if !watchlistWriteOK(c, database.DeleteWatchlistItem(w.ID, symbol)) {
+		return
+	}
+	respondWithWatchlist(c, http.StatusOK, w, w.ID)
+}
+
+// respondWithWatchlist returns the watchlist as stored now, recording the
+// change from before (nil for a new watchlist) in the audit log
+func respondWithWatchlist(c *gin.Context, status int, before *database.Watchlist, id int) {
+	w, err := database.GetWatchlist(id)
+	if !watchlistWriteOK(c, err) {
+		return
+	}
+	audit.Diff(c, before, w)
+	c.JSON(status, gin.H{"watchlist": w})
+}
+
+// loadWatchlist reads the :id watchlist and checks the principal may
+// perform action on it
+func loadWatchlist(c *gin.Context, action authz.Action) (*database.Watchlist, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid watchlist id")
+		return nil, false
+	}
+	w, err := database.GetWatchlist(id)
+	if !watchlistWriteOK(c, err) {
+		return nil, false
+	}
+	if !authz.Check(c, action, authz.Resource{OwnerID: w.UserID, OrgID: orgIDOf(w.OrgID)}, "Watchlist not found") {
+		return nil, false
+	}
+	return w, true
+}
+
+// orgIDOf turns a nullable org_id column into an authz org ID
+func orgIDOf(orgID *int) int {
+	if orgID == nil {
+		return 0
+	}
+	return *orgID
+}
+
+// watchlistWriteOK turns a database error into a response; true means no error
+func watchlistWriteOK(c *gin.Context, err error) bool {
+	if errors.Is(err, database.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "Watchlist not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error updating watchlist: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to update watchlist")
+		return false
+	}
+	return true
+}
+
+func normalizeWatchlistItems(c *gin.Context, req []watchlistItemRequest) ([]database.WatchlistItem, bool) {
+	if len(req) > maxWatchlistSymbols {
+		problem.Respond(c, http.StatusBadRequest, "A watchlist can hold at most 50 symbols")
+		return nil, false
+	}
+
+	errs := validate.Errors{}
+	seen := make(map[string]bool, len(req))
+	items := make([]database.WatchlistItem, 0, len(req))
+	for i, r := range req {
+		symbol := errs.Ticker(fmt.Sprintf("items[%d].symbol", i), r.Symbol)
+		if symbol == "" || seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		items = append(items, database.WatchlistItem{Symbol: symbol, Notes: strings.TrimSpace(r.Notes)})
+	}
+	return items, validate.OK(c, errs)
+}
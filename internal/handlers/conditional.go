@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// settledAfter is how long after a range ends its bars are treated as
+	// final; providers still revise the last few days
+	settledAfter = 7 * 24 * time.Hour
+	// settledMaxAge and recentMaxAge are how long clients and CDNs may
+	// reuse a response before revalidating
+	settledMaxAge = 24 * time.Hour
+	recentMaxAge  = 5 * time.Minute
+)
+
+// validators are the caching headers of a response built from bars. They
+// are only sent with a 200 or 304, so an error is never cached or
+// revalidated as if it were the data.
+type validators struct {
+	etag         string
+	lastModified time.Time
+	cacheControl string
+	// version is database.FormatRangeVersion of what the ETag was built from
+	version string
+}
+
+// rangeVersion is the version to read the bars at, "" without validators
+func (v *validators) rangeVersion() string {
+	if v == nil {
+		return ""
+	}
+	return v.version
+}
+
+// set writes v's headers; a nil v sets nothing
+func (v *validators) set(c *gin.Context) {
+	if v == nil {
+		return
+	}
+	h := c.Writer.Header()
+	h.Set("ETag", v.etag)
+	h.Set("Last-Modified", v.lastModified.Format(http.TimeFormat))
+	h.Set("Cache-Control", v.cacheControl)
+	h.Add("Vary", "Authorization, X-API-Key")
+}
+
+// notModified computes the validators of a response built from the bars of
+// tickers over r and answers 304 when the client's copy is still current.
+// It reports whether the response has been sent; if not, the handler sets
+// the returned validators once it knows it will answer 200. When there are
+// no bars, or their version can't be read, the validators are nil.
+//
+// Last-Modified is the newest bar's updated_at rather than its created_at:
+// the save upsert bumps updated_at when a provider revises a bar, which
+// created_at, set once on insert, would miss.
+func notModified(c *gin.Context, tickers []string, r validate.Range) (*validators, bool) {
+	count, modified, err := database.RangeVersion(tickers, r.StartDate(), r.EndDate())
+	if err != nil {
+		log.Printf("Error reading version of %s: %v", strings.Join(tickers, ","), err)
+		return nil, false
+	}
+	if count == 0 {
+		return nil, false
+	}
+	modified = modified.UTC().Truncate(time.Second)
+
+	// The query is part of the tag because format and the other options
+	// change the body, not just the bars
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s?%s|%d|%d",
+		c.Request.URL.Path, c.Request.URL.Query().Encode(), count, modified.Unix()))
+	v := &validators{
+		etag:         `W/"` + hex.EncodeToString(sum[:16]) + `"`,
+		lastModified: modified,
+		cacheControl: cacheControl(c, r),
+		version:      database.FormatRangeVersion(count, modified),
+	}
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if !etagMatches(match, v.etag) {
+			return v, false
+		}
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err != nil || modified.After(since) {
+		return v, false
+	}
+	v.set(c)
+	c.Status(http.StatusNotModified)
+	return v, true
+}
+
+// cacheControl lets shared caches keep anonymous responses only; plans
+// decide what a signed-in caller may read
+func cacheControl(c *gin.Context, r validate.Range) string {
+	maxAge := recentMaxAge
+	if time.Since(r.End) > settledAfter {
+		maxAge = settledMaxAge
+	}
+	scope := "public"
+	if auth.CurrentClaims(c) != nil {
+		scope = "private"
+	}
+	return fmt.Sprintf("%s, max-age=%d", scope, int(maxAge.Seconds()))
+}
+
+// etagMatches applies If-None-Match's weak comparison: W/ prefixes are
+// ignored and * matches anything
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
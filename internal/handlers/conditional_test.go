@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chuma-beep/stock-saas/internal/cache"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `W/"abc"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`*`, true},
+		{`"x", W/"abc"`, true},
+		{`"x" , "abc" `, true},
+		{`"abcd"`, false},
+		{`"x", "y"`, false},
+		{`abc`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := etagMatches(tt.header, etag); got != tt.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+// mockDB points database.DB at a sqlmock and turns caching off for the test
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevCache := database.DB, cache.Default
+	database.DB, cache.Default = db, cache.NewLRU(0)
+	t.Cleanup(func() {
+		database.DB, cache.Default = prevDB, prevCache
+		db.Close()
+	})
+	return mock
+}
+
+func versionRows(count int, modified time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"count", "modified"}).AddRow(count, modified)
+}
+
+func TestNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	r := validate.Range{Start: end.AddDate(0, 0, -30), End: end}
+
+	// The tag of /stock?ticker=AAPL at modified, read from a first request
+	mock := mockDB(t)
+	mock.ExpectQuery("count").WillReturnRows(versionRows(5, modified))
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/stock?ticker=AAPL", nil)
+	v, _ := notModified(c, []string{"AAPL"}, r)
+	if v == nil {
+		t.Fatal("notModified returned no validators")
+	}
+	etag := v.etag
+
+	tests := []struct {
+		name     string
+		count    int
+		headers  map[string]string
+		wantSent bool
+		wantNil  bool
+	}{
+		{"no conditional headers", 5, nil, false, false},
+		{"matching etag", 5, map[string]string{"If-None-Match": etag}, true, false},
+		{"stale etag", 5, map[string]string{"If-None-Match": `W/"old"`}, false, false},
+		{"etag wins over date", 5, map[string]string{
+			"If-None-Match":     `W/"old"`,
+			"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat),
+		}, false, false},
+		{"not modified since", 5, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true, false},
+		{"modified since", 5, map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false, false},
+		{"bad date", 5, map[string]string{"If-Modified-Since": "yesterday"}, false, false},
+		{"no bars", 0, map[string]string{"If-None-Match": "*"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectQuery("count").WillReturnRows(versionRows(tt.count, modified))
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/stock?ticker=AAPL", nil)
+			for k, val := range tt.headers {
+				c.Request.Header.Set(k, val)
+			}
+
+			v, sent := notModified(c, []string{"AAPL"}, r)
+			if sent != tt.wantSent {
+				t.Errorf("sent = %v, want %v", sent, tt.wantSent)
+			}
+			if (v == nil) != tt.wantNil {
+				t.Errorf("validators = %v, want nil %v", v, tt.wantNil)
+			}
+			if sent {
+				c.Writer.WriteHeaderNow()
+				if w.Code != http.StatusNotModified || w.Header().Get("ETag") != etag {
+					t.Errorf("got %d with ETag %q, want 304 with %q", w.Code, w.Header().Get("ETag"), etag)
+				}
+			} else if w.Header().Get("ETag") != "" || w.Header().Get("Cache-Control") != "" {
+				t.Errorf("headers set before the handler answered: %v", w.Header())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCompareStocksErrorsAreNotCacheable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	end := time.Now().UTC().Format("2006-01-02")
+	start := time.Now().UTC().AddDate(0, 0, -30).Format("2006-01-02")
+	url := "/compare?ticker1=AAPL&ticker2=MSFT&start=" + start + "&end=" + end
+
+	tests := []struct {
+		name   string
+		expect func(sqlmock.Sqlmock)
+		want   int
+	}{
+		{"load fails", func(m sqlmock.Sqlmock) {
+			m.ExpectQuery("FROM stocks").WillReturnError(errors.New("connection reset"))
+		}, http.StatusInternalServerError},
+		{"one ticker missing", func(m sqlmock.Sqlmock) {
+			bars := sqlmock.NewRows([]string{"ticker", "date", "open", "high", "low", "close", "volume"}).
+				AddRow("AAPL", time.Now(), 1.0, 2.0, 0.5, 1.5, 100)
+			m.ExpectQuery("FROM stocks").WillReturnRows(bars)
+			m.ExpectQuery("FROM stocks").WillReturnRows(sqlmock.NewRows([]string{"ticker", "date", "open", "high", "low", "close", "volume"}))
+		}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectQuery("count").WillReturnRows(versionRows(3, time.Now()))
+			tt.expect(mock)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, url, nil)
+			CompareStocks(c)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			for _, h := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+				if v := w.Header().Get(h); v != "" {
+					t.Errorf("%s = %q on a %d", h, v, w.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestGetStockReadsAtTheETagVersion saves made by another process don't
+// reach this process's cache, but they change the version the ETag is
+// built from; the body must follow the ETag, not the cache.
+func TestGetStockReadsAtTheETagVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := mockDB(t)
+	cache.Default = cache.NewLRU(100)
+	end := time.Now().UTC()
+	url := "/stock?ticker=AAPL&start=" + end.AddDate(0, 0, -30).Format("2006-01-02") + "&end=" + end.Format("2006-01-02")
+	bars := func(n int) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"ticker", "date", "open", "high", "low", "close", "volume"})
+		for i := range n {
+			rows.AddRow("AAPL", end.AddDate(0, 0, i-n), 1.0, 2.0, 0.5, 1.5, 100)
+		}
+		return rows
+	}
+	saved := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		count    int
+		modified time.Time
+		loads    bool
+	}{
+		{"first read", 2, saved, true},
+		{"same version is cached", 2, saved, false},
+		{"saved elsewhere", 3, saved.Add(time.Minute), true},
+	}
+	for _, tt := range tests {
+		mock.ExpectQuery("count").WillReturnRows(versionRows(tt.count, tt.modified))
+		if tt.loads {
+			mock.ExpectQuery("FROM stocks").WillReturnRows(bars(tt.count))
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, url, nil)
+		GetStock(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", tt.name, w.Code, w.Body)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/export"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+)
+
+var barColumns = []export.Column{
+	{Name: "ticker", Kind: export.String},
+	{Name: "date", Kind: export.Date},
+	{Name: "open", Kind: export.Float},
+	{Name: "high", Kind: export.Float},
+	{Name: "low", Kind: export.Float},
+	{Name: "close", Kind: export.Float},
+	{Name: "volume", Kind: export.Int},
+}
+
+// exportFormat reads ?format=; empty means the regular JSON response
+func exportFormat(c *gin.Context, errs validate.Errors) string {
+	format := strings.ToLower(strings.TrimSpace(c.Query("format")))
+	if format != "" && !export.Valid(format) {
+		errs.Add("format", "must be one of "+strings.Join(export.Formats, ", "))
+	}
+	return format
+}
+
+// exportBars streams the bars of tickers over r as a download, one row per
+// ticker and day, with v's caching headers
+func exportBars(c *gin.Context, format string, tickers []string, r validate.Range, v *validators) {
+	for _, ticker := range tickers {
+		ok, err := database.HasStockData(ticker, r.StartDate(), r.EndDate())
+		if err != nil {
+			log.Printf("Error checking data for %s: %v", ticker, err)
+			problem.Respond(c, http.StatusInternalServerError, "Failed to load stock data")
+			return
+		}
+		if !ok {
+			problem.Respond(c, http.StatusNotFound, "No data found for "+ticker+". Try fetching it first using /fetch/:ticker")
+			return
+		}
+	}
+
+	v.set(c)
+	filename := strings.Join(tickers, "_") + "_" + r.StartDate() + "_" + r.EndDate()
+	resp := export.NewResponse(c, format, filename, "bars", barColumns)
+	err := database.StreamBars(tickers, r.StartDate(), r.EndDate(), func(b database.StockBar) error {
+		return resp.Write([]interface{}{b.Ticker, b.Date, b.Open, b.High, b.Low, b.Close, b.Volume})
+	})
+	finishExport(c, resp, err)
+}
+
+// finishExport closes a download, or reports err as a problem if nothing
+// has been sent yet
+func finishExport(c *gin.Context, resp *export.Response, err error) {
+	if err == nil {
+		err = resp.Close()
+	}
+	if err == nil {
+		return
+	}
+	log.Printf("Error exporting %s: %v", c.Request.URL.Path, err)
+	if !resp.Started() {
+		problem.Respond(c, http.StatusInternalServerError, "Failed to export data")
+	}
+}
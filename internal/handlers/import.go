@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/audit"
+	"github.com/chuma-beep/stock-saas/internal/importer"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportBytes caps one upload; split bigger vendor files or use the CLI
+const maxImportBytes = 64 << 20
+
+// ImportStock loads an OHLCV CSV sent as the request body or as the "file"
+// field of a multipart form. Options come from the query: columns
+// (date=Trade Date,close=Adj Close), date_format (Go layouts, repeatable),
+// ticker (for files without a ticker column), delimiter and dry_run.
+func ImportStock(c *gin.Context) {
+	errs := validate.Errors{}
+	opts := importer.Options{DateFormats: c.QueryArray("date_format"), DryRun: c.Query("dry_run") == "true"}
+
+	columns, err := importer.ParseColumns(c.Query("columns"))
+	if err != nil {
+		errs.Add("columns", err.Error())
+	}
+	opts.Columns = columns
+	if v := c.Query("ticker"); v != "" {
+		opts.Ticker = errs.Ticker("ticker", v)
+	}
+	if opts.Comma, err = importer.ParseDelimiter(c.Query("delimiter")); err != nil {
+		errs.Add("delimiter", err.Error())
+	}
+	if !validate.OK(c, errs) {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	body, ok := importBody(c)
+	if !ok {
+		return
+	}
+
+	res, err := importer.Import(body, opts)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		problem.Respond(c, http.StatusRequestEntityTooLarge, "Upload is over 64 MB; split the file or use go run ./cmd/importcsv")
+		return
+	case errors.Is(err, importer.ErrBadHeader):
+		problem.Write(c, problem.New(http.StatusBadRequest, err.Error()).WithCode(problem.CodeValidationFailed))
+		return
+	case err != nil && res == nil:
+		problem.Respond(c, http.StatusBadRequest, "Could not read the CSV file")
+		return
+	case err != nil:
+		log.Printf("Error importing bars: %v", err)
+		problem.Write(c, problem.New(http.StatusInternalServerError, "Import stopped: failed to save rows. Earlier batches were saved; re-running is safe").
+			WithDetail("rows_read", res.Rows).WithDetail("rows_imported", res.Imported))
+		return
+	}
+
+	if !opts.DryRun && res.Imported > 0 {
+		audit.Diff(c, nil, gin.H{"rows": res.Imported, "tickers": res.Tickers})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// importBody finds the CSV: the "file" part of a multipart form, read as a
+// stream rather than buffered, or else the raw body
+func importBody(c *gin.Context) (io.Reader, bool) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return c.Request.Body, true
+	}
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "Invalid multipart form")
+		return nil, false
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, `Multipart form needs a "file" field`)
+			return nil, false
+		}
+		if part.FormName() == "file" {
+			return part, true
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/analytics"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/export"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultIndicatorPeriod = 14
+	maxIndicatorPeriod     = 200
+)
+
+var indicatorColumns = []export.Column{
+	{Name: "ticker", Kind: export.String},
+	{Name: "date", Kind: export.Date},
+	{Name: "close", Kind: export.Float},
+	{Name: "value", Kind: export.Float},
+}
+
+type indicatorPoint struct {
+	Date  string  `json:"date"`
+	Close float64 `json:"close"`
+	Value float64 `json:"value"`
+}
+
+// GetIndicator computes sma, ema or rsi over stored closes. Dates before the
+// indicator has enough history are left out. With ?format= the series is
+// streamed as a download.
+func GetIndicator(c *gin.Context) {
+	errs := validate.Errors{}
+	ticker := errs.Ticker("ticker", c.Query("ticker"))
+	r := errs.DateRange("start", "end", c.Query("start"), c.Query("end"))
+	format := exportFormat(c, errs)
+
+	indicator := strings.ToLower(c.Param("indicator"))
+	if !slices.Contains(analytics.StreamIndicators, indicator) {
+		errs.Add("indicator", "must be one of "+strings.Join(analytics.StreamIndicators, ", "))
+	}
+	period := defaultIndicatorPeriod
+	if v := c.Query("period"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxIndicatorPeriod {
+			errs.Add("period", "must be between 1 and 200")
+		}
+		period = n
+	}
+	if !validate.OK(c, errs) {
+		return
+	}
+	stream, _ := analytics.NewStream(indicator, period)
+
+	if format != "" {
+		filename := ticker + "_" + indicator + strconv.Itoa(period) + "_" + r.StartDate() + "_" + r.EndDate()
+		resp := export.NewResponse(c, format, filename, indicator, indicatorColumns)
+		err := database.StreamBars([]string{ticker}, r.StartDate(), r.EndDate(), func(b database.StockBar) error {
+			if v := stream.Next(b.Close); !math.IsNaN(v) {
+				return resp.Write([]interface{}{b.Ticker, b.Date, b.Close, v})
+			}
+			return nil
+		})
+		if err == nil && !resp.Started() {
+			problem.Respond(c, http.StatusNotFound, "Not enough data for "+indicator+". Try fetching it first using /fetch/:ticker")
+			return
+		}
+		finishExport(c, resp, err)
+		return
+	}
+
+	points := []indicatorPoint{}
+	err := database.StreamBars([]string{ticker}, r.StartDate(), r.EndDate(), func(b database.StockBar) error {
+		if v := stream.Next(b.Close); !math.IsNaN(v) {
+			points = append(points, indicatorPoint{Date: b.Date.Format(validate.DateFormat), Close: b.Close, Value: v})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error computing %s for %s: %v", indicator, ticker, err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load stock data")
+		return
+	}
+	if len(points) == 0 {
+		problem.Respond(c, http.StatusNotFound, "Not enough data for "+indicator+". Try fetching it first using /fetch/:ticker")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticker":     ticker,
+		"indicator":  indicator,
+		"period":     period,
+		"start_date": r.StartDate(),
+		"end_date":   r.EndDate(),
+		"values":     points,
+	})
+}
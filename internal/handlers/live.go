@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/auth"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/live"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// liveWriteWait is how long a client may take to accept one message
+	// before it is dropped
+	liveWriteWait = 10 * time.Second
+	// liveHeartbeat keeps idle connections open through proxies
+	liveHeartbeat = 30 * time.Second
+	// liveMaxMessage caps a client message
+	liveMaxMessage = 4 << 10
+)
+
+// liveRequest is a client message: subscribe or unsubscribe to tickers or
+// to a watchlist's symbols, or ping
+type liveRequest struct {
+	Action    string   `json:"action"`
+	Tickers   []string `json:"tickers"`
+	Watchlist int      `json:"watchlist"`
+}
+
+type livePrice struct {
+	Type string `json:"type"`
+	live.Quote
+}
+
+type liveError struct {
+	Type    string                 `json:"type"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// LivePrices upgrades to a WebSocket that pushes a "price" message whenever
+// a followed ticker gets a new stored bar or a provider tick. ?tickers=
+// subscribes on connect; after that the client sends subscribe,
+// unsubscribe and ping messages.
+func LivePrices(c *gin.Context) {
+	if !c.IsWebsocket() {
+		problem.Respond(c, http.StatusBadRequest, "Connect with a WebSocket client")
+		return
+	}
+	// Browsers send Origin on every handshake, and cross-site pages can open
+	// sockets, so only the origins CORS allows may connect. Other clients
+	// send none.
+	if origin := c.GetHeader("Origin"); origin != "" && !auth.OriginAllowed(origin) {
+		problem.Respond(c, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+	errs := validate.Errors{}
+	var tickers []string
+	if v := c.Query("tickers"); v != "" {
+		tickers = errs.Tickers("tickers", strings.Split(v, ","))
+		if len(tickers) > live.MaxSubscriptions {
+			errs.Add("tickers", "at most 50 tickers can be followed")
+		}
+	}
+	if !validate.OK(c, errs) {
+		return
+	}
+
+	claims := auth.CurrentClaims(c)
+	owner := "ip:" + c.ClientIP()
+	if claims != nil {
+		owner = "user:" + claims.Subject
+	}
+	client, err := live.Default.Connect(owner)
+	if errors.Is(err, live.ErrTooManyForOwner) {
+		problem.Write(c, problem.New(http.StatusTooManyRequests, "Too many live connections open, close one first").
+			WithRetryAfter(30*time.Second))
+		return
+	}
+	if err != nil {
+		problem.Write(c, problem.New(http.StatusServiceUnavailable, "Too many live connections, try again shortly").
+			WithCode(problem.CodeUnavailable).
+			WithRetryAfter(30*time.Second))
+		return
+	}
+	defer live.Default.Disconnect(client)
+
+	conn := &liveConn{hub: live.Default, client: client, claims: claims}
+	server := websocket.Server{
+		// Origin was checked above
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   func(ws *websocket.Conn) { conn.serve(ws, tickers) },
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// liveConn is one open WebSocket. Client messages are handled on the
+// connection's goroutine; quotes are written by pump.
+type liveConn struct {
+	hub    *live.Hub
+	client *live.Client
+	claims *auth.Claims
+
+	ws *websocket.Conn
+	mu sync.Mutex // serializes writes
+}
+
+func (lc *liveConn) serve(ws *websocket.Conn, tickers []string) {
+	lc.ws = ws
+	ws.MaxPayloadBytes = liveMaxMessage
+
+	done := make(chan struct{})
+	defer close(done)
+	go lc.pump(done)
+
+	if len(tickers) > 0 {
+		lc.subscribe(tickers)
+	}
+	for {
+		var data []byte
+		err := websocket.Message.Receive(ws, &data)
+		if errors.Is(err, websocket.ErrFrameTooLarge) {
+			lc.sendError(problem.New(http.StatusRequestEntityTooLarge, "Messages are limited to 4 KB"))
+			continue
+		}
+		if err != nil {
+			return
+		}
+		lc.handle(data)
+	}
+}
+
+// pump writes waiting quotes and heartbeats. A client that can't take a
+// message within liveWriteWait is disconnected; until then the hub keeps
+// only its latest quote per ticker, so nothing piles up.
+func (lc *liveConn) pump(done <-chan struct{}) {
+	heartbeat := time.NewTicker(liveHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case <-lc.client.Ready():
+			for _, q := range lc.client.Take() {
+				if err = lc.send(livePrice{Type: "price", Quote: q}); err != nil {
+					break
+				}
+			}
+		case t := <-heartbeat.C:
+			err = lc.send(gin.H{"type": "heartbeat", "time": t.UTC(), "skipped": lc.client.Skipped()})
+		}
+		if err != nil {
+			log.Printf("Closing live connection: %v", err)
+			lc.ws.Close()
+			return
+		}
+	}
+}
+
+func (lc *liveConn) handle(data []byte) {
+	var req liveRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		lc.sendError(problem.New(http.StatusBadRequest, `Messages must be JSON, e.g. {"action":"subscribe","tickers":["AAPL"]}`))
+		return
+	}
+
+	switch req.Action {
+	case "ping":
+		lc.send(gin.H{"type": "pong"})
+	case "subscribe":
+		if tickers, ok := lc.tickers(req); ok {
+			lc.subscribe(tickers)
+		}
+	case "unsubscribe":
+		if tickers, ok := lc.tickers(req); ok {
+			lc.hub.Unsubscribe(lc.client, tickers)
+			lc.sendSubscriptions()
+		}
+	default:
+		errs := validate.Errors{}
+		errs.Add("action", "must be subscribe, unsubscribe or ping")
+		lc.sendError(errs.Problem())
+	}
+}
+
+// tickers reads a message's tickers, or its watchlist's for a logged-in user
+func (lc *liveConn) tickers(req liveRequest) ([]string, bool) {
+	if req.Watchlist != 0 {
+		if lc.claims == nil {
+			lc.sendError(problem.New(http.StatusUnauthorized, "Log in to use a watchlist"))
+			return nil, false
+		}
+		symbols, err := database.GetWatchlistSymbols(lc.claims.UserID(), req.Watchlist)
+		if errors.Is(err, database.ErrNotFound) {
+			lc.sendError(problem.New(http.StatusNotFound, "Watchlist not found"))
+			return nil, false
+		}
+		if err != nil {
+			log.Printf("Error loading watchlist %d: %v", req.Watchlist, err)
+			lc.sendError(problem.New(http.StatusInternalServerError, "Failed to load watchlist"))
+			return nil, false
+		}
+		return symbols, true
+	}
+
+	errs := validate.Errors{}
+	tickers := errs.Tickers("tickers", req.Tickers)
+	if len(req.Tickers) == 0 {
+		errs.Add("tickers", "list at least one ticker, or a watchlist")
+	}
+	if len(errs) > 0 {
+		lc.sendError(errs.Problem())
+		return nil, false
+	}
+	return tickers, true
+}
+
+func (lc *liveConn) subscribe(tickers []string) {
+	if _, err := lc.hub.Subscribe(lc.client, tickers); errors.Is(err, live.ErrTooManyTickers) {
+		errs := validate.Errors{}
+		errs.Add("tickers", "at most 50 tickers can be followed")
+		lc.sendError(errs.Problem())
+		return
+	}
+	lc.sendSubscriptions()
+}
+
+func (lc *liveConn) sendSubscriptions() {
+	lc.send(gin.H{"type": "subscribed", "tickers": lc.hub.Subscriptions(lc.client)})
+}
+
+func (lc *liveConn) sendError(e *problem.Error) {
+	lc.send(liveError{Type: "error", Code: e.Code, Message: e.Message, Details: e.Details})
+}
+
+// send writes one message. Failures close the connection in pump, so
+// callers elsewhere can ignore them.
+func (lc *liveConn) send(v interface{}) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.ws.SetWriteDeadline(time.Now().Add(liveWriteWait))
+	return websocket.JSON.Send(lc.ws, v)
+}
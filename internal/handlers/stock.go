@@ -1,50 +1,61 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
-	"time"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/chuma-beep/stock-saas/internal/auth"
 	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
 	"github.com/chuma-beep/stock-saas/internal/services"
+	"github.com/chuma-beep/stock-saas/internal/validate"
 	"github.com/gin-gonic/gin"
 )
 
 func FetchAndStoreStock(c *gin.Context) {
-	ticker := c.Param("ticker")
-
-	if ticker == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ticker is required"})
+	errs := validate.Errors{}
+	ticker := errs.Ticker("ticker", c.Param("ticker"))
+	if !validate.OK(c, errs) {
 		return
 	}
 
 	log.Printf("Fetching data for %s...", ticker)
 
 	stockData, err := services.FetchStockData(ticker)
+	if errors.Is(err, services.ErrUnknownSymbol) {
+		problem.Respond(c, http.StatusNotFound, "Unknown ticker: "+ticker)
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Printf("Error fetching %s: %v", ticker, err)
+		problem.Write(c, problem.Upstream(err, "Market data provider unavailable, try again later"))
 		return
 	}
 
 	log.Printf("Storing %d records for %s...", len(stockData), ticker)
 
-	saved := 0
-	for _, data := range stockData {
-		err := database.SaveStock(
-			ticker,
-			data.Date,
-			data.Open,
-			data.High,
-			data.Low,
-			data.Close,
-			data.Volume,
-		)
-		if err != nil {
-			log.Printf("Error saving data: %v", err)
-			continue
+	bars := make([]database.StockBar, len(stockData))
+	for i, data := range stockData {
+		bars[i] = database.StockBar{
+			Ticker: ticker,
+			Date:   data.Date,
+			Open:   data.Open,
+			High:   data.High,
+			Low:    data.Low,
+			Close:  data.Close,
+			Volume: data.Volume,
 		}
-		saved++
 	}
+	if err := database.SaveStockBatch(bars); err != nil {
+		log.Printf("Error saving data: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to store stock data")
+		return
+	}
+	saved := len(bars)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Stock data fetched and stored",
@@ -54,27 +65,32 @@ func FetchAndStoreStock(c *gin.Context) {
 }
 
 func GetStock(c *gin.Context) {
-	ticker := c.Query("ticker")
-	startDate := c.Query("start")
-	endDate := c.Query("end")
-
-	if ticker == "" || startDate == "" || endDate == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "ticker, start, and end query parameters are required",
-		})
+	errs := validate.Errors{}
+	ticker := errs.Ticker("ticker", c.Query("ticker"))
+	r := errs.DateRange("start", "end", c.Query("start"), c.Query("end"))
+	format := exportFormat(c, errs)
+	if !validate.OK(c, errs) {
+		return
+	}
+	v, sent := notModified(c, []string{ticker}, r)
+	if sent {
+		return
+	}
+	if format != "" {
+		exportBars(c, format, []string{ticker}, r, v)
 		return
 	}
+	startDate, endDate := r.StartDate(), r.EndDate()
 
-	data, err := database.GetStockData(ticker, startDate, endDate)
+	data, err := database.GetStockDataAt(ticker, startDate, endDate, v.rangeVersion())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Printf("Error loading %s: %v", ticker, err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load stock data")
 		return
 	}
 
 	if len(data) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "No data found. Try fetching it first using /fetch/:ticker",
-		})
+		problem.Respond(c, http.StatusNotFound, "No data found. Try fetching it first using /fetch/:ticker")
 		return
 	}
 
@@ -83,6 +99,7 @@ func GetStock(c *gin.Context) {
 	lastClose := data[len(data)-1]["close"].(float64)
 	percentChange := ((lastClose - firstClose) / firstClose) * 100
 
+	v.set(c)
 	c.JSON(http.StatusOK, gin.H{
 		"ticker":         ticker,
 		"start_date":     startDate,
@@ -93,34 +110,40 @@ func GetStock(c *gin.Context) {
 }
 
 func CompareStocks(c *gin.Context) {
-	ticker1 := c.Query("ticker1")
-	ticker2 := c.Query("ticker2")
-	startDate := c.Query("start")
-	endDate := c.Query("end")
-
-	if ticker1 == "" || ticker2 == "" || startDate == "" || endDate == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "ticker1, ticker2, start, and end are required",
-		})
+	errs := validate.Errors{}
+	ticker1 := errs.Ticker("ticker1", c.Query("ticker1"))
+	ticker2 := errs.Ticker("ticker2", c.Query("ticker2"))
+	r := errs.DateRange("start", "end", c.Query("start"), c.Query("end"))
+	format := exportFormat(c, errs)
+	if !validate.OK(c, errs) {
 		return
 	}
+	v, sent := notModified(c, []string{ticker1, ticker2}, r)
+	if sent {
+		return
+	}
+	if format != "" {
+		exportBars(c, format, []string{ticker1, ticker2}, r, v)
+		return
+	}
+	startDate, endDate := r.StartDate(), r.EndDate()
 
-	data1, err := database.GetStockData(ticker1, startDate, endDate)
+	data1, err := database.GetStockDataAt(ticker1, startDate, endDate, v.rangeVersion())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Printf("Error loading %s: %v", ticker1, err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load stock data")
 		return
 	}
 
-	data2, err := database.GetStockData(ticker2, startDate, endDate)
+	data2, err := database.GetStockDataAt(ticker2, startDate, endDate, v.rangeVersion())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		log.Printf("Error loading %s: %v", ticker2, err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load stock data")
 		return
 	}
 
 	if len(data1) == 0 || len(data2) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Missing data. Fetch stocks first using /fetch/:ticker",
-		})
+		problem.Respond(c, http.StatusNotFound, "Missing data. Fetch stocks first using /fetch/:ticker")
 		return
 	}
 
@@ -131,6 +154,7 @@ func CompareStocks(c *gin.Context) {
 		return ((last - first) / first) * 100
 	}
 
+	v.set(c)
 	c.JSON(http.StatusOK, gin.H{
 		"comparison": []gin.H{
 			{
@@ -149,52 +173,74 @@ func CompareStocks(c *gin.Context) {
 	})
 }
 
-func GetCurrentPrices(c *gin.Context) {
-	tickers := []string{"AAPL", "MSFT", "GOOGL", "TSLA", "AMZN"}
+// maxPriceTickers caps how many symbols one /current-prices call may ask for
+const maxPriceTickers = 50
 
-	var results []map[string]interface{}
+// DefaultTickers shown to anonymous visitors, overridable with DEFAULT_TICKERS
+func DefaultTickers() []string {
+	if env := os.Getenv("DEFAULT_TICKERS"); env != "" {
+		return validate.Errors{}.Tickers("DEFAULT_TICKERS", strings.Split(env, ","))
+	}
+	return []string{"AAPL", "MSFT", "GOOGL", "TSLA", "AMZN"}
+}
 
-	for _, ticker := range tickers {
-		// Get the most recent price from database
-		query := `
-            SELECT ticker, close, date
-            FROM stocks
-            WHERE ticker = $1
-            ORDER BY date DESC
-            LIMIT 1
-        `
-
-		var t string
-		var close float64
-		var date time.Time
-
-		err := database.DB.QueryRow(query, ticker).Scan(&t, &close, &date)
+// GetCurrentPrices returns the latest stored price for ?watchlist=<id> (the
+// caller's own), ?tickers=AAPL,MSFT, or the default list
+func GetCurrentPrices(c *gin.Context) {
+	var tickers []string
+	switch {
+	case c.Query("watchlist") != "":
+		claims := auth.CurrentClaims(c)
+		if claims == nil {
+			problem.Respond(c, http.StatusUnauthorized, "Log in to use a watchlist")
+			return
+		}
+		id, err := strconv.Atoi(c.Query("watchlist"))
 		if err != nil {
-			log.Printf("Error getting price for %s: %v", ticker, err)
-			continue
+			problem.Respond(c, http.StatusBadRequest, "Invalid watchlist id")
+			return
+		}
+		tickers, err = database.GetWatchlistSymbols(claims.UserID(), id)
+		if errors.Is(err, database.ErrNotFound) {
+			problem.Respond(c, http.StatusNotFound, "Watchlist not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error loading watchlist %d: %v", id, err)
+			problem.Respond(c, http.StatusInternalServerError, "Failed to load watchlist")
+			return
 		}
+	case c.Query("tickers") != "":
+		errs := validate.Errors{}
+		tickers = errs.Tickers("tickers", strings.Split(c.Query("tickers"), ","))
+		if len(tickers) > maxPriceTickers {
+			errs.Add("tickers", "at most 50 tickers can be requested")
+		}
+		if !validate.OK(c, errs) {
+			return
+		}
+	default:
+		tickers = DefaultTickers()
+	}
 
-		// Get previous day's price to calculate change
-		query2 := `
-            SELECT close
-            FROM stocks
-            WHERE ticker = $1 AND date < $2
-            ORDER BY date DESC
-            LIMIT 1
-        `
-
-		var prevClose float64
-		err = database.DB.QueryRow(query2, ticker, date).Scan(&prevClose)
-
-		change := 0.0
-		if err == nil && prevClose > 0 {
-			change = ((close - prevClose) / prevClose) * 100
+	prices, err := database.GetLatestPrices(tickers)
+	if err != nil {
+		log.Printf("Error getting prices: %v", err)
+		problem.Respond(c, http.StatusInternalServerError, "Failed to load prices")
+		return
+	}
+
+	results := []map[string]interface{}{}
+	for _, ticker := range tickers {
+		p, ok := prices[ticker]
+		if !ok {
+			continue
 		}
 
 		results = append(results, map[string]interface{}{
-			"symbol": t,
-			"price":  close,
-			"change": change,
+			"symbol": p.Ticker,
+			"price":  p.Close,
+			"change": p.Change(),
 		})
 	}
 
@@ -0,0 +1,347 @@
+// Package importer loads daily OHLCV bars from vendor CSV files, so years of
+// history can be stored without spending Alpha Vantage quota. Column names
+// and date formats are configurable; one file may hold many tickers. Every
+// row is validated and bad rows are reported by line instead of failing the
+// whole file.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+)
+
+// Fields a column can be mapped to
+const (
+	FieldTicker = "ticker"
+	FieldDate   = "date"
+	FieldOpen   = "open"
+	FieldHigh   = "high"
+	FieldLow    = "low"
+	FieldClose  = "close"
+	FieldVolume = "volume"
+)
+
+// Fields lists every field in file order
+var Fields = []string{FieldTicker, FieldDate, FieldOpen, FieldHigh, FieldLow, FieldClose, FieldVolume}
+
+// aliases are header names recognized without a mapping, lower case
+var aliases = map[string][]string{
+	FieldTicker: {"ticker", "symbol"},
+	FieldDate:   {"date", "timestamp", "day"},
+	FieldOpen:   {"open"},
+	FieldHigh:   {"high"},
+	FieldLow:    {"low"},
+	FieldClose:  {"close"},
+	FieldVolume: {"volume", "vol"},
+}
+
+// DefaultDateFormats are tried in order when none are configured
+var DefaultDateFormats = []string{"2006-01-02", "2006/01/02", "20060102"}
+
+const (
+	// batchSize rows are saved per transaction
+	batchSize = 500
+	// MaxReportedErrors caps Result.Errors; the count keeps going
+	MaxReportedErrors = 100
+)
+
+// Options configure an import. The zero value reads a comma-separated file
+// whose headers use the usual names.
+type Options struct {
+	Columns     map[string]string // field -> header, overriding the aliases
+	DateFormats []string          // Go layouts, DefaultDateFormats if empty
+	Ticker      string            // for files without a ticker column
+	Comma       rune              // field delimiter, ',' if zero
+	DryRun      bool              // validate only, store nothing
+}
+
+// RowError is one rejected row
+type RowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Result summarizes an import
+type Result struct {
+	Rows            int            `json:"rows"`
+	Imported        int            `json:"imported"`
+	Failed          int            `json:"failed"`
+	Tickers         map[string]int `json:"tickers"` // rows imported per ticker
+	Errors          []RowError     `json:"errors"`
+	ErrorsTruncated bool           `json:"errors_truncated"`
+	DryRun          bool           `json:"dry_run"`
+}
+
+func (r *Result) reject(line int, field, msg string) {
+	r.Failed++
+	if len(r.Errors) >= MaxReportedErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, RowError{Line: line, Field: field, Message: msg})
+}
+
+// ErrBadHeader means the header row can't be mapped to the needed fields
+var ErrBadHeader = errors.New("invalid CSV header")
+
+// ParseColumns reads a mapping like "date=Trade Date,close=Adj Close"
+func ParseColumns(spec string) (map[string]string, error) {
+	columns := map[string]string{}
+	if strings.TrimSpace(spec) == "" {
+		return columns, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		field, header, ok := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !ok || strings.TrimSpace(header) == "" {
+			return nil, fmt.Errorf("column mapping %q must look like field=Header", pair)
+		}
+		if _, known := aliases[field]; !known {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(Fields, ", "))
+		}
+		columns[field] = strings.TrimSpace(header)
+	}
+	return columns, nil
+}
+
+// ParseDelimiter reads a delimiter option: one character, or "tab". Empty
+// means the default comma, returned as 0. Quotes and line breaks can't
+// separate fields.
+func ParseDelimiter(spec string) (rune, error) {
+	if spec == "" {
+		return 0, nil
+	}
+	if spec == "tab" {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(spec)
+	if size != len(spec) || r == utf8.RuneError || r == '"' || r == '\n' || r == '\r' {
+		return 0, errors.New("must be a single character or tab, other than a quote or line break")
+	}
+	return r, nil
+}
+
+// Import reads r and saves every valid row. Only an unreadable file or a
+// failed save is returned as an error; bad rows land in Result.Errors.
+func Import(r io.Reader, opts Options) (*Result, error) {
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: file is empty", ErrBadHeader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	index, err := mapHeader(header, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fixedTicker := ""
+	if _, ok := index[FieldTicker]; !ok {
+		if fixedTicker, err = validate.NormalizeTicker(opts.Ticker); err != nil {
+			return nil, fmt.Errorf("%w: the file has no ticker column, pass a ticker (%v)", ErrBadHeader, err)
+		}
+	}
+	formats := opts.DateFormats
+	if len(formats) == 0 {
+		formats = DefaultDateFormats
+	}
+
+	res := &Result{Tickers: map[string]int{}, DryRun: opts.DryRun}
+	if !opts.DryRun {
+		// One round of save hooks (live prices, alerts) for the whole file,
+		// covering the batches saved before any error
+		defer func() { database.StocksSaved(slices.Sorted(maps.Keys(res.Tickers))) }()
+	}
+	batch := make([]database.StockBar, 0, batchSize)
+	// Rows only count as imported once their batch is saved
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if !opts.DryRun {
+			if err := database.StoreStockBatch(batch); err != nil {
+				return err
+			}
+		}
+		for _, bar := range batch {
+			res.Tickers[bar.Ticker]++
+		}
+		res.Imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			res.Rows++
+			res.reject(parseErr.Line, "", parseErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		if blank(record) {
+			continue
+		}
+		res.Rows++
+		line, _ := cr.FieldPos(0)
+
+		bar, field, msg := parseRow(record, index, fixedTicker, formats)
+		if msg != "" {
+			res.reject(line, field, msg)
+			continue
+		}
+		batch = append(batch, bar)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, flush()
+}
+
+// mapHeader finds each field's column, by mapping first and then aliases
+func mapHeader(header []string, opts Options) (map[string]int, error) {
+	byName := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if _, dup := byName[h]; !dup {
+			byName[h] = i
+		}
+	}
+
+	index := map[string]int{}
+	for _, field := range Fields {
+		if name, ok := opts.Columns[field]; ok {
+			i, found := byName[strings.ToLower(name)]
+			if !found {
+				return nil, fmt.Errorf("%w: no column %q for %s", ErrBadHeader, name, field)
+			}
+			index[field] = i
+			continue
+		}
+		for _, alias := range aliases[field] {
+			if i, found := byName[alias]; found {
+				index[field] = i
+				break
+			}
+		}
+	}
+
+	var missing []string
+	for _, field := range Fields {
+		if _, ok := index[field]; !ok && field != FieldTicker {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing %s columns", ErrBadHeader, strings.Join(missing, ", "))
+	}
+	return index, nil
+}
+
+// parseRow validates one record. On failure it returns the field at fault
+// and a message.
+func parseRow(record []string, index map[string]int, fixedTicker string, formats []string) (database.StockBar, string, string) {
+	var bar database.StockBar
+	get := func(field string) string {
+		if i := index[field]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	bar.Ticker = fixedTicker
+	if fixedTicker == "" {
+		t, err := validate.NormalizeTicker(get(FieldTicker))
+		if err != nil {
+			return bar, FieldTicker, err.Error()
+		}
+		bar.Ticker = t
+	}
+
+	date, ok := parseDate(get(FieldDate), formats)
+	if !ok {
+		return bar, FieldDate, fmt.Sprintf("%q doesn't match %s", get(FieldDate), strings.Join(formats, " or "))
+	}
+	if err := validate.CheckDate(date); err != nil {
+		return bar, FieldDate, err.Error()
+	}
+	bar.Date = date
+
+	prices := []struct {
+		field string
+		dst   *float64
+	}{{FieldOpen, &bar.Open}, {FieldHigh, &bar.High}, {FieldLow, &bar.Low}, {FieldClose, &bar.Close}}
+	for _, p := range prices {
+		v, err := strconv.ParseFloat(get(p.field), 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return bar, p.field, fmt.Sprintf("%q is not a number", get(p.field))
+		}
+		if v <= 0 {
+			return bar, p.field, "must be positive"
+		}
+		*p.dst = v
+	}
+	if bar.High < max(bar.Open, bar.Close, bar.Low) {
+		return bar, FieldHigh, "must not be below open, low or close"
+	}
+	if bar.Low > min(bar.Open, bar.Close) {
+		return bar, FieldLow, "must not be above open or close"
+	}
+
+	// Some vendors write volume as 1.2345e+06 or 1234.0
+	vol, err := strconv.ParseFloat(get(FieldVolume), 64)
+	if err != nil || vol < 0 || vol != math.Trunc(vol) || vol > math.MaxInt64 {
+		return bar, FieldVolume, fmt.Sprintf("%q is not a whole, non-negative number", get(FieldVolume))
+	}
+	bar.Volume = int64(vol)
+
+	return bar, "", ""
+}
+
+func parseDate(v string, formats []string) (time.Time, bool) {
+	for _, f := range formats {
+		if d, err := time.Parse(f, v); err == nil {
+			return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func blank(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
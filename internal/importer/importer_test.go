@@ -0,0 +1,255 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chuma-beep/stock-saas/internal/cache"
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    rune
+		wantErr bool
+	}{
+		{"", 0, false},
+		{",", ',', false},
+		{";", ';', false},
+		{"|", '|', false},
+		{"tab", '\t', false},
+		{"\t", '\t', false},
+		{"§", '§', false},
+		{`"`, 0, true},
+		{"\n", 0, true},
+		{"\r", 0, true},
+		{",,", 0, true},
+		{"comma", 0, true},
+		{"\xff", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.spec), func(t *testing.T) {
+			got, err := ParseDelimiter(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDelimiter(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDelimiter(%q) = %q, want %q", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	got, err := ParseColumns(" Date = Trade Date , close=Adj Close")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[FieldDate] != "Trade Date" || got[FieldClose] != "Adj Close" || len(got) != 2 {
+		t.Errorf("ParseColumns() = %v", got)
+	}
+	for _, spec := range []string{"date", "date=", "price=Close"} {
+		if _, err := ParseColumns(spec); err == nil {
+			t.Errorf("ParseColumns(%q) accepted a bad mapping", spec)
+		}
+	}
+}
+
+func TestParseRow(t *testing.T) {
+	index := map[string]int{FieldTicker: 0, FieldDate: 1, FieldOpen: 2, FieldHigh: 3, FieldLow: 4, FieldClose: 5, FieldVolume: 6}
+	tests := []struct {
+		name      string
+		record    string
+		fixed     string
+		wantField string
+		want      database.StockBar
+	}{
+		{name: "valid", record: "aapl,2024-01-02,10,12,9,11,1000",
+			want: database.StockBar{Ticker: "AAPL", Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Open: 10, High: 12, Low: 9, Close: 11, Volume: 1000}},
+		{name: "fixed ticker", record: "ignored,20240102,10,12,9,11,1000", fixed: "MSFT",
+			want: database.StockBar{Ticker: "MSFT", Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Open: 10, High: 12, Low: 9, Close: 11, Volume: 1000}},
+		{name: "scientific volume", record: "AAPL,2024/01/02,10,12,9,11,1.5e+03",
+			want: database.StockBar{Ticker: "AAPL", Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Open: 10, High: 12, Low: 9, Close: 11, Volume: 1500}},
+		{name: "bad ticker", record: "not a ticker!,2024-01-02,10,12,9,11,1000", wantField: FieldTicker},
+		{name: "bad date", record: "AAPL,02.01.2024,10,12,9,11,1000", wantField: FieldDate},
+		{name: "future date", record: "AAPL," + time.Now().AddDate(1, 0, 0).Format("2006-01-02") + ",10,12,9,11,1000", wantField: FieldDate},
+		{name: "price not a number", record: "AAPL,2024-01-02,ten,12,9,11,1000", wantField: FieldOpen},
+		{name: "NaN price", record: "AAPL,2024-01-02,10,NaN,9,11,1000", wantField: FieldHigh},
+		{name: "negative price", record: "AAPL,2024-01-02,10,12,-9,11,1000", wantField: FieldLow},
+		{name: "high below close", record: "AAPL,2024-01-02,10,10.5,9,11,1000", wantField: FieldHigh},
+		{name: "low above open", record: "AAPL,2024-01-02,10,12,10.5,11,1000", wantField: FieldLow},
+		{name: "fractional volume", record: "AAPL,2024-01-02,10,12,9,11,10.5", wantField: FieldVolume},
+		{name: "negative volume", record: "AAPL,2024-01-02,10,12,9,11,-1", wantField: FieldVolume},
+		{name: "short row", record: "AAPL,2024-01-02,10,12,9,11", wantField: FieldVolume},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bar, field, msg := parseRow(strings.Split(tt.record, ","), index, tt.fixed, DefaultDateFormats)
+			if field != tt.wantField {
+				t.Fatalf("field = %q (%s), want %q", field, msg, tt.wantField)
+			}
+			if tt.wantField != "" {
+				if msg == "" {
+					t.Error("rejected without a message")
+				}
+				return
+			}
+			if bar != tt.want {
+				t.Errorf("bar = %+v, want %+v", bar, tt.want)
+			}
+		})
+	}
+}
+
+// mockDB points database.DB at a sqlmock and turns caching off for the test
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevCache := database.DB, cache.Default
+	database.DB, cache.Default = db, cache.NewLRU(0)
+	t.Cleanup(func() {
+		database.DB, cache.Default = prevDB, prevCache
+		db.Close()
+	})
+	return mock
+}
+
+// csvRows builds a file with a header and n valid AAPL rows
+func csvRows(n int) string {
+	var b strings.Builder
+	b.WriteString("Symbol,Date,Open,High,Low,Close,Volume\n")
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range n {
+		fmt.Fprintf(&b, "AAPL,%s,10,12,9,11,1000\n", day.AddDate(0, 0, i).Format("2006-01-02"))
+	}
+	return b.String()
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		opts         Options
+		wantErr      error
+		wantRows     int
+		wantImported int
+		wantFailed   int
+		wantLines    []int
+	}{
+		{name: "empty file", file: "", wantErr: ErrBadHeader},
+		{name: "missing columns", file: "date,close\n2024-01-02,1\n", wantErr: ErrBadHeader},
+		{name: "no ticker column or option", file: "date,open,high,low,close,volume\n", wantErr: ErrBadHeader},
+		{name: "mapped columns and fixed ticker",
+			file: "Trade Date;O;H;L;Adj Close;V\n02/01/2024;10;12;9;11;1000\n",
+			opts: Options{Columns: map[string]string{FieldDate: "Trade Date", FieldOpen: "O", FieldHigh: "H", FieldLow: "L", FieldClose: "Adj Close", FieldVolume: "V"},
+				DateFormats: []string{"02/01/2006"}, Ticker: "brk.b", Comma: ';'},
+			wantRows: 1, wantImported: 1},
+		{name: "bad rows reported by line",
+			file:     "ticker,date,open,high,low,close,volume\nAAPL,2024-01-02,10,12,9,11,1000\n\nAAPL,bad,10,12,9,11,1000\nAAPL,2024-01-03,10,12,9,11,x\n",
+			wantRows: 3, wantImported: 1, wantFailed: 2, wantLines: []int{4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.DryRun = true
+			res, err := Import(strings.NewReader(tt.file), tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Rows != tt.wantRows || res.Imported != tt.wantImported || res.Failed != tt.wantFailed {
+				t.Errorf("rows/imported/failed = %d/%d/%d, want %d/%d/%d",
+					res.Rows, res.Imported, res.Failed, tt.wantRows, tt.wantImported, tt.wantFailed)
+			}
+			for i, line := range tt.wantLines {
+				if i >= len(res.Errors) || res.Errors[i].Line != line {
+					t.Errorf("errors = %+v, want lines %v", res.Errors, tt.wantLines)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestImportCountsSavedBatchesOnly(t *testing.T) {
+	mock := mockDB(t)
+	// The first batch is saved, the second fails
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO stocks")
+	for range batchSize {
+		prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO stocks").ExpectExec().WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	res, err := Import(strings.NewReader(csvRows(batchSize+10)), Options{})
+	if err == nil {
+		t.Fatal("Import() succeeded, want the save error")
+	}
+	if res.Rows != batchSize+10 {
+		t.Errorf("Rows = %d, want %d", res.Rows, batchSize+10)
+	}
+	if res.Imported != batchSize || res.Tickers["AAPL"] != batchSize {
+		t.Errorf("Imported = %d, Tickers = %v, want only the saved batch of %d", res.Imported, res.Tickers, batchSize)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// saveCalls records the tickers of each database.StocksSaved call
+var saveCalls struct {
+	sync.Mutex
+	calls [][]string
+}
+
+func init() {
+	database.OnStocksSaved(func(tickers []string) {
+		saveCalls.Lock()
+		saveCalls.calls = append(saveCalls.calls, tickers)
+		saveCalls.Unlock()
+	})
+}
+
+func TestImportRunsSaveHooksOnce(t *testing.T) {
+	mock := mockDB(t)
+	for _, n := range []int{batchSize, 10} {
+		mock.ExpectBegin()
+		prep := mock.ExpectPrepare("INSERT INTO stocks")
+		for range n {
+			prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+	}
+	saveCalls.Lock()
+	saveCalls.calls = nil
+	saveCalls.Unlock()
+
+	if _, err := Import(strings.NewReader(csvRows(batchSize+10)), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	saveCalls.Lock()
+	defer saveCalls.Unlock()
+	if len(saveCalls.calls) != 1 || !slices.Equal(saveCalls.calls[0], []string{"AAPL"}) {
+		t.Errorf("save hooks called with %v, want once with [AAPL]", saveCalls.calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
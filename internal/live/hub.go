@@ -0,0 +1,368 @@
+// Package live pushes price updates to WebSocket subscribers. A Hub fans
+// each quote out to every client subscribed to its ticker. Quotes come from
+// newly stored bars (wired with database.OnStocksSaved) and from an optional
+// Provider of intraday ticks.
+//
+// Slow clients can't hold up the hub: each client keeps at most one waiting
+// quote per ticker, so a newer price replaces one that hasn't been sent yet
+// and a client that falls behind skips straight to the latest prices.
+package live
+
+import (
+	"errors"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// Quote sources
+const (
+	SourceBar  = "bar"  // latest stored daily close
+	SourceTick = "tick" // intraday price from a quote provider
+)
+
+// MaxSubscriptions caps the tickers one client may follow
+const MaxSubscriptions = 50
+
+// Errors returned by Connect and Subscribe
+var (
+	ErrTooManyClients  = errors.New("too many live connections")
+	ErrTooManyForOwner = errors.New("too many live connections from one user or address")
+	ErrTooManyTickers  = errors.New("too many subscriptions")
+)
+
+// Quote is one price update as sent to clients
+type Quote struct {
+	Symbol    string    `json:"symbol"`
+	Price     float64   `json:"price"`
+	PrevClose float64   `json:"prev_close,omitempty"`
+	Change    float64   `json:"change"` // percent from PrevClose
+	Date      string    `json:"date"`   // trading day, YYYY-MM-DD
+	Source    string    `json:"source"`
+	Time      time.Time `json:"time"`
+}
+
+// FromBar turns a stored close into a quote
+func FromBar(p database.LatestPrice) Quote {
+	return Quote{
+		Symbol:    p.Ticker,
+		Price:     p.Close,
+		PrevClose: p.PrevClose,
+		Change:    p.Change(),
+		Date:      p.Date.Format("2006-01-02"),
+		Source:    SourceBar,
+		Time:      time.Now().UTC(),
+	}
+}
+
+// Hub tracks clients and their subscriptions. The zero value is not usable;
+// use NewHub.
+type Hub struct {
+	// MaxClients caps open connections, 0 for no limit
+	MaxClients int
+	// MaxPerOwner caps the connections of one user or address, 0 for no
+	// limit
+	MaxPerOwner int
+	// Debounce groups a burst of saved bars, like one fetch of 100 days,
+	// into a single lookup per ticker
+	Debounce time.Duration
+
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+	owners  map[string]int // open connections per owner
+	subs    map[string]map[*Client]struct{}
+	last    map[string]Quote // latest quote of each subscribed ticker
+
+	dirtyMu sync.Mutex
+	dirty   map[string]bool
+	timer   *time.Timer
+}
+
+// NewHub makes an empty hub
+func NewHub(maxClients, maxPerOwner int) *Hub {
+	return &Hub{
+		MaxClients:  maxClients,
+		MaxPerOwner: maxPerOwner,
+		Debounce:    250 * time.Millisecond,
+		clients:     map[*Client]struct{}{},
+		owners:      map[string]int{},
+		subs:        map[string]map[*Client]struct{}{},
+		last:        map[string]Quote{},
+		dirty:       map[string]bool{},
+	}
+}
+
+// Default is the hub used by the API. LIVE_MAX_CONNECTIONS caps its
+// connections (default 1000) and LIVE_MAX_CONNECTIONS_PER_CLIENT those of
+// one user or address (default 5).
+var Default = NewHub(envInt("LIVE_MAX_CONNECTIONS", 1000), envInt("LIVE_MAX_CONNECTIONS_PER_CLIENT", 5))
+
+// Connect registers a new client for owner, a user or address that
+// MaxPerOwner counts connections by
+func (h *Hub) Connect(owner string) (*Client, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.MaxClients > 0 && len(h.clients) >= h.MaxClients {
+		return nil, ErrTooManyClients
+	}
+	if h.MaxPerOwner > 0 && h.owners[owner] >= h.MaxPerOwner {
+		return nil, ErrTooManyForOwner
+	}
+	h.owners[owner]++
+	c := &Client{
+		owner:   owner,
+		tickers: map[string]bool{},
+		pending: map[string]Quote{},
+		ready:   make(chan struct{}, 1),
+	}
+	h.clients[c] = struct{}{}
+	return c, nil
+}
+
+// Disconnect drops a client and all its subscriptions
+func (h *Hub) Disconnect(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for t := range c.tickers {
+		h.unsubscribe(c, t)
+	}
+	delete(h.clients, c)
+	if h.owners[c.owner]--; h.owners[c.owner] <= 0 {
+		delete(h.owners, c.owner)
+	}
+}
+
+// Subscribe adds tickers to a client's subscriptions and queues the latest
+// known quote of each new one, so the client starts with a price. It
+// returns the tickers that were added.
+func (h *Hub) Subscribe(c *Client, tickers []string) ([]string, error) {
+	h.mu.Lock()
+	var added, cold []string
+	for _, t := range tickers {
+		if !c.tickers[t] && !slices.Contains(added, t) {
+			added = append(added, t)
+		}
+	}
+	if len(c.tickers)+len(added) > MaxSubscriptions {
+		h.mu.Unlock()
+		return nil, ErrTooManyTickers
+	}
+	for _, t := range added {
+		c.tickers[t] = true
+		if h.subs[t] == nil {
+			h.subs[t] = map[*Client]struct{}{}
+		}
+		h.subs[t][c] = struct{}{}
+		if q, ok := h.last[t]; ok {
+			c.offer(q)
+		} else {
+			cold = append(cold, t)
+		}
+	}
+	h.mu.Unlock()
+
+	// Nobody else is following these yet; load the stored close
+	for _, t := range cold {
+		h.publishBar(t)
+	}
+	return added, nil
+}
+
+// Unsubscribe removes tickers from a client's subscriptions
+func (h *Hub) Unsubscribe(c *Client, tickers []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range tickers {
+		if c.tickers[t] {
+			h.unsubscribe(c, t)
+		}
+	}
+}
+
+// unsubscribe must be called with h.mu held
+func (h *Hub) unsubscribe(c *Client, t string) {
+	delete(c.tickers, t)
+	c.drop(t)
+	delete(h.subs[t], c)
+	if len(h.subs[t]) == 0 {
+		delete(h.subs, t)
+		delete(h.last, t)
+	}
+}
+
+// Subscriptions lists a client's tickers in order
+func (h *Hub) Subscriptions(c *Client) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return slices.Sorted(maps.Keys(c.tickers))
+}
+
+// Tickers lists every ticker with at least one subscriber, in order.
+// Providers use it to decide what to quote.
+func (h *Hub) Tickers() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return slices.Sorted(maps.Keys(h.subs))
+}
+
+// Last returns the latest quote sent for a subscribed ticker
+func (h *Hub) Last(ticker string) (Quote, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	q, ok := h.last[ticker]
+	return q, ok
+}
+
+// Clients counts open connections
+func (h *Hub) Clients() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// Publish sends q to every subscriber of its ticker without blocking. A
+// quote for an earlier trading day than the last one sent, or a repeat of
+// it, is dropped, so backfilling old bars doesn't move the price.
+func (h *Hub) Publish(q Quote) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.subs[q.Symbol]
+	if len(subs) == 0 {
+		return
+	}
+	if prev, ok := h.last[q.Symbol]; ok {
+		if q.Date < prev.Date || (q.Date == prev.Date && q.Price == prev.Price && q.Source == prev.Source) {
+			return
+		}
+	}
+	h.last[q.Symbol] = q
+	for c := range subs {
+		c.offer(q)
+	}
+}
+
+// BarsSaved is the database.OnStocksSaved hook. Lookups run after
+// h.Debounce, once per ticker, and only for tickers someone follows.
+func (h *Hub) BarsSaved(tickers []string) {
+	h.dirtyMu.Lock()
+	defer h.dirtyMu.Unlock()
+	for _, t := range tickers {
+		h.dirty[t] = true
+	}
+	if h.timer == nil {
+		h.timer = time.AfterFunc(h.Debounce, h.flushSaved)
+	}
+}
+
+func (h *Hub) flushSaved() {
+	h.dirtyMu.Lock()
+	dirty := h.dirty
+	h.dirty = map[string]bool{}
+	h.timer = nil
+	h.dirtyMu.Unlock()
+
+	for t := range dirty {
+		h.mu.RLock()
+		followed := len(h.subs[t]) > 0
+		h.mu.RUnlock()
+		if followed {
+			h.publishBar(t)
+		}
+	}
+}
+
+func (h *Hub) publishBar(ticker string) {
+	p, err := database.GetLatestPrice(ticker)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading latest price for %s: %v", ticker, err)
+		return
+	}
+	h.Publish(FromBar(p))
+}
+
+// Client is one connection's subscriptions and unsent quotes
+type Client struct {
+	owner   string
+	tickers map[string]bool // guarded by the hub's mu
+
+	mu      sync.Mutex
+	pending map[string]Quote
+	order   []string // pending tickers, oldest first
+	ready   chan struct{}
+
+	skipped atomic.Int64
+}
+
+// offer queues q, replacing an unsent quote for the same ticker
+func (c *Client) offer(q Quote) {
+	c.mu.Lock()
+	if _, ok := c.pending[q.Symbol]; ok {
+		c.skipped.Add(1)
+	} else {
+		c.order = append(c.order, q.Symbol)
+	}
+	c.pending[q.Symbol] = q
+	c.mu.Unlock()
+
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// drop forgets an unsent quote for an unsubscribed ticker
+func (c *Client) drop(ticker string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[ticker]; !ok {
+		return
+	}
+	delete(c.pending, ticker)
+	for i, t := range c.order {
+		if t == ticker {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Ready receives when quotes are waiting to be taken
+func (c *Client) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// Take removes and returns the waiting quotes, in the order their tickers
+// first became pending
+func (c *Client) Take() []Quote {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	quotes := make([]Quote, 0, len(c.order))
+	for _, t := range c.order {
+		quotes = append(quotes, c.pending[t])
+		delete(c.pending, t)
+	}
+	c.order = c.order[:0]
+	return quotes
+}
+
+// Skipped counts quotes replaced by a newer one before they were sent
+func (c *Client) Skipped() int64 {
+	return c.skipped.Load()
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,145 @@
+package live
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chuma-beep/stock-saas/internal/cache"
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// noStoredPrices answers the latest-price lookups of cold subscriptions
+// with nothing, so only published quotes reach clients
+func noStoredPrices(t *testing.T) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.MatchExpectationsInOrder(false)
+	for range 10 {
+		mock.ExpectQuery(".").WillReturnRows(sqlmock.NewRows([]string{"ticker", "date", "close", "prev_close"}))
+	}
+	prevDB, prevCache := database.DB, cache.Default
+	database.DB, cache.Default = db, cache.NewLRU(0)
+	t.Cleanup(func() {
+		database.DB, cache.Default = prevDB, prevCache
+		db.Close()
+	})
+}
+
+func quote(symbol, date string, price float64) Quote {
+	return Quote{Symbol: symbol, Date: date, Price: price, Source: SourceTick}
+}
+
+func TestSlowClientGetsTheNewestQuote(t *testing.T) {
+	noStoredPrices(t)
+	h := NewHub(0, 0)
+	c, err := h.Connect("ip:192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Subscribe(c, []string{"AAPL", "MSFT"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client reads nothing while three AAPL ticks and one MSFT tick land
+	h.Publish(quote("AAPL", "2026-01-02", 100))
+	h.Publish(quote("MSFT", "2026-01-02", 300))
+	h.Publish(quote("AAPL", "2026-01-02", 101))
+	h.Publish(quote("AAPL", "2026-01-02", 102))
+
+	select {
+	case <-c.Ready():
+	default:
+		t.Fatal("Ready() didn't signal pending quotes")
+	}
+	got := c.Take()
+	if len(got) != 2 || got[0].Symbol != "AAPL" || got[0].Price != 102 || got[1].Symbol != "MSFT" {
+		t.Errorf("Take() = %+v, want the latest AAPL then MSFT", got)
+	}
+	if c.Skipped() != 2 {
+		t.Errorf("Skipped() = %d, want 2 replaced AAPL quotes", c.Skipped())
+	}
+	if rest := c.Take(); len(rest) != 0 {
+		t.Errorf("second Take() = %+v, want nothing", rest)
+	}
+}
+
+func TestPublishDropsOlderAndRepeatedQuotes(t *testing.T) {
+	noStoredPrices(t)
+	h := NewHub(0, 0)
+	c, _ := h.Connect("user:1")
+	h.Subscribe(c, []string{"AAPL"})
+
+	h.Publish(quote("AAPL", "2026-01-05", 100))
+	c.Take()
+	h.Publish(quote("AAPL", "2026-01-02", 90))  // backfilled bar
+	h.Publish(quote("AAPL", "2026-01-05", 100)) // repeat
+	if got := c.Take(); len(got) != 0 {
+		t.Errorf("Take() = %+v, want older and repeated quotes dropped", got)
+	}
+}
+
+func TestUnsubscribeDropsPendingQuote(t *testing.T) {
+	noStoredPrices(t)
+	h := NewHub(0, 0)
+	c, _ := h.Connect("user:1")
+	h.Subscribe(c, []string{"AAPL", "MSFT"})
+	h.Publish(quote("AAPL", "2026-01-02", 100))
+	h.Publish(quote("MSFT", "2026-01-02", 300))
+
+	h.Unsubscribe(c, []string{"AAPL"})
+	if got := c.Take(); len(got) != 1 || got[0].Symbol != "MSFT" {
+		t.Errorf("Take() = %+v, want only MSFT", got)
+	}
+	if _, ok := h.Last("AAPL"); ok {
+		t.Error("Last(AAPL) kept a quote nobody follows")
+	}
+}
+
+func TestConnectionCaps(t *testing.T) {
+	h := NewHub(3, 2)
+	a1, err := h.Connect("ip:192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Connect("ip:192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Connect("ip:192.0.2.1"); !errors.Is(err, ErrTooManyForOwner) {
+		t.Errorf("third connection from one address: err = %v, want ErrTooManyForOwner", err)
+	}
+	if _, err := h.Connect("user:7"); err != nil {
+		t.Errorf("another owner was refused: %v", err)
+	}
+	if _, err := h.Connect("user:8"); !errors.Is(err, ErrTooManyClients) {
+		t.Errorf("connection past MaxClients: err = %v, want ErrTooManyClients", err)
+	}
+
+	// Closing one frees a slot for its owner and for everyone
+	h.Disconnect(a1)
+	if _, err := h.Connect("ip:192.0.2.1"); err != nil {
+		t.Errorf("reconnect after Disconnect: %v", err)
+	}
+	if h.Clients() != 3 {
+		t.Errorf("Clients() = %d, want 3", h.Clients())
+	}
+}
+
+func TestSubscriptionCap(t *testing.T) {
+	noStoredPrices(t)
+	h := NewHub(0, 0)
+	c, _ := h.Connect("user:1")
+	tickers := make([]string, MaxSubscriptions+1)
+	for i := range tickers {
+		tickers[i] = "T" + string(rune('A'+i%26)) + string(rune('A'+i/26))
+	}
+	if _, err := h.Subscribe(c, tickers); !errors.Is(err, ErrTooManyTickers) {
+		t.Errorf("Subscribe(%d tickers) err = %v, want ErrTooManyTickers", len(tickers), err)
+	}
+	if subs := h.Subscriptions(c); len(subs) != 0 {
+		t.Errorf("Subscriptions() = %v after a refused Subscribe", subs)
+	}
+}
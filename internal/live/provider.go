@@ -0,0 +1,142 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/services"
+)
+
+// Provider feeds intraday ticks into a hub until ctx is done
+type Provider interface {
+	Name() string
+	Run(ctx context.Context, h *Hub)
+}
+
+// NewProvider picks the tick source from LIVE_QUOTE_PROVIDER: alphavantage,
+// fake, or empty for none, in which case only stored bars are pushed.
+// LIVE_QUOTE_INTERVAL overrides how often it quotes.
+func NewProvider() Provider {
+	switch name := os.Getenv("LIVE_QUOTE_PROVIDER"); name {
+	case "", "none":
+		return nil
+	case "alphavantage":
+		return &AlphaVantageProvider{Interval: envDuration("LIVE_QUOTE_INTERVAL", time.Minute)}
+	case "fake":
+		return &FakeProvider{Interval: envDuration("LIVE_QUOTE_INTERVAL", 2*time.Second)}
+	default:
+		log.Printf("⚠️ Unknown LIVE_QUOTE_PROVIDER %q, live prices will only follow stored bars", name)
+		return nil
+	}
+}
+
+// AlphaVantageProvider polls GLOBAL_QUOTE for one followed ticker per
+// Interval, round robin, so quota use doesn't grow with the subscriber count
+type AlphaVantageProvider struct {
+	Interval time.Duration
+}
+
+func (p *AlphaVantageProvider) Name() string { return "alphavantage" }
+
+func (p *AlphaVantageProvider) Run(ctx context.Context, h *Hub) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	next := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		symbol := nextTicker(h.Tickers(), next)
+		if symbol == "" {
+			continue
+		}
+		next = symbol
+
+		q, err := services.FetchQuote(symbol)
+		switch {
+		case errors.Is(err, services.ErrRateLimited):
+			log.Printf("⚠️ Live quotes rate limited, skipping %s", symbol)
+			continue
+		case err != nil:
+			log.Printf("Error fetching live quote for %s: %v", symbol, err)
+			continue
+		}
+
+		tick := Quote{
+			Symbol:    symbol,
+			Price:     q.Price,
+			PrevClose: q.PreviousClose,
+			Date:      q.LatestDay.Format("2006-01-02"),
+			Source:    SourceTick,
+			Time:      time.Now().UTC(),
+		}
+		if q.PreviousClose > 0 {
+			tick.Change = (q.Price - q.PreviousClose) / q.PreviousClose * 100
+		}
+		h.Publish(tick)
+	}
+}
+
+// nextTicker returns the ticker after prev in the sorted list, wrapping
+func nextTicker(tickers []string, prev string) string {
+	for _, t := range tickers {
+		if t > prev {
+			return t
+		}
+	}
+	if len(tickers) > 0 {
+		return tickers[0]
+	}
+	return ""
+}
+
+// FakeProvider random-walks every followed price each Interval, for working
+// on clients without spending quota
+type FakeProvider struct {
+	Interval time.Duration
+}
+
+func (p *FakeProvider) Name() string { return "fake" }
+
+func (p *FakeProvider) Run(ctx context.Context, h *Hub) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, symbol := range h.Tickers() {
+			last, ok := h.Last(symbol)
+			if !ok {
+				continue
+			}
+			tick := last
+			tick.Price = last.Price * (1 + rand.NormFloat64()*0.002)
+			tick.Source = SourceTick
+			tick.Time = time.Now().UTC()
+			if tick.PrevClose > 0 {
+				tick.Change = (tick.Price - tick.PrevClose) / tick.PrevClose * 100
+			}
+			h.Publish(tick)
+		}
+	}
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+var ErrEmailNotConfigured = errors.New("SMTP_HOST is not set")
+
+// EmailChannel sends plain-text mail through an SMTP server. Leaving
+// Username empty skips authentication, which is what local sinks such as
+// MailHog or Mailpit expect.
+type EmailChannel struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewEmailChannel reads SMTP settings from the environment
+func NewEmailChannel() *EmailChannel {
+	e := &EmailChannel{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if e.Port == "" {
+		e.Port = "587"
+	}
+	if e.From == "" {
+		e.From = "alerts@stock-saas.local"
+	}
+	return e
+}
+
+func (e *EmailChannel) Send(ch database.NotificationChannel, msg Message) (int, error) {
+	if e.Host == "" {
+		return 0, &PermanentError{ErrEmailNotConfigured}
+	}
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+
+	addr := net.JoinHostPort(e.Host, e.Port)
+	if err := smtp.SendMail(addr, auth, e.From, []string{ch.Target}, e.compose(ch.Target, msg)); err != nil {
+		return 0, fmt.Errorf("smtp: %w", err)
+	}
+	return 0, nil
+}
+
+func (e *EmailChannel) compose(to string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSafe(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", msg.CreatedAt.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@stock-saas>\r\n", msg.ID)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// headerSafe strips line breaks so a value can't inject extra headers
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
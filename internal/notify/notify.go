@@ -0,0 +1,178 @@
+// Package notify delivers user notifications over email and signed webhooks.
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// Channel kinds
+const (
+	KindEmail   = "email"
+	KindWebhook = "webhook"
+)
+
+// Events users can subscribe a channel to
+const (
+	EventAlertTriggered = "alert.triggered"
+	EventTest           = "notification.test"
+)
+
+// Events lists every event a channel can subscribe to
+var Events = []string{EventAlertTriggered, EventTest}
+
+// Delivery statuses
+const (
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Message is one event to deliver. Email uses Subject and Text; webhooks
+// send ID, Event, CreatedAt and Data as JSON.
+type Message struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	CreatedAt time.Time              `json:"created_at"`
+	Subject   string                 `json:"-"`
+	Text      string                 `json:"-"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Channel sends a message to one configured destination. It returns the
+// remote status code where there is one.
+type Channel interface {
+	Send(ch database.NotificationChannel, msg Message) (int, error)
+}
+
+// PermanentError marks a failure that retrying won't fix
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Dispatcher fans a message out to a user's channels, retrying failed
+// sends with exponential backoff and logging every delivery
+type Dispatcher struct {
+	Channels    map[string]Channel
+	MaxAttempts int
+	Backoff     time.Duration
+
+	pending sync.WaitGroup
+}
+
+// Default is the dispatcher used by the API
+var Default = &Dispatcher{
+	Channels: map[string]Channel{
+		KindEmail:   NewEmailChannel(),
+		KindWebhook: NewWebhookChannel(),
+	},
+	MaxAttempts: 4,
+	Backoff:     2 * time.Second,
+}
+
+// NewMessage stamps a message with a random ID and the current time
+func NewMessage(event, subject, text string, data map[string]interface{}) Message {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return Message{
+		ID:        "evt_" + hex.EncodeToString(b),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Subject:   subject,
+		Text:      text,
+		Data:      data,
+	}
+}
+
+// Notify delivers msg to every enabled channel the user subscribed to the
+// event. It returns immediately; deliveries and retries run in the background.
+func (d *Dispatcher) Notify(userID int, msg Message) {
+	d.pending.Add(1)
+	go func() {
+		defer d.pending.Done()
+		channels, err := database.ChannelsForEvent(userID, msg.Event)
+		if err != nil {
+			log.Printf("Error loading notification channels for user %d: %v", userID, err)
+			return
+		}
+		for _, ch := range channels {
+			d.Deliver(ch, msg)
+		}
+	}()
+}
+
+// Wait blocks until every message passed to Notify has been delivered or
+// given up on
+func (d *Dispatcher) Wait() {
+	d.pending.Wait()
+}
+
+// Deliver sends msg to one channel, retrying until it succeeds, fails
+// permanently or runs out of attempts, and records the outcome
+func (d *Dispatcher) Deliver(ch database.NotificationChannel, msg Message) database.NotificationDelivery {
+	delivery := database.NotificationDelivery{
+		ChannelID: ch.ID,
+		UserID:    ch.UserID,
+		Event:     msg.Event,
+		Status:    StatusFailed,
+	}
+
+	channel, ok := d.Channels[ch.Kind]
+	if !ok {
+		delivery.Error = fmt.Sprintf("unsupported channel kind %q", ch.Kind)
+	}
+
+	for attempt := 1; ok && attempt <= d.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(d.Backoff << (attempt - 2))
+		}
+		delivery.Attempts = attempt
+
+		code, err := channel.Send(ch, msg)
+		delivery.ResponseCode = code
+		if err == nil {
+			now := time.Now()
+			delivery.Status = StatusDelivered
+			delivery.Error = ""
+			delivery.DeliveredAt = &now
+			break
+		}
+		delivery.Error = err.Error()
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) {
+			break
+		}
+	}
+
+	if delivery.Status == StatusFailed {
+		log.Printf("Notification %s to channel %d failed after %d attempts: %s",
+			msg.Event, ch.ID, delivery.Attempts, delivery.Error)
+	}
+	if err := database.LogNotificationDelivery(&delivery); err != nil {
+		log.Printf("Error logging notification delivery: %v", err)
+	}
+	return delivery
+}
+
+// AlertTriggered builds the notification for a fired alert rule
+func AlertTriggered(t database.AlertTrigger) Message {
+	return NewMessage(EventAlertTriggered, "Alert: "+t.Message, t.Message, map[string]interface{}{
+		"trigger_id": t.ID,
+		"rule_id":    t.RuleID,
+		"ticker":     t.Ticker,
+		"kind":       t.Kind,
+		"bar_date":   t.BarDate,
+		"value":      t.Value,
+		"message":    t.Message,
+	})
+}
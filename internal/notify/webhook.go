@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+)
+
+// Webhook request headers
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const webhookSecretPrefix = "whsec_"
+
+// WebhookChannel POSTs messages as JSON, signed with the channel's secret
+type WebhookChannel struct {
+	HTTP *http.Client
+}
+
+// NewWebhookChannel only connects to public addresses, checked on every
+// dial so a hostname that resolves somewhere else later can't reach
+// internal services, and doesn't follow redirects
+func NewWebhookChannel() *WebhookChannel {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: dialPublicOnly}
+	return &WebhookChannel{HTTP: &http.Client{
+		Timeout: 10 * time.Second,
+		// No proxy: it would make the dial check see the proxy, not the target
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// ErrPrivateAddress rejects webhook targets on loopback, private,
+// link-local, multicast or unspecified addresses
+var ErrPrivateAddress = errors.New("webhook target must be a public address")
+
+// publicIP reports whether a webhook may connect to ip
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// dialPublicOnly is a net.Dialer Control func; it sees the resolved address
+// being connected to
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return &PermanentError{ErrPrivateAddress}
+	}
+	return nil
+}
+
+// CheckWebhookURL validates a webhook target: an http or https URL whose
+// host resolves only to public addresses. Sends check again when they
+// connect, as DNS may have changed since.
+func CheckWebhookURL(ctx context.Context, target string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return errors.New("target must be an http or https URL")
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("target host %s could not be resolved", u.Hostname())
+	}
+	for _, a := range addrs {
+		if !publicIP(a.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// NewWebhookSecret returns a random signing secret for a new channel
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign computes the X-Webhook-Signature value: HMAC-SHA256 over
+// "<timestamp>.<body>", hex encoded and prefixed with "sha256="
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *WebhookChannel) Send(ch database.NotificationChannel, msg Message) (int, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return 0, &PermanentError{err}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ch.Target, bytes.NewReader(body))
+	if err != nil {
+		return 0, &PermanentError{err}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stock-saas-webhooks/1.0")
+	req.Header.Set(HeaderEvent, msg.Event)
+	req.Header.Set(HeaderID, msg.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(ch.Secret, timestamp, body))
+
+	resp, err := w.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	err = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	// Redirects aren't followed, and other 4xx responses mean the receiver rejected the payload; only
+	// timeouts, rate limits and server errors are worth retrying
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return resp.StatusCode, &PermanentError{err}
+	}
+	return resp.StatusCode, err
+}
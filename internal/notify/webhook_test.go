@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+	}{
+		{"empty body", "whsec_a", "1700000000", ""},
+		{"json body", "whsec_a", "1700000000", `{"id":"1","event":"alert.triggered"}`},
+		{"other secret", "whsec_b", "1700000000", `{"id":"1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write([]byte(tt.timestamp + "." + tt.body))
+			want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != want {
+				t.Errorf("Sign() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestSignDependsOnEveryInput(t *testing.T) {
+	base := Sign("whsec_a", "1700000000", []byte("body"))
+	for name, got := range map[string]string{
+		"secret":    Sign("whsec_b", "1700000000", []byte("body")),
+		"timestamp": Sign("whsec_a", "1700000001", []byte("body")),
+		"body":      Sign("whsec_a", "1700000000", []byte("body2")),
+	} {
+		if got == base {
+			t.Errorf("changing the %s kept the signature", name)
+		}
+	}
+	if !strings.HasPrefix(base, "sha256=") {
+		t.Errorf("Sign() = %s, want sha256= prefix", base)
+	}
+}
+
+func TestDialPublicOnly(t *testing.T) {
+	tests := []struct {
+		address string
+		ok      bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"10.0.0.5:80", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:80", false},
+		{"[fc00::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"[::]:80", false},
+		{"224.0.0.1:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := dialPublicOnly("tcp", tt.address, nil)
+			if tt.ok && err != nil {
+				t.Errorf("dialPublicOnly(%s) = %v, want nil", tt.address, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrPrivateAddress) {
+				t.Errorf("dialPublicOnly(%s) = %v, want ErrPrivateAddress", tt.address, err)
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	if !publicIP(net.ParseIP("8.8.8.8")) {
+		t.Error("8.8.8.8 should be public")
+	}
+	if publicIP(net.ParseIP("192.168.0.1")) {
+		t.Error("192.168.0.1 should not be public")
+	}
+}
@@ -0,0 +1,218 @@
+// Package problem writes errors as RFC 7807 problem details
+// (application/problem+json). Every error response carries a stable,
+// machine-readable code next to the human message, whether it is safe to
+// retry, and the request ID to quote in bug reports.
+package problem
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/requestid"
+	"github.com/chuma-beep/stock-saas/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of every error body
+const ContentType = "application/problem+json"
+
+// TypeBase prefixes the code to form the problem's type URI; the page
+// documents each code
+const TypeBase = "https://github.com/chuma-beep/stock-saas/blob/main/docs/errors.md#"
+
+// Error codes. They are part of the API: add new ones, never rename.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodePlanLimit           = "plan_limit"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeTooLarge            = "payload_too_large"
+	CodeRateLimited         = "rate_limited"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeUpstreamRateLimited = "upstream_rate_limited"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeUnavailable         = "service_unavailable"
+	CodeInternal            = "internal_error"
+)
+
+// Codes lists every code with the status it is normally sent with
+var Codes = []struct {
+	Code   string
+	Status int
+}{
+	{CodeInvalidRequest, http.StatusBadRequest},
+	{CodeValidationFailed, http.StatusBadRequest},
+	{CodeUnauthorized, http.StatusUnauthorized},
+	{CodeForbidden, http.StatusForbidden},
+	{CodePlanLimit, http.StatusForbidden},
+	{CodeNotFound, http.StatusNotFound},
+	{CodeConflict, http.StatusConflict},
+	{CodeTooLarge, http.StatusRequestEntityTooLarge},
+	{CodeRateLimited, http.StatusTooManyRequests},
+	{CodeQuotaExceeded, http.StatusTooManyRequests},
+	{CodeUpstreamRateLimited, http.StatusTooManyRequests},
+	{CodeUpstreamUnavailable, http.StatusServiceUnavailable},
+	{CodeUnavailable, http.StatusServiceUnavailable},
+	{CodeInternal, http.StatusInternalServerError},
+}
+
+// Error is an API error. Build one with New and the With* methods.
+type Error struct {
+	Status     int
+	Code       string
+	Message    string
+	Details    map[string]interface{}
+	Retryable  bool
+	RetryAfter time.Duration // sent as Retry-After when set
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Body is the JSON written for an Error
+type Body struct {
+	Type      string                 `json:"type"`
+	Title     string                 `json:"title"`
+	Status    int                    `json:"status"`
+	Detail    string                 `json:"detail"`
+	Instance  string                 `json:"instance,omitempty"`
+	Code      string                 `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Retryable bool                   `json:"retryable"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+// New makes an error with the usual code for status. 429 and the gateway
+// errors (502 and up) are retryable; a 500 is a bug and won't go away.
+func New(status int, msg string) *Error {
+	return &Error{
+		Status:    status,
+		Code:      codeFor(status),
+		Message:   msg,
+		Retryable: status == http.StatusTooManyRequests || status >= http.StatusBadGateway,
+	}
+}
+
+func codeFor(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusPaymentRequired:
+		return CodePlanLimit
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUpstreamUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// WithCode overrides the code derived from the status
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithDetail adds a key to details, e.g. the offending field
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithRetryAfter marks the error retryable after d
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	e.Retryable = true
+	e.RetryAfter = d
+	return e
+}
+
+// Upstream maps a data or AI provider failure: provider rate limits become
+// 429 upstream_rate_limited with Retry-After if the provider gave one,
+// anything else 503 upstream_unavailable. The provider's own message is
+// never sent to the client.
+func Upstream(err error, msg string) *Error {
+	if errors.Is(err, services.ErrRateLimited) {
+		return New(http.StatusTooManyRequests, msg).WithCode(CodeUpstreamRateLimited).
+			WithRetryAfter(services.RetryAfter(err))
+	}
+	return New(http.StatusServiceUnavailable, msg)
+}
+
+// Respond writes a problem with the usual code for status
+func Respond(c *gin.Context, status int, msg string) {
+	Write(c, New(status, msg))
+}
+
+// Write sends e as the response
+func Write(c *gin.Context, e *Error) {
+	if e.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
+	body := Body{
+		Type:      TypeBase + e.Code,
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		Message:   e.Message,
+		Details:   e.Details,
+		Retryable: e.Retryable,
+		RequestID: requestid.Get(c),
+	}
+	// Validators set for a successful response mustn't let caches keep an error
+	h := c.Writer.Header()
+	h.Del("ETag")
+	h.Del("Last-Modified")
+	h.Del("Cache-Control")
+	// gin keeps a Content-Type that is already set
+	c.Header("Content-Type", ContentType)
+	c.JSON(e.Status, body)
+}
+
+// Abort writes e and stops the handler chain; use it in middleware
+func Abort(c *gin.Context, e *Error) {
+	c.Abort()
+	Write(c, e)
+}
+
+// AbortWith is Abort with the usual code for status
+func AbortWith(c *gin.Context, status int, msg string) {
+	Abort(c, New(status, msg))
+}
+
+// NotFound answers unmatched routes
+func NotFound(c *gin.Context) {
+	Respond(c, http.StatusNotFound, "No route for "+c.Request.Method+" "+c.Request.URL.Path)
+}
+
+// Recovery answers panics with an internal_error problem, after gin has
+// logged the stack
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, _ any) {
+		AbortWith(c, http.StatusInternalServerError, "Internal error")
+	})
+}
@@ -0,0 +1,292 @@
+package prompts
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultName is the template used when a request doesn't pick one
+const DefaultName = "default"
+
+//go:embed templates/*.tmpl
+var builtin embed.FS
+
+// Template is one version of a named prompt together with its model settings
+type Template struct {
+	Name        string            `json:"name"`
+	Version     int               `json:"version"`
+	Description string            `json:"description"`
+	Model       string            `json:"model"`
+	Temperature float64           `json:"temperature"`
+	MaxTokens   int               `json:"max_tokens"`
+	Params      map[string]string `json:"params"`
+	Source      string            `json:"source"`
+
+	body *template.Template
+}
+
+// Data is what templates can reference when rendering
+type Data struct {
+	TickerA     string
+	TickerB     string
+	StartDate   string
+	EndDate     string
+	Preset      string
+	ChangeA     float64
+	ChangeB     float64
+	Winner      string
+	Margin      float64
+	Correlation float64 // percent
+	VolA        float64
+	VolB        float64
+	Schema      string
+	Params      map[string]string
+}
+
+// Render executes the template, layering request params over the defaults
+func (t *Template) Render(data Data, params map[string]string) (string, error) {
+	merged := make(map[string]string, len(t.Params)+len(params))
+	for k, v := range t.Params {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	data.Params = merged
+
+	var buf bytes.Buffer
+	if err := t.body.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s v%d: %w", t.Name, t.Version, err)
+	}
+	return buf.String(), nil
+}
+
+// Registry keeps every loaded version of each template
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]map[int]*Template
+}
+
+func NewRegistry() *Registry {
+	return &Registry{templates: make(map[string]map[int]*Template)}
+}
+
+// Add registers a template, replacing an existing one with the same name and version
+func (r *Registry) Add(t *Template) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.templates[t.Name] == nil {
+		r.templates[t.Name] = make(map[int]*Template)
+	}
+	r.templates[t.Name][t.Version] = t
+}
+
+// Get returns a specific version, or the latest when version is 0
+func (r *Registry) Get(name string, version int) (*Template, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt template %q", name)
+	}
+	if version == 0 {
+		for v := range versions {
+			if v > version {
+				version = v
+			}
+		}
+	}
+	t, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("prompt template %q has no version %d", name, version)
+	}
+	return t, nil
+}
+
+// List returns every template version, sorted by name then version
+func (r *Registry) List() []*Template {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var out []*Template
+	for _, versions := range r.templates {
+		for _, t := range versions {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Version < out[j].Version
+	})
+	return out
+}
+
+// Parse reads a template file: a front matter block of "key: value" lines
+// between "---" markers, followed by the text/template body. Windows line
+// endings are accepted.
+func Parse(content, source string) (*Template, error) {
+	t := &Template{Version: 1, Params: map[string]string{}, Source: source}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	if !strings.HasPrefix(content, "---\n") {
+		return nil, fmt.Errorf("%s: missing front matter", source)
+	}
+	rest := content[len("---\n"):]
+	end := strings.Index(rest, "\n---\n")
+	if end < 0 {
+		return nil, fmt.Errorf("%s: unterminated front matter", source)
+	}
+	header, body := rest[:end], rest[end+len("\n---\n"):]
+
+	scanner := bufio.NewScanner(strings.NewReader(header))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid front matter line %q", source, line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var err error
+		switch {
+		case key == "name":
+			t.Name = value
+		case key == "version":
+			t.Version, err = strconv.Atoi(value)
+		case key == "description":
+			t.Description = value
+		case key == "model":
+			t.Model = value
+		case key == "temperature":
+			t.Temperature, err = strconv.ParseFloat(value, 64)
+		case key == "max_tokens":
+			t.MaxTokens, err = strconv.Atoi(value)
+		case strings.HasPrefix(key, "param."):
+			t.Params[strings.TrimPrefix(key, "param.")] = value
+		default:
+			return nil, fmt.Errorf("%s: unknown front matter key %q", source, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s: %w", source, key, err)
+		}
+	}
+
+	if t.Name == "" {
+		return nil, fmt.Errorf("%s: name is required", source)
+	}
+	if t.Model == "" {
+		return nil, fmt.Errorf("%s: model is required", source)
+	}
+	if err := t.compile(body); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return t, nil
+}
+
+func (t *Template) compile(body string) error {
+	tmpl, err := template.New(t.Name).Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return err
+	}
+	t.body = tmpl
+	return nil
+}
+
+// LoadFS adds every *.tmpl file under dir in fsys
+func (r *Registry) LoadFS(fsys fs.FS, dir string) error {
+	matches, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.tmpl")))
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		t, err := Parse(string(content), path)
+		if err != nil {
+			return err
+		}
+		r.Add(t)
+	}
+	return nil
+}
+
+// LoadDir adds templates from a directory on disk, overriding built-ins
+func (r *Registry) LoadDir(dir string) error {
+	return r.LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadDB adds templates stored in the prompt_templates table
+func (r *Registry) LoadDB(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT name, version, description, model, temperature, max_tokens, params, body
+		FROM prompt_templates
+		ORDER BY name, version
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := &Template{Params: map[string]string{}}
+		var params []byte
+		var body string
+		if err := rows.Scan(&t.Name, &t.Version, &t.Description, &t.Model, &t.Temperature, &t.MaxTokens, &params, &body); err != nil {
+			return err
+		}
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &t.Params); err != nil {
+				return fmt.Errorf("prompt %s v%d: invalid params: %w", t.Name, t.Version, err)
+			}
+		}
+		if t.Model == "" {
+			return fmt.Errorf("prompt %s v%d: model is required", t.Name, t.Version)
+		}
+		t.Source = "db"
+		if err := t.compile(body); err != nil {
+			return fmt.Errorf("prompt %s v%d: %w", t.Name, t.Version, err)
+		}
+		r.Add(t)
+	}
+	return rows.Err()
+}
+
+// Default holds the built-in templates plus anything loaded at startup
+var Default = NewRegistry()
+
+func init() {
+	if err := Default.LoadFS(builtin, "templates"); err != nil {
+		log.Fatalf("Failed to load built-in prompt templates: %v", err)
+	}
+}
+
+// Get looks up a template in the default registry
+func Get(name string, version int) (*Template, error) {
+	return Default.Get(name, version)
+}
+
+// List returns every template in the default registry
+func List() []*Template {
+	return Default.List()
+}
@@ -0,0 +1,38 @@
+// Package requestid tags every request with an ID that is echoed in the
+// X-Request-ID header, written to the audit log and returned in errors.
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header is read from clients and proxies, and echoed back
+const Header = "X-Request-ID"
+
+const contextKey = "request_id"
+
+var pattern = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,64}$`)
+
+// Middleware reuses a well-formed incoming X-Request-ID or generates one
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !pattern.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set(contextKey, id)
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// Get returns the request's ID, or "" outside Middleware
+func Get(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
@@ -2,16 +2,38 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
+// Provider errors. Failures are wrapped around these so handlers can tell a
+// rate limit or a bad symbol from an outage.
+var (
+	ErrRateLimited   = errors.New("provider rate limit reached")
+	ErrUnknownSymbol = errors.New("unknown symbol")
+	ErrUnavailable   = errors.New("provider unavailable")
+)
+
+// RetryAfter returns how long the provider asked us to wait, if it said
+func RetryAfter(err error) time.Duration {
+	var statusErr *GroqStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
+
 type AlphaVantageResponse struct {
-	MetaData   map[string]string            `json:"Meta Data"`
-	TimeSeries map[string]map[string]string `json:"Time Series (Daily)"`
+	MetaData     map[string]string            `json:"Meta Data"`
+	TimeSeries   map[string]map[string]string `json:"Time Series (Daily)"`
+	Note         string                       `json:"Note"`          // per-minute limit
+	Information  string                       `json:"Information"`   // daily limit or premium-only
+	ErrorMessage string                       `json:"Error Message"` // e.g. invalid symbol
 }
 
 type StockData struct {
@@ -39,10 +61,14 @@ func FetchStockData(ticker string) ([]StockData, error) {
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch data: %w", err)
+		return nil, fmt.Errorf("%w: failed to fetch data: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: alpha vantage returned status %d", ErrUnavailable, resp.StatusCode)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
@@ -57,11 +83,16 @@ func FetchStockData(ticker string) ([]StockData, error) {
 
 	var avResp AlphaVantageResponse
 	if err := json.Unmarshal(body, &avResp); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse JSON: %w", ErrUnavailable, err)
 	}
 
-	if len(avResp.TimeSeries) == 0 {
-		return nil, fmt.Errorf("no data returned for ticker %s - API might be rate limited or key invalid", ticker)
+	switch {
+	case avResp.Note != "" || strings.Contains(avResp.Information, "rate limit"):
+		return nil, fmt.Errorf("%w: %s%s", ErrRateLimited, avResp.Note, avResp.Information)
+	case avResp.ErrorMessage != "":
+		return nil, fmt.Errorf("%w %s: %s", ErrUnknownSymbol, ticker, avResp.ErrorMessage)
+	case len(avResp.TimeSeries) == 0:
+		return nil, fmt.Errorf("%w: no data returned for ticker %s: %s", ErrUnavailable, ticker, avResp.Information)
 	}
 
 	var stocks []StockData
@@ -93,3 +124,72 @@ func FetchStockData(ticker string) ([]StockData, error) {
 	fmt.Printf("✅ Successfully parsed %d stock records\n", len(stocks))
 	return stocks, nil
 }
+
+// Quote is the latest trade for a symbol as of LatestDay
+type Quote struct {
+	Symbol        string
+	Price         float64
+	PreviousClose float64
+	LatestDay     time.Time
+}
+
+type globalQuoteResponse struct {
+	GlobalQuote  map[string]string `json:"Global Quote"`
+	Note         string            `json:"Note"`
+	Information  string            `json:"Information"`
+	ErrorMessage string            `json:"Error Message"`
+}
+
+// FetchQuote asks Alpha Vantage for the latest price of one ticker. Unlike
+// FetchStockData it is meant to be polled, so it doesn't log the response.
+func FetchQuote(ticker string) (Quote, error) {
+	apiKey := os.Getenv("ALPHA_VANTAGE_API_KEY")
+	if apiKey == "" {
+		return Quote{}, fmt.Errorf("ALPHA_VANTAGE_API_KEY not set")
+	}
+
+	url := fmt.Sprintf(
+		"https://www.alphavantage.co/query?function=GLOBAL_QUOTE&symbol=%s&apikey=%s",
+		ticker,
+		apiKey,
+	)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return Quote{}, fmt.Errorf("%w: failed to fetch quote: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return Quote{}, fmt.Errorf("%w: alpha vantage returned status %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var avResp globalQuoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&avResp); err != nil {
+		return Quote{}, fmt.Errorf("%w: failed to parse JSON: %w", ErrUnavailable, err)
+	}
+
+	switch {
+	case avResp.Note != "" || strings.Contains(avResp.Information, "rate limit"):
+		return Quote{}, fmt.Errorf("%w: %s%s", ErrRateLimited, avResp.Note, avResp.Information)
+	case avResp.ErrorMessage != "":
+		return Quote{}, fmt.Errorf("%w %s: %s", ErrUnknownSymbol, ticker, avResp.ErrorMessage)
+	case len(avResp.GlobalQuote) == 0:
+		// An unknown symbol comes back as an empty quote
+		return Quote{}, fmt.Errorf("%w %s: %s", ErrUnknownSymbol, ticker, avResp.Information)
+	}
+
+	q := Quote{Symbol: ticker}
+	day, err := time.Parse("2006-01-02", avResp.GlobalQuote["07. latest trading day"])
+	if err != nil {
+		return Quote{}, fmt.Errorf("%w: bad trading day in quote for %s", ErrUnavailable, ticker)
+	}
+	q.LatestDay = day
+	fmt.Sscanf(avResp.GlobalQuote["05. price"], "%f", &q.Price)
+	fmt.Sscanf(avResp.GlobalQuote["08. previous close"], "%f", &q.PreviousClose)
+	if q.Price <= 0 {
+		return Quote{}, fmt.Errorf("%w: no price in quote for %s", ErrUnavailable, ticker)
+	}
+	return q, nil
+}
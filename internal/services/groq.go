@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const groqURL = "https://api.groq.com/openai/v1/chat/completions"
+
+// Groq structs (OpenAI-compatible chat completions)
+type GroqMessage struct {
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []GroqToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type GroqToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type GroqTool struct {
+	Type     string           `json:"type"`
+	Function GroqToolFunction `json:"function"`
+}
+
+type GroqToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type GroqRequest struct {
+	Model          string              `json:"model"`
+	Messages       []GroqMessage       `json:"messages"`
+	Temperature    float64             `json:"temperature"`
+	MaxTokens      int                 `json:"max_tokens"`
+	Tools          []GroqTool          `json:"tools,omitempty"`
+	ToolChoice     string              `json:"tool_choice,omitempty"`
+	ResponseFormat *GroqResponseFormat `json:"response_format,omitempty"`
+}
+
+// GroqResponseFormat switches the model into JSON mode ("json_object")
+type GroqResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type GroqChoice struct {
+	Message      GroqMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+type GroqResponse struct {
+	Choices []GroqChoice `json:"choices"`
+}
+
+// GroqStatusError is returned when Groq answers with a non-200 status.
+// RetryAfter is Groq's Retry-After hint, zero if it gave none.
+type GroqStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *GroqStatusError) Error() string {
+	return fmt.Sprintf("groq returned status %d", e.StatusCode)
+}
+
+// Is makes a 429 match ErrRateLimited
+func (e *GroqStatusError) Is(target error) bool {
+	return target == ErrRateLimited && e.StatusCode == http.StatusTooManyRequests
+}
+
+// ChatClient is anything that can answer an OpenAI-style chat completion.
+// Groq is the production client; tools like cmd/evalprompts plug in others.
+type ChatClient interface {
+	CreateChatCompletion(req GroqRequest) (*GroqResponse, error)
+}
+
+// OpenAIClient talks to any OpenAI-compatible chat completions endpoint
+type OpenAIClient struct {
+	URL    string
+	APIKey string
+	HTTP   *http.Client
+}
+
+// NewGroqClient returns a client for Groq using GROQ_API_KEY
+func NewGroqClient() *OpenAIClient {
+	return &OpenAIClient{
+		URL:    groqURL,
+		APIKey: os.Getenv("GROQ_API_KEY"),
+		HTTP:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// CreateChatCompletion sends a chat completion request to Groq
+func CreateChatCompletion(req GroqRequest) (*GroqResponse, error) {
+	return NewGroqClient().CreateChatCompletion(req)
+}
+
+func (c *OpenAIClient) CreateChatCompletion(req GroqRequest) (*GroqResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	greq, err := http.NewRequest("POST", c.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	greq.Header.Set("Authorization", "Bearer "+c.APIKey)
+	greq.Header.Set("Content-Type", "application/json")
+
+	gresp, err := c.HTTP.Do(greq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call groq: %w", err)
+	}
+	defer gresp.Body.Close()
+
+	if gresp.StatusCode != http.StatusOK {
+		retryAfter, _ := strconv.Atoi(gresp.Header.Get("Retry-After"))
+		return nil, &GroqStatusError{StatusCode: gresp.StatusCode, RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
+
+	var groqResp GroqResponse
+	if err := json.NewDecoder(gresp.Body).Decode(&groqResp); err != nil {
+		return nil, fmt.Errorf("failed to parse groq response: %w", err)
+	}
+	return &groqResp, nil
+}
@@ -0,0 +1,131 @@
+package spam
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChallengeTTL is how long a proof-of-work challenge can be solved and used
+const ChallengeTTL = 10 * time.Minute
+
+// Challenge is a proof-of-work puzzle: find a nonce such that
+// SHA-256(token + nonce) starts with Difficulty zero bits
+type Challenge struct {
+	Token      string    `json:"token"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ErrNoSecret means neither FEEDBACK_POW_SECRET nor JWT_SECRET is set, so
+// challenges can't be signed
+var ErrNoSecret = errors.New("FEEDBACK_POW_SECRET or JWT_SECRET must be set to sign challenges")
+
+// Solved tokens, so each challenge is good for one submission
+var (
+	usedMu sync.Mutex
+	used   = map[string]time.Time{}
+)
+
+// PowDifficulty is the required number of leading zero bits, from
+// FEEDBACK_POW_DIFFICULTY (default 16, about 65k hashes). 0 disables it.
+func PowDifficulty() int {
+	if n, err := strconv.Atoi(os.Getenv("FEEDBACK_POW_DIFFICULTY")); err == nil && n >= 0 && n <= 32 {
+		return n
+	}
+	return 16
+}
+
+// NewChallenge issues a signed challenge. Tokens are stateless:
+// "<unix time>.<random>.<difficulty>.<signature>".
+func NewChallenge() (Challenge, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return Challenge{}, err
+	}
+	now := time.Now()
+	difficulty := PowDifficulty()
+	payload := strconv.FormatInt(now.Unix(), 10) + "." + hex.EncodeToString(b) + "." + strconv.Itoa(difficulty)
+	sig, err := sign(payload)
+	if err != nil {
+		return Challenge{}, err
+	}
+	return Challenge{
+		Token:      payload + "." + sig,
+		Difficulty: difficulty,
+		ExpiresAt:  now.Add(ChallengeTTL),
+	}, nil
+}
+
+// VerifySolution checks the token is ours, unexpired, unused, at least as
+// hard as PowDifficulty and solved by nonce
+func VerifySolution(token, nonce string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || nonce == "" || len(nonce) > 64 {
+		return false
+	}
+	sig, err := sign(strings.Join(parts[:3], "."))
+	if err != nil || !hmac.Equal([]byte(parts[3]), []byte(sig)) {
+		return false
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > ChallengeTTL {
+		return false
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	// Tokens issued before the difficulty was raised don't count
+	if err != nil || difficulty < PowDifficulty() || leadingZeroBits(sha256.Sum256([]byte(token+nonce))) < difficulty {
+		return false
+	}
+	return claim(token)
+}
+
+// claim marks token used, returning false if it already was
+func claim(token string) bool {
+	usedMu.Lock()
+	defer usedMu.Unlock()
+
+	now := time.Now()
+	for t, exp := range used {
+		if now.After(exp) {
+			delete(used, t)
+		}
+	}
+	if _, ok := used[token]; ok {
+		return false
+	}
+	used[token] = now.Add(ChallengeTTL)
+	return true
+}
+
+func sign(payload string) (string, error) {
+	secret := os.Getenv("FEEDBACK_POW_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))[:32], nil
+}
+
+func leadingZeroBits(sum [32]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,73 @@
+package spam
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// solve brute-forces a nonce for the challenge
+func solve(t *testing.T, c Challenge) string {
+	t.Helper()
+	for n := 0; n < 1<<24; n++ {
+		nonce := strconv.Itoa(n)
+		if leadingZeroBits(sha256.Sum256([]byte(c.Token+nonce))) >= c.Difficulty {
+			return nonce
+		}
+	}
+	t.Fatal("no nonce found")
+	return ""
+}
+
+func TestVerifySolution(t *testing.T) {
+	t.Setenv("FEEDBACK_POW_SECRET", "test-secret")
+	t.Setenv("FEEDBACK_POW_DIFFICULTY", "8")
+
+	c, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := solve(t, c)
+
+	if VerifySolution(c.Token, nonce+"x") && leadingZeroBits(sha256.Sum256([]byte(c.Token+nonce+"x"))) < c.Difficulty {
+		t.Error("accepted a wrong nonce")
+	}
+	if VerifySolution(c.Token[:len(c.Token)-1]+"0", nonce) {
+		t.Error("accepted a token with a bad signature")
+	}
+	if !VerifySolution(c.Token, nonce) {
+		t.Fatal("rejected a solved challenge")
+	}
+	if VerifySolution(c.Token, nonce) {
+		t.Error("accepted the same challenge twice")
+	}
+}
+
+func TestVerifySolutionRejectsEasierChallenges(t *testing.T) {
+	t.Setenv("FEEDBACK_POW_SECRET", "test-secret")
+	t.Setenv("FEEDBACK_POW_DIFFICULTY", "4")
+	c, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The difficulty was raised after the challenge was issued; even a
+	// nonce that meets the new difficulty doesn't make the token valid
+	t.Setenv("FEEDBACK_POW_DIFFICULTY", "8")
+	if VerifySolution(c.Token, solve(t, Challenge{Token: c.Token, Difficulty: 8})) {
+		t.Error("accepted a token issued at a lower difficulty")
+	}
+}
+
+func TestChallengesNeedASecret(t *testing.T) {
+	t.Setenv("FEEDBACK_POW_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+	if _, err := NewChallenge(); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("NewChallenge err = %v, want ErrNoSecret", err)
+	}
+	// Nothing unsigned, or signed with an empty key, gets through
+	if VerifySolution("1.00.0.", "1") {
+		t.Error("accepted a token without a secret")
+	}
+}
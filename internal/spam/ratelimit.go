@@ -0,0 +1,44 @@
+package spam
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// FeedbackPerHour is how many feedback posts one IP may make per hour, from
+// FEEDBACK_RATE_LIMIT (default 5)
+func FeedbackPerHour() int {
+	if n, err := strconv.Atoi(os.Getenv("FEEDBACK_RATE_LIMIT")); err == nil && n > 0 {
+		return n
+	}
+	return 5
+}
+
+// LimitByIP allows limit requests per client IP per window on a route. Like
+// the other limiters it fails open if the counter can't be updated.
+func LimitByIP(route string, limit int, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, reset, err := database.IncrementRateLimit(route+":ip:"+c.ClientIP(), window)
+		if err != nil {
+			log.Printf("Error recording rate limit: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(max(limit-count, 0)))
+		if count > limit {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+			problem.AbortWith(c, http.StatusTooManyRequests, "Too many requests, try again later")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,116 @@
+// Package spam keeps abuse out of anonymous forms: per-IP rate limits, a
+// proof-of-work challenge, and a pluggable content classifier.
+package spam
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Submission is the user-supplied content of a form post
+type Submission struct {
+	Name  string
+	Email string
+	Text  string
+	IP    string
+}
+
+// Verdict is a classifier's decision. Reasons explain a spam verdict to
+// moderators.
+type Verdict struct {
+	Spam    bool     `json:"spam"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Classifier decides whether a submission is spam. Implementations backed
+// by an external service should return an error rather than guess; callers
+// then keep the submission for review.
+type Classifier interface {
+	Classify(s Submission) (Verdict, error)
+}
+
+// Current is the classifier used for feedback. Swap it to plug in a
+// hosted service.
+var Current Classifier = Heuristic{}
+
+// SpamThreshold is the Heuristic score at which a submission is spam
+const SpamThreshold = 1.0
+
+var linkPattern = regexp.MustCompile(`(?i)https?://|www\.|\[url=`)
+
+// Terms that rarely appear in genuine product feedback
+var spamTerms = []string{
+	"viagra", "cialis", "casino", "betting", "payday loan", "crypto giveaway",
+	"backlinks", "seo services", "guest post", "whatsapp me", "telegram me",
+	"forex signals", "work from home", "adult dating",
+}
+
+// Heuristic scores content on links, known spam phrases and junk patterns.
+// It is cheap and errs toward letting borderline feedback through.
+type Heuristic struct{}
+
+func (Heuristic) Classify(s Submission) (Verdict, error) {
+	var v Verdict
+	flag := func(score float64, reason string) {
+		v.Score += score
+		v.Reasons = append(v.Reasons, reason)
+	}
+
+	text := strings.ToLower(s.Name + " " + s.Text)
+
+	if n := len(linkPattern.FindAllStringIndex(s.Text, -1)); n > 2 {
+		flag(1, "too many links")
+	} else if n > 0 {
+		flag(0.3*float64(n), "contains links")
+	}
+	if linkPattern.MatchString(s.Name) {
+		flag(1, "link in name")
+	}
+	for _, term := range spamTerms {
+		if strings.Contains(text, term) {
+			flag(0.6, "spam phrase: "+term)
+		}
+	}
+	if longestRun(s.Text) >= 10 {
+		flag(0.5, "repeated characters")
+	}
+	if letters, upper := letterCounts(s.Text); letters >= 20 && float64(upper)/float64(letters) > 0.8 {
+		flag(0.4, "mostly capitals")
+	}
+	if strings.TrimFunc(s.Text, func(r rune) bool { return !unicode.IsLetter(r) }) == "" {
+		flag(1, "no words")
+	}
+
+	v.Spam = v.Score >= SpamThreshold
+	return v, nil
+}
+
+// longestRun is the length of the longest run of one repeated character
+func longestRun(s string) int {
+	longest, run := 0, 0
+	var prev rune
+	for i, r := range []rune(s) {
+		if i > 0 && r == prev {
+			run++
+		} else {
+			run = 1
+		}
+		prev = r
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+func letterCounts(s string) (letters, upper int) {
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters, upper
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/chuma-beep/stock-saas/internal/services"
+)
+
+// DefaultMaxSteps caps how many rounds of tool calls the model may make
+const DefaultMaxSteps = 6
+
+// Tool is a function the model can call, described by a JSON schema
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+	Run         func(args json.RawMessage) (interface{}, error)
+}
+
+// Registry holds the tools offered to the model
+type Registry struct {
+	tools map[string]Tool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]Tool)}
+}
+
+// Register adds a tool, replacing any tool with the same name
+func (r *Registry) Register(t Tool) {
+	r.tools[t.Name] = t
+}
+
+// Definitions returns the tools in the Groq/OpenAI function-calling format
+func (r *Registry) Definitions() []services.GroqTool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]services.GroqTool, 0, len(names))
+	for _, name := range names {
+		t := r.tools[name]
+		defs = append(defs, services.GroqTool{
+			Type: "function",
+			Function: services.GroqToolFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// Execute runs a tool and returns its JSON-encoded result
+func (r *Registry) Execute(name, arguments string) (string, error) {
+	t, ok := r.tools[name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool %q", name)
+	}
+	if arguments == "" {
+		arguments = "{}"
+	}
+
+	result, err := t.Run(json.RawMessage(arguments))
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %s result: %w", name, err)
+	}
+	return string(out), nil
+}
+
+// Step records one tool call made while answering a question
+type Step struct {
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments"`
+	Error     string          `json:"error,omitempty"`
+	Output    json.RawMessage `json:"-"`
+}
+
+type RunResult struct {
+	Answer string `json:"answer"`
+	Steps  []Step `json:"steps"`
+}
+
+// Run lets the model, through client, call tools until it produces an
+// answer or runs out of steps, at which point it is asked to answer with
+// what it has gathered
+func (r *Registry) Run(client services.ChatClient, req services.GroqRequest, maxSteps int) (*RunResult, error) {
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+
+	result := &RunResult{Steps: []Step{}}
+	req.Tools = r.Definitions()
+	req.ToolChoice = "auto"
+
+	for step := 0; ; step++ {
+		if step == maxSteps {
+			// Out of budget: force a final answer from the collected tool output
+			req.ToolChoice = "none"
+		}
+
+		resp, err := client.CreateChatCompletion(req)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("model returned no choices")
+		}
+
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || step >= maxSteps {
+			result.Answer = msg.Content
+			return result, nil
+		}
+
+		req.Messages = append(req.Messages, msg)
+		for _, call := range msg.ToolCalls {
+			s := Step{Tool: call.Function.Name, Arguments: rawArguments(call.Function.Arguments)}
+
+			content, err := r.Execute(call.Function.Name, call.Function.Arguments)
+			if err != nil {
+				log.Printf("Tool %s failed: %v", call.Function.Name, err)
+				s.Error = err.Error()
+				content = fmt.Sprintf(`{"error": %q}`, err.Error())
+			}
+			s.Output = json.RawMessage(content)
+
+			result.Steps = append(result.Steps, s)
+			req.Messages = append(req.Messages, services.GroqMessage{
+				Role:       "tool",
+				Content:    content,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// rawArguments keeps the model's arguments as JSON when they are valid
+func rawArguments(arguments string) json.RawMessage {
+	if json.Valid([]byte(arguments)) {
+		return json.RawMessage(arguments)
+	}
+	out, _ := json.Marshal(arguments)
+	return out
+}
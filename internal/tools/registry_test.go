@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/chuma-beep/stock-saas/internal/services"
+)
+
+// scriptedClient replays replies in order, repeating the last one, and
+// records every request it was sent
+type scriptedClient struct {
+	replies  []services.GroqMessage
+	requests []services.GroqRequest
+}
+
+func (c *scriptedClient) CreateChatCompletion(req services.GroqRequest) (*services.GroqResponse, error) {
+	req.Messages = append([]services.GroqMessage(nil), req.Messages...)
+	c.requests = append(c.requests, req)
+	reply := c.replies[min(len(c.requests), len(c.replies))-1]
+	return &services.GroqResponse{Choices: []services.GroqChoice{{Message: reply}}}, nil
+}
+
+func toolCall(id, name, args string) services.GroqMessage {
+	call := services.GroqToolCall{ID: id, Type: "function"}
+	call.Function.Name, call.Function.Arguments = name, args
+	return services.GroqMessage{Role: "assistant", ToolCalls: []services.GroqToolCall{call}}
+}
+
+func testRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(Tool{Name: "echo", Run: func(args json.RawMessage) (interface{}, error) {
+		var in struct{ Say string }
+		if err := json.Unmarshal(args, &in); err != nil {
+			return nil, err
+		}
+		return map[string]string{"said": in.Say}, nil
+	}})
+	r.Register(Tool{Name: "broken", Run: func(json.RawMessage) (interface{}, error) {
+		return nil, errors.New(`no data for "XYZ"`)
+	}})
+	return r
+}
+
+func TestRunFeedsToolResultsBack(t *testing.T) {
+	client := &scriptedClient{replies: []services.GroqMessage{
+		toolCall("call_1", "echo", `{"say": "hi"}`),
+		{Role: "assistant", Content: "They said hi."},
+	}}
+	res, err := testRegistry().Run(client, services.GroqRequest{Messages: []services.GroqMessage{{Role: "user", Content: "What did they say?"}}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Answer != "They said hi." {
+		t.Errorf("Answer = %q", res.Answer)
+	}
+	if len(res.Steps) != 1 || res.Steps[0].Tool != "echo" || res.Steps[0].Error != "" {
+		t.Errorf("Steps = %+v", res.Steps)
+	}
+
+	last := client.requests[1].Messages
+	if len(last) != 3 {
+		t.Fatalf("second request has %d messages, want question, tool call and result", len(last))
+	}
+	if got := last[2]; got.Role != "tool" || got.ToolCallID != "call_1" || got.Content != `{"said":"hi"}` {
+		t.Errorf("tool message = %+v", got)
+	}
+	if len(client.requests[0].Tools) != 2 || client.requests[0].ToolChoice != "auto" {
+		t.Errorf("first request offers %d tools with choice %q", len(client.requests[0].Tools), client.requests[0].ToolChoice)
+	}
+}
+
+func TestRunFeedsErrorsBack(t *testing.T) {
+	tests := []struct {
+		name, tool, args, wantErr string
+	}{
+		{"tool error", "broken", `{}`, `no data for "XYZ"`},
+		{"unknown tool", "delete_everything", `{}`, `unknown tool "delete_everything"`},
+		{"invalid arguments", "echo", `{"say": `, "unexpected end of JSON input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &scriptedClient{replies: []services.GroqMessage{
+				toolCall("call_1", tt.tool, tt.args),
+				{Role: "assistant", Content: "Sorry, I couldn't find that."},
+			}}
+			res, err := testRegistry().Run(client, services.GroqRequest{}, 0)
+			if err != nil {
+				t.Fatalf("Run error = %v; tool errors should go to the model", err)
+			}
+			if len(res.Steps) != 1 || res.Steps[0].Error != tt.wantErr {
+				t.Errorf("Steps = %+v, want one with error %q", res.Steps, tt.wantErr)
+			}
+
+			// The model sees the error as a JSON object
+			msgs := client.requests[1].Messages
+			var fed struct{ Error string }
+			if err := json.Unmarshal([]byte(msgs[len(msgs)-1].Content), &fed); err != nil || fed.Error != tt.wantErr {
+				t.Errorf("tool message = %q, want {\"error\": %q}", msgs[len(msgs)-1].Content, tt.wantErr)
+			}
+			if !json.Valid(res.Steps[0].Arguments) {
+				t.Errorf("step arguments %q aren't JSON", res.Steps[0].Arguments)
+			}
+		})
+	}
+}
+
+func TestRunStopsAtMaxSteps(t *testing.T) {
+	// A model that never stops calling tools
+	client := &scriptedClient{replies: []services.GroqMessage{toolCall("call_1", "echo", `{"say": "again"}`)}}
+	res, err := testRegistry().Run(client, services.GroqRequest{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.requests) != 3 {
+		t.Fatalf("made %d requests, want 2 steps and a final answer", len(client.requests))
+	}
+	if len(res.Steps) != 2 {
+		t.Errorf("Steps = %+v, want 2", res.Steps)
+	}
+	for i, req := range client.requests {
+		want := "auto"
+		if i == 2 {
+			want = "none"
+		}
+		if req.ToolChoice != want {
+			t.Errorf("request %d tool_choice = %q, want %q", i, req.ToolChoice, want)
+		}
+	}
+}
+
+type failingClient struct{ err error }
+
+func (c failingClient) CreateChatCompletion(services.GroqRequest) (*services.GroqResponse, error) {
+	return nil, c.err
+}
+
+func TestRunReturnsClientErrors(t *testing.T) {
+	want := errors.New("groq: 503")
+	if _, err := testRegistry().Run(failingClient{want}, services.GroqRequest{}, 0); !errors.Is(err, want) {
+		t.Errorf("Run error = %v, want %v", err, want)
+	}
+
+	if _, err := testRegistry().Run(noChoicesClient{}, services.GroqRequest{}, 0); err == nil || !strings.Contains(err.Error(), "no choices") {
+		t.Errorf("Run error = %v, want no choices", err)
+	}
+}
+
+type noChoicesClient struct{}
+
+func (noChoicesClient) CreateChatCompletion(services.GroqRequest) (*services.GroqResponse, error) {
+	return &services.GroqResponse{}, nil
+}
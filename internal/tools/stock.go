@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/chuma-beep/stock-saas/internal/analytics"
+	"github.com/chuma-beep/stock-saas/internal/billing"
+	"github.com/chuma-beep/stock-saas/internal/database"
+	"github.com/chuma-beep/stock-saas/internal/validate"
+)
+
+type rangeArgs struct {
+	Ticker string `json:"ticker"`
+	Start  string `json:"start"`
+	End    string `json:"end"`
+}
+
+type series struct {
+	Dates   []string
+	Closes  []float64
+	Volumes []int64
+}
+
+var rangeProperties = map[string]interface{}{
+	"ticker": map[string]interface{}{"type": "string", "description": "Stock symbol, e.g. AAPL"},
+	"start":  map[string]interface{}{"type": "string", "description": "Start date (YYYY-MM-DD)"},
+	"end":    map[string]interface{}{"type": "string", "description": "End date (YYYY-MM-DD)"},
+}
+
+// stockTools runs the tools for one caller, within their plan's limits
+type stockTools struct {
+	plan billing.Plan
+}
+
+// StockTools returns a registry with the tools backed by the stocks table.
+// Like the REST routes, plan bounds how far back they read and how many
+// tickers compare_tickers takes.
+func StockTools(plan billing.Plan) *Registry {
+	t := stockTools{plan: plan}
+	r := NewRegistry()
+
+	r.Register(Tool{
+		Name:        "get_price_series",
+		Description: "Get daily closing prices and volume for a ticker between two dates.",
+		Parameters:  objectSchema(rangeProperties, "ticker", "start", "end"),
+		Run:         t.getPriceSeries,
+	})
+
+	r.Register(Tool{
+		Name:        "compute_indicator",
+		Description: "Compute a technical indicator (sma, ema, rsi or volatility) for a ticker between two dates.",
+		Parameters: objectSchema(withProperties(rangeProperties, map[string]interface{}{
+			"indicator": map[string]interface{}{"type": "string", "enum": []string{"sma", "ema", "rsi", "volatility"}},
+			"period":    map[string]interface{}{"type": "integer", "description": "Lookback period in trading days (default 14)"},
+		}), "ticker", "start", "end", "indicator"),
+		Run: t.computeIndicator,
+	})
+
+	r.Register(Tool{
+		Name:        "compute_drawdown",
+		Description: "Compute the maximum peak-to-trough drawdown for a ticker between two dates.",
+		Parameters:  objectSchema(rangeProperties, "ticker", "start", "end"),
+		Run:         t.computeDrawdown,
+	})
+
+	r.Register(Tool{
+		Name:        "compare_tickers",
+		Description: "Compare percent change, volatility, drawdown and return correlation of several tickers between two dates.",
+		Parameters: objectSchema(map[string]interface{}{
+			"tickers": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "minItems": 2, "maxItems": plan.MaxComparedTickers},
+			"start":   rangeProperties["start"],
+			"end":     rangeProperties["end"],
+		}, "tickers", "start", "end"),
+		Run: t.compareTickers,
+	})
+
+	return r
+}
+
+func (t stockTools) getPriceSeries(raw json.RawMessage) (interface{}, error) {
+	var args rangeArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	s, err := t.loadSeries(args.Ticker, args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]map[string]interface{}, len(s.Dates))
+	for i := range s.Dates {
+		points[i] = map[string]interface{}{
+			"date":   s.Dates[i],
+			"close":  s.Closes[i],
+			"volume": s.Volumes[i],
+		}
+	}
+	return map[string]interface{}{
+		"ticker":         strings.ToUpper(args.Ticker),
+		"percent_change": analytics.PercentChange(s.Closes),
+		"data":           points,
+	}, nil
+}
+
+func (t stockTools) computeIndicator(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		rangeArgs
+		Indicator string `json:"indicator"`
+		Period    int    `json:"period"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.Period <= 0 {
+		args.Period = 14
+	}
+	s, err := t.loadSeries(args.Ticker, args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []float64
+	switch strings.ToLower(args.Indicator) {
+	case "sma":
+		values = analytics.SMA(s.Closes, args.Period)
+	case "ema":
+		values = analytics.EMA(s.Closes, args.Period)
+	case "rsi":
+		values = analytics.RSI(s.Closes, args.Period)
+	case "volatility":
+		return map[string]interface{}{
+			"ticker":     strings.ToUpper(args.Ticker),
+			"indicator":  "volatility",
+			"annualized": analytics.Volatility(s.Closes),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported indicator %q", args.Indicator)
+	}
+
+	points := make([]map[string]interface{}, 0, len(values))
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		points = append(points, map[string]interface{}{"date": s.Dates[i], "value": v})
+	}
+	return map[string]interface{}{
+		"ticker":    strings.ToUpper(args.Ticker),
+		"indicator": strings.ToLower(args.Indicator),
+		"period":    args.Period,
+		"values":    points,
+	}, nil
+}
+
+func (t stockTools) computeDrawdown(raw json.RawMessage) (interface{}, error) {
+	var args rangeArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	s, err := t.loadSeries(args.Ticker, args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+
+	dd := analytics.MaxDrawdown(s.Closes)
+	return map[string]interface{}{
+		"ticker":       strings.ToUpper(args.Ticker),
+		"max_drawdown": dd.MaxDrawdown,
+		"peak_date":    s.Dates[dd.PeakIndex],
+		"peak_close":   s.Closes[dd.PeakIndex],
+		"trough_date":  s.Dates[dd.TroughIndex],
+		"trough_close": s.Closes[dd.TroughIndex],
+	}, nil
+}
+
+func (t stockTools) compareTickers(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Tickers []string `json:"tickers"`
+		Start   string   `json:"start"`
+		End     string   `json:"end"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	if len(args.Tickers) < 2 {
+		return nil, fmt.Errorf("at least two tickers are required")
+	}
+	if len(args.Tickers) > t.plan.MaxComparedTickers {
+		return nil, fmt.Errorf("the %s plan compares at most %d tickers", t.plan.Name, t.plan.MaxComparedTickers)
+	}
+
+	loaded := make([]*series, len(args.Tickers))
+	stats := make([]map[string]interface{}, len(args.Tickers))
+	for i, ticker := range args.Tickers {
+		s, err := t.loadSeries(ticker, args.Start, args.End)
+		if err != nil {
+			return nil, err
+		}
+		loaded[i] = s
+		stats[i] = map[string]interface{}{
+			"ticker":         strings.ToUpper(ticker),
+			"percent_change": analytics.PercentChange(s.Closes),
+			"volatility":     analytics.Volatility(s.Closes),
+			"max_drawdown":   analytics.MaxDrawdown(s.Closes).MaxDrawdown,
+		}
+	}
+
+	var correlations []map[string]interface{}
+	for i := 0; i < len(loaded); i++ {
+		for j := i + 1; j < len(loaded); j++ {
+			a, b := alignCloses(loaded[i], loaded[j])
+			correlations = append(correlations, map[string]interface{}{
+				"tickers":     []string{strings.ToUpper(args.Tickers[i]), strings.ToUpper(args.Tickers[j])},
+				"correlation": analytics.Correlation(analytics.Returns(a), analytics.Returns(b)),
+			})
+		}
+	}
+
+	return map[string]interface{}{
+		"start":        args.Start,
+		"end":          args.End,
+		"stocks":       stats,
+		"correlations": correlations,
+	}, nil
+}
+
+func (t stockTools) loadSeries(ticker, start, end string) (*series, error) {
+	errs := validate.Errors{}
+	ticker = errs.Ticker("ticker", ticker)
+	r := errs.DateRange("start", "end", start, end)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if !billing.HistoryAllowed(t.plan, r.Start) {
+		return nil, fmt.Errorf("start is older than the %s plan's history depth of %d days", t.plan.Name, t.plan.HistoryDays)
+	}
+	data, err := database.GetStockData(ticker, r.StartDate(), r.EndDate())
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data stored for %s between %s and %s", ticker, start, end)
+	}
+
+	s := &series{}
+	for _, row := range data {
+		s.Dates = append(s.Dates, row["date"].(string))
+		s.Closes = append(s.Closes, row["close"].(float64))
+		s.Volumes = append(s.Volumes, row["volume"].(int64))
+	}
+	return s, nil
+}
+
+// alignCloses keeps only the dates both series have, so returns line up
+func alignCloses(a, b *series) ([]float64, []float64) {
+	index := make(map[string]float64, len(b.Dates))
+	for i, d := range b.Dates {
+		index[d] = b.Closes[i]
+	}
+	var outA, outB []float64
+	for i, d := range a.Dates {
+		if close, ok := index[d]; ok {
+			outA = append(outA, a.Closes[i])
+			outB = append(outB, close)
+		}
+	}
+	return outA, outB
+}
+
+func decodeArgs(raw json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func withProperties(base, extra map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(extra))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/billing"
+)
+
+func TestStockToolsKeepToThePlan(t *testing.T) {
+	free, _ := billing.Lookup(billing.PlanFree)
+	today := time.Now().UTC()
+	old := today.AddDate(0, 0, -free.HistoryDays-30).Format("2006-01-02")
+	recent := today.AddDate(0, 0, -30).Format("2006-01-02")
+	end := today.Format("2006-01-02")
+
+	tests := []struct {
+		name, tool, args, wantErr string
+	}{
+		{"too many tickers", "compare_tickers",
+			`{"tickers": ["AAPL", "MSFT", "NVDA"], "start": "` + recent + `", "end": "` + end + `"}`, "compares at most 2 tickers"},
+		{"history too old", "get_price_series",
+			`{"ticker": "AAPL", "start": "` + old + `", "end": "` + end + `"}`, "history depth"},
+		{"comparison history too old", "compare_tickers",
+			`{"tickers": ["AAPL", "MSFT"], "start": "` + old + `", "end": "` + end + `"}`, "history depth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := StockTools(free).Execute(tt.tool, tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Execute(%s) error = %v, want %q", tt.tool, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Package validate parses and normalizes request input (tickers and date
+// ranges) and collects field-level errors, so a client sees every bad field
+// at once instead of fixing them one request at a time.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chuma-beep/stock-saas/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// DateFormat is the only date format the API accepts
+const DateFormat = "2006-01-02"
+
+// MaxRangeDays caps a date range; ten years of daily bars is plenty for one
+// response
+const MaxRangeDays = 3660
+
+// MaxTickerLength matches stocks.ticker VARCHAR(10)
+const MaxTickerLength = 10
+
+// earliestDate predates any bar Alpha Vantage serves
+var earliestDate = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// A root of up to 6 letters or digits, optionally followed by a class or
+// exchange suffix: BRK.B, RDS.A, SHOP.TO, TSCO.LON
+var tickerPattern = regexp.MustCompile(`^[A-Z0-9]{1,6}(\.[A-Z0-9]{1,4})?$`)
+
+var (
+	errRequired   = errors.New("is required")
+	errDateFormat = errors.New("must be a date in YYYY-MM-DD format")
+	errDateBounds = errors.New("must be between 1900-01-01 and tomorrow (UTC)")
+)
+
+// Errors maps a field name to what is wrong with it. The zero value is not
+// usable; start with Errors{}.
+type Errors map[string]string
+
+// Add records msg for field, keeping the first error per field
+func (e Errors) Add(field, msg string) {
+	if _, ok := e[field]; !ok {
+		e[field] = msg
+	}
+}
+
+// Error lists the fields in name order, e.g. "end: must not be before start"
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f + ": " + e[f]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Problem is the 400 validation_failed response; details.fields holds the
+// per-field messages
+func (e Errors) Problem() *problem.Error {
+	return problem.New(http.StatusBadRequest, "Invalid request: "+e.Error()).
+		WithCode(problem.CodeValidationFailed).
+		WithDetail("fields", map[string]string(e))
+}
+
+// OK writes the problem and returns false if any field failed
+func OK(c *gin.Context, errs Errors) bool {
+	if len(errs) == 0 {
+		return true
+	}
+	problem.Write(c, errs.Problem())
+	return false
+}
+
+// NormalizeTicker upper-cases a symbol and writes class shares with a dot,
+// so BRK-B, brk/b and BRK.B are all stored and looked up as BRK.B
+func NormalizeTicker(v string) (string, error) {
+	t := strings.ToUpper(strings.TrimSpace(v))
+	if t == "" {
+		return "", errRequired
+	}
+	t = strings.NewReplacer("-", ".", "/", ".").Replace(t)
+	if len(t) > MaxTickerLength || !tickerPattern.MatchString(t) {
+		return "", fmt.Errorf("%q is not a valid ticker", v)
+	}
+	return t, nil
+}
+
+// Ticker normalizes field's value, recording an error if it is invalid
+func (e Errors) Ticker(field, v string) string {
+	t, err := NormalizeTicker(v)
+	if err != nil {
+		e.Add(field, err.Error())
+	}
+	return t
+}
+
+// Tickers normalizes a list, skipping blanks and duplicates; an error names
+// the first bad entry
+func (e Errors) Tickers(field string, vs []string) []string {
+	seen := make(map[string]bool, len(vs))
+	tickers := make([]string, 0, len(vs))
+	for _, v := range vs {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		t, err := NormalizeTicker(v)
+		if err != nil {
+			e.Add(field, err.Error())
+			continue
+		}
+		if !seen[t] {
+			seen[t] = true
+			tickers = append(tickers, t)
+		}
+	}
+	return tickers
+}
+
+// ParseDate parses a YYYY-MM-DD date between 1900 and tomorrow; tomorrow
+// leaves room for clients ahead of UTC
+func ParseDate(v string) (time.Time, error) {
+	if strings.TrimSpace(v) == "" {
+		return time.Time{}, errRequired
+	}
+	d, err := time.Parse(DateFormat, strings.TrimSpace(v))
+	if err != nil {
+		return time.Time{}, errDateFormat
+	}
+	if err := CheckDate(d); err != nil {
+		return time.Time{}, err
+	}
+	return d, nil
+}
+
+// CheckDate rejects days outside 1900 to tomorrow
+func CheckDate(d time.Time) error {
+	if d.Before(earliestDate) || d.After(time.Now().UTC().AddDate(0, 0, 1)) {
+		return errDateBounds
+	}
+	return nil
+}
+
+// Date parses field's value, recording an error if it is invalid
+func (e Errors) Date(field, v string) time.Time {
+	d, err := ParseDate(v)
+	if err != nil {
+		e.Add(field, err.Error())
+	}
+	return d
+}
+
+// Range is an inclusive date range
+type Range struct {
+	Start, End time.Time
+}
+
+// StartDate and EndDate format the bounds for SQL and responses
+func (r Range) StartDate() string { return r.Start.Format(DateFormat) }
+func (r Range) EndDate() string   { return r.End.Format(DateFormat) }
+
+// DateRange parses both bounds, then checks end isn't before start and the
+// range is at most MaxRangeDays
+func (e Errors) DateRange(startField, endField, start, end string) Range {
+	r := Range{Start: e.Date(startField, start), End: e.Date(endField, end)}
+	if _, bad := e[startField]; bad {
+		return r
+	}
+	if _, bad := e[endField]; bad {
+		return r
+	}
+	if r.End.Before(r.Start) {
+		e.Add(endField, "must not be before "+startField)
+	} else if r.End.Sub(r.Start) > MaxRangeDays*24*time.Hour {
+		e.Add(endField, fmt.Sprintf("must be within %d days of %s", MaxRangeDays, startField))
+	}
+	return r
+}
@@ -0,0 +1,74 @@
+package validate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTicker(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"aapl", "AAPL", true},
+		{"  msft ", "MSFT", true},
+		{"BRK-B", "BRK.B", true},
+		{"brk/b", "BRK.B", true},
+		{"BRK.B", "BRK.B", true},
+		{"SHOP.TO", "SHOP.TO", true},
+		{"TSCO.LON", "TSCO.LON", true},
+		{"", "", false},
+		{"   ", "", false},
+		{"TOOLONG", "", false},
+		{"ABCDEF.GHIJ", "", false}, // 11 characters
+		{"BRK..B", "", false},
+		{".B", "", false},
+		{"AAPL;DROP", "", false},
+		{"ÅAPL", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeTicker(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("NormalizeTicker(%q) = %q, %v; want %q, ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTickersDropsBlanksAndDuplicates(t *testing.T) {
+	errs := Errors{}
+	got := errs.Tickers("tickers", []string{"brk-b", "", "BRK.B", "aapl", " ", "nope!", "AAPL", "??"})
+	if want := []string{"BRK.B", "AAPL"}; !slices.Equal(got, want) {
+		t.Errorf("Tickers = %v, want %v", got, want)
+	}
+	// Only the first bad entry is reported
+	if want := `"nope!" is not a valid ticker`; errs["tickers"] != want {
+		t.Errorf("error = %q, want %q", errs["tickers"], want)
+	}
+}
+
+func TestParseDateBounds(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"1900-01-01", true},
+		{"1899-12-31", false},
+		{now.Format(DateFormat), true},
+		{now.AddDate(0, 0, 1).Format(DateFormat), true},
+		{now.AddDate(0, 0, 2).Format(DateFormat), false},
+		{"2024-02-30", false},
+		{"03/01/2024", false},
+	}
+	for _, tt := range tests {
+		if _, err := ParseDate(tt.in); (err == nil) != tt.ok {
+			t.Errorf("ParseDate(%q) err = %v, want ok=%v", tt.in, err, tt.ok)
+		}
+	}
+	// The message states the bound CheckDate enforces
+	if _, err := ParseDate(now.AddDate(0, 0, 2).Format(DateFormat)); err != errDateBounds || !strings.Contains(err.Error(), "tomorrow") {
+		t.Errorf("err = %v, want the bounds error naming tomorrow", err)
+	}
+}
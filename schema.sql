@@ -10,5 +10,6 @@ CREATE TABLE stocks (
     close NUMERIC NOT NULL,
     volume BIGINT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     UNIQUE (ticker, date)
 );